@@ -13,12 +13,30 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/senago/technopark-dbms/internal/api"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/metrics"
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+	service "github.com/senago/technopark-dbms/internal/services"
+	"github.com/senago/technopark-dbms/internal/tracing"
 )
 
 const (
 	configPathEnvVar = "CONFIG_PATH"
 	defaultAddress   = "0.0.0.0"
 	defaultPort      = "8080"
+	defaultDBDriver  = "postgres"
+	defaultTimeout   = 5 * time.Second
+	defaultLanguage  = "english"
+	defaultTokenTTL  = 24 * time.Hour
+
+	defaultRateLimitStore = "memory"
+
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyWait    = 5 * time.Second
+	defaultIdempotencyLease   = time.Minute
+	defaultIdempotencyJanitor = time.Minute
+
+	defaultServiceName = "technopark-dbms"
 )
 
 func main() {
@@ -33,6 +51,19 @@ func main() {
 
 	viper.SetDefault("service.bind.address", defaultAddress)
 	viper.SetDefault("service.bind.port", defaultPort)
+	viper.SetDefault("service.timeouts.default", defaultTimeout)
+	viper.SetDefault("service.search.language", defaultLanguage)
+	viper.SetDefault("service.auth.token_ttl", defaultTokenTTL)
+	viper.SetDefault("tracing.service_name", defaultServiceName)
+	viper.SetDefault("tracing.exporter", tracing.ExporterStdout)
+	viper.SetDefault("tracing.sampling_ratio", 1.0)
+	viper.SetDefault("service.rate_limits.store", defaultRateLimitStore)
+	viper.SetDefault("service.idempotency.ttl", defaultIdempotencyTTL)
+	viper.SetDefault("service.idempotency.wait", defaultIdempotencyWait)
+	viper.SetDefault("service.idempotency.lease", defaultIdempotencyLease)
+	viper.SetDefault("service.idempotency.janitor_interval", defaultIdempotencyJanitor)
+	viper.SetDefault("db.driver", defaultDBDriver)
+	viper.SetDefault("db.migrate_on_start", true)
 
 	// -------------------- Set up logging -------------------- //
 
@@ -44,17 +75,130 @@ func main() {
 
 	sugar := logger.Sugar()
 
+	// -------------------- Run subcommands -------------------- //
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(sugar, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+		return
+	}
+
+	// -------------------- Set up tracing -------------------- //
+
+	shutdownTracing, err := tracing.Setup(context.Background(), &tracing.Config{
+		Enabled:       viper.GetBool("tracing.enabled"),
+		ServiceName:   viper.GetString("tracing.service_name"),
+		Exporter:      viper.GetString("tracing.exporter"),
+		File:          viper.GetString("tracing.file"),
+		Endpoint:      viper.GetString("tracing.endpoint"),
+		Insecure:      viper.GetBool("tracing.insecure"),
+		SamplingRatio: viper.GetFloat64("tracing.sampling_ratio"),
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %s", err)
+	}
+
 	// -------------------- Set up database -------------------- //
 
-	dbPool, err := pgxpool.Connect(context.Background(), viper.GetString("db.connection_string"))
+	appMetrics := metrics.New()
+
+	var repository *db.Repository
+	switch driver := viper.GetString("db.driver"); driver {
+	case "postgres":
+		dbPool, err := pgxpool.Connect(context.Background(), viper.GetString("db.connection_string"))
+		if err != nil {
+			log.Fatalf("unable to connect to database: %s", err)
+		}
+		defer dbPool.Close()
+		appMetrics.RegisterPool(dbPool)
+
+		migrator, err := db.NewMigrator(sugar, dbPool)
+		if err != nil {
+			log.Fatalf("error loading migrations: %s", err)
+		}
+		searchLanguage := viper.GetString("service.search.language")
+		if viper.GetBool("db.migrate_on_start") {
+			if err := migrator.Up(context.Background()); err != nil {
+				log.Fatalf("failed to apply migrations: %s", err)
+			}
+			if err := migrator.RebuildSearch(context.Background(), searchLanguage); err != nil {
+				log.Fatalf("failed to rebuild the search columns: %s", err)
+			}
+		} else if err := migrator.CheckSearchConfig(context.Background(), searchLanguage); err != nil {
+			log.Fatalf("failed to check the search columns: %s", err)
+		}
+
+		if repository, err = db.NewRepository(dbPool); err != nil {
+			log.Fatalf("error creating repository: %s", err)
+		}
+	case "memory":
+		sugar.Warn("using in-memory database, all data will be lost on shutdown")
+
+		if repository, err = db.NewMemoryRepository(); err != nil {
+			log.Fatalf("error creating repository: %s", err)
+		}
+	default:
+		log.Fatalf("unknown database driver: %s", driver)
+	}
+	repository = db.Instrument(repository, appMetrics.ObserveQuery)
+
+	// -------------------- Set up rate limits -------------------- //
+
+	rateLimits := map[string]ratelimit.Limit{}
+	if viper.GetBool("service.rate_limits.enabled") {
+		for group := range viper.GetStringMap("service.rate_limits.groups") {
+			rateLimits[group] = ratelimit.Limit{
+				Rate:  viper.GetFloat64("service.rate_limits.groups." + group + ".rate"),
+				Burst: viper.GetInt("service.rate_limits.groups." + group + ".burst"),
+			}
+		}
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch store := viper.GetString("service.rate_limits.store"); store {
+	case "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimitStore = repository.RateLimitRepository
+	default:
+		log.Fatalf("unknown rate limit store: %s", store)
+	}
+
+	rateLimiter, err := ratelimit.New(sugar, rateLimitStore, rateLimits)
 	if err != nil {
-		log.Fatalf("unable to connect to database: %s", err)
+		log.Fatalf("failed to set up rate limits: %s", err)
 	}
-	defer dbPool.Close()
 
 	// -------------------- Set up service -------------------- //
 
-	svc, err := api.NewAPIService(sugar, dbPool)
+	config := &api.Config{
+		Timeouts:     api.Timeouts{Default: viper.GetDuration("service.timeouts.default"), Routes: map[string]time.Duration{}},
+		CursorSecret: viper.GetString("service.cursor_secret"),
+		AdminToken:   viper.GetString("service.admin_token"),
+		Services: service.Config{
+			SearchLanguage: viper.GetString("service.search.language"),
+			TokenSecret:    []byte(viper.GetString("service.auth.token_secret")),
+			TokenTTL:       viper.GetDuration("service.auth.token_ttl"),
+			EnforceAuth:    viper.GetBool("service.auth.enforce"),
+			OpenClear:      viper.GetBool("service.auth.open_clear"),
+		},
+		Metrics:     appMetrics,
+		RateLimiter: rateLimiter,
+		Idempotency: api.Idempotency{
+			TTL:             viper.GetDuration("service.idempotency.ttl"),
+			Wait:            viper.GetDuration("service.idempotency.wait"),
+			Lease:           viper.GetDuration("service.idempotency.lease"),
+			JanitorInterval: viper.GetDuration("service.idempotency.janitor_interval"),
+		},
+	}
+	for route := range viper.GetStringMap("service.timeouts") {
+		if route != "default" {
+			config.Timeouts.Routes[route] = viper.GetDuration("service.timeouts." + route)
+		}
+	}
+
+	svc, err := api.NewAPIService(sugar, repository, config)
 	if err != nil {
 		log.Fatalf("error creating service instance: %s", err)
 	}
@@ -76,4 +220,7 @@ func main() {
 	if err := svc.Shutdown(ctx); err != nil {
 		log.Fatal(err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
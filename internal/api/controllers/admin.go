@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/auth"
+)
+
+const (
+	// AdminTokenHeader carries the token that grants administrative access to a request.
+	AdminTokenHeader = "X-Admin-Token"
+)
+
+// AdminTokens marks requests presenting the given token as administrative. With an empty token
+// no request is administrative, so administrative operations are disabled.
+func AdminTokens(token string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		presented := ctx.Get(AdminTokenHeader)
+		if token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1 {
+			ctx.SetUserContext(auth.WithAdmin(ctx.UserContext()))
+		}
+		return ctx.Next()
+	}
+}
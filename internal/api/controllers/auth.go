@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	service "github.com/senago/technopark-dbms/internal/services"
+)
+
+const (
+	bearerPrefix           = "Bearer "
+	tokenSubprotocolPrefix = "bearer."
+)
+
+type AuthController struct {
+	log      *customtypes.Logger
+	registry *service.Registry
+}
+
+func (c *AuthController) Login(ctx *fiber.Ctx) error {
+	request := &dto.LoginRequest{}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+
+	response, err := c.registry.AuthService.Login(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *AuthController) Logout(ctx *fiber.Ctx) error {
+	response, err := c.registry.AuthService.Logout(ctx.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(response.Code)
+}
+
+// Authenticate attaches the identity of requests bearing a session token or an API key, see requestToken,
+// to their user context. Requests without a token stay anonymous, those with an invalid one are rejected.
+// Reads are open to anyone, yet a key made without the read scope is not good for them either.
+func (c *AuthController) Authenticate(ctx *fiber.Ctx) error {
+	token, err := requestToken(ctx)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return ctx.Next()
+	}
+
+	identity, err := c.registry.AuthService.Authenticate(ctx.UserContext(), token)
+	if err != nil {
+		return err
+	}
+	if ctx.Method() == fiber.MethodGet && !identity.Grants(core.ScopeRead) {
+		return constants.NewCodedError("API key lacks the read scope", http.StatusForbidden)
+	}
+
+	ctx.SetUserContext(auth.WithIdentity(ctx.UserContext(), identity))
+	return ctx.Next()
+}
+
+// requestToken returns the token the request bears, if any. Browsers can not set headers on WebSocket upgrades,
+// so those may offer it as a "bearer.<token>" subprotocol next to gatewayProtocol instead.
+func requestToken(ctx *fiber.Ctx) (string, error) {
+	header := ctx.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		if websocket.FastHTTPIsWebSocketUpgrade(ctx.Context()) {
+			return subprotocolToken(ctx), nil
+		}
+		return "", nil
+	}
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Unsupported authorization scheme")
+	}
+	return header[len(bearerPrefix):], nil
+}
+
+func subprotocolToken(ctx *fiber.Ctx) string {
+	for _, protocol := range strings.Split(ctx.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		protocol = strings.TrimSpace(protocol)
+		if strings.HasPrefix(protocol, tokenSubprotocolPrefix) {
+			return protocol[len(tokenSubprotocolPrefix):]
+		}
+	}
+	return ""
+}
+
+func (c *AuthController) CreateAPIKey(ctx *fiber.Ctx) error {
+	request := &dto.CreateAPIKeyRequest{Nickname: ctx.Params("nickname")}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+
+	response, err := c.registry.AuthService.CreateAPIKey(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *AuthController) GetAPIKeys(ctx *fiber.Ctx) error {
+	request := &dto.GetAPIKeysRequest{Nickname: ctx.Params("nickname")}
+
+	response, err := c.registry.AuthService.GetAPIKeys(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *AuthController) RevokeAPIKey(ctx *fiber.Ctx) error {
+	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	request := &dto.RevokeAPIKeyRequest{Nickname: ctx.Params("nickname"), ID: id}
+
+	response, err := c.registry.AuthService.RevokeAPIKey(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func NewAuthController(log *customtypes.Logger, registry *service.Registry) *AuthController {
+	return &AuthController{log: log, registry: registry}
+}
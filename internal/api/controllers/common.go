@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/constants"
+)
+
+// parseBody decodes the request body into out, reporting malformed bodies as bad requests.
+func parseBody(ctx *fiber.Ctx, out interface{}) error {
+	if err := ctx.BodyParser(out); err != nil {
+		return constants.WrapCodedError(err, http.StatusBadRequest)
+	}
+	return nil
+}
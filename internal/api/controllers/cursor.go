@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+var errMalformedCursor = errors.New("malformed cursor")
+
+// CursorCodec turns pagination cursors into opaque tokens and back.
+// A token is the base64url encoded JSON of the cursor followed by its HMAC-SHA256 signature,
+// so that clients can not forge positions in a listing.
+type CursorCodec struct {
+	key []byte
+}
+
+func (c *CursorCodec) Encode(cursor *dto.Cursor) (string, error) {
+	payload, err := sonic.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+func (c *CursorCodec) Decode(token string) (*dto.Cursor, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errMalformedCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errMalformedCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return nil, errMalformedCursor
+	}
+
+	cursor := &dto.Cursor{}
+	if err := sonic.Unmarshal(payload, cursor); err != nil {
+		return nil, errMalformedCursor
+	}
+	return cursor, nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// queryCursor decodes the cursor query parameter, if any.
+func (c *CursorCodec) queryCursor(ctx *fiber.Ctx) (*dto.Cursor, error) {
+	token := ctx.Query("cursor")
+	if token == "" {
+		return nil, nil
+	}
+
+	cursor, err := c.Decode(token)
+	if err != nil {
+		return nil, constants.NewCodedError("Invalid cursor", http.StatusBadRequest)
+	}
+	return cursor, nil
+}
+
+// setLinks advertises the neighbouring pages of a listing in a Link header. Their URLs are the request's one
+// with the cursor replaced; since and desc are dropped as the cursor determines both.
+func (c *CursorCodec) setLinks(ctx *fiber.Ctx, response *dto.Response) error {
+	if response.Next == nil && response.Prev == nil {
+		return nil
+	}
+
+	query, err := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	if err != nil {
+		return constants.WrapCodedError(err, http.StatusBadRequest)
+	}
+	query.Del("since")
+	query.Del("desc")
+
+	links := bytes.Buffer{}
+	for _, link := range []struct {
+		rel    string
+		cursor *dto.Cursor
+	}{{"next", response.Next}, {"prev", response.Prev}} {
+		if link.cursor == nil {
+			continue
+		}
+
+		token, err := c.Encode(link.cursor)
+		if err != nil {
+			return err
+		}
+		query.Set("cursor", token)
+
+		if links.Len() > 0 {
+			links.WriteString(", ")
+		}
+		fmt.Fprintf(&links, "<%s?%s>; rel=\"%s\"", ctx.Path(), query.Encode(), link.rel)
+	}
+
+	ctx.Set(fiber.HeaderLink, links.String())
+	return nil
+}
+
+func NewCursorCodec(key []byte) *CursorCodec {
+	return &CursorCodec{key: key}
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	service "github.com/senago/technopark-dbms/internal/services"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream gets a comment, which keeps proxies from closing it
+	// and finds out about clients that went away.
+	streamKeepAlive = 15 * time.Second
+
+	// gatewayHeartbeat is how often gateway clients are pinged and the token they connected with is checked again.
+	// A client that sends nothing, pongs included, for gatewayReadWait is disconnected.
+	gatewayHeartbeat = 30 * time.Second
+	gatewayReadWait  = 2 * gatewayHeartbeat
+	gatewayWriteWait = 10 * time.Second
+	// gatewayMessageLimit caps the size of the messages of gateway clients.
+	gatewayMessageLimit = 4096
+
+	// gatewayProtocol is the subprotocol the gateway speaks, clients that pass their token as a subprotocol
+	// have to offer it too, so that the one the server picks is not the token.
+	gatewayProtocol = "forum-events"
+)
+
+// gatewayUpgrader takes connections from any origin: the gateway is authenticated by tokens, never by cookies,
+// so pages of other origins can not act on behalf of a user by opening it.
+var gatewayUpgrader = websocket.FastHTTPUpgrader{
+	Subprotocols: []string{gatewayProtocol},
+	CheckOrigin:  func(*fasthttp.RequestCtx) bool { return true },
+	// Failed handshakes are rendered by the error handler.
+	Error: func(*fasthttp.RequestCtx, int, error) {},
+}
+
+type EventsController struct {
+	log      *customtypes.Logger
+	registry *service.Registry
+	// gateways counts the open gateway connections, which are hijacked from the server and so not awaited by its shutdown.
+	gateways sync.WaitGroup
+}
+
+// StreamThread serves the events of a thread as Server-Sent Events. Post events carry the post id as
+// their event id, so a reconnecting EventSource resumes after the last post it got with Last-Event-ID.
+func (c *EventsController) StreamThread(ctx *fiber.Ctx) error {
+	request := &dto.WatchThreadRequest{SlugOrID: ctx.Params("slug_or_id"), LastEventID: -1}
+	if lastEventID := ctx.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return constants.NewCodedError(fmt.Sprintf("Invalid Last-Event-ID: %s", lastEventID), http.StatusBadRequest)
+		}
+		request.LastEventID = id
+	}
+
+	stream, err := c.registry.EventsService.WatchThread(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set("X-Accel-Buffering", "no")
+	// The writer runs after the handler has returned, it may only use what it closes over.
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer stream.Close()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		w.WriteString(": watching\n\n")
+		for {
+			if err := w.Flush(); err != nil {
+				return
+			}
+			select {
+			case event, ok := <-stream.Events:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					c.log.Errorf("writing a thread event: %v", err)
+					return
+				}
+			case <-keepAlive.C:
+				w.WriteString(": keep-alive\n\n")
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, event *dto.ThreadEvent) error {
+	data, err := sonic.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.ID != 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+	return nil
+}
+
+// Gateway upgrades the request to a WebSocket that delivers the events of the topics the client subscribes to
+// with dto.GatewayRequest: forum:<slug>, thread:<id> and user:<nickname>. Browsers authenticate by offering
+// the subprotocols gatewayProtocol and "bearer.<token>", see requestToken. Clients that fall behind are
+// disconnected with 1013 (try again later), those whose token stops being valid with 1008 (policy violation).
+func (c *EventsController) Gateway(ctx *fiber.Ctx) error {
+	if !websocket.FastHTTPIsWebSocketUpgrade(ctx.Context()) {
+		return constants.NewCodedError("Expected a WebSocket upgrade", http.StatusUpgradeRequired)
+	}
+	// Authenticate has checked the token already, fiber reuses the memory it points to after the handler returns.
+	token, _ := requestToken(ctx)
+	token = strings.Clone(token)
+
+	subscription := c.registry.EventsService.Subscribe()
+	c.gateways.Add(1)
+	err := gatewayUpgrader.Upgrade(ctx.Context(), func(conn *websocket.Conn) {
+		defer c.gateways.Done()
+		c.serveGateway(conn, subscription, token)
+	})
+	if err != nil {
+		c.gateways.Done()
+		subscription.Close()
+		return constants.WrapCodedError(err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// DrainGateways waits for the gateway connections to close, which they do once the events service stops.
+func (c *EventsController) DrainGateways(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		c.gateways.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveGateway writes to the connection while a goroutine of its own reads from it.
+func (c *EventsController) serveGateway(conn *websocket.Conn, subscription *service.Subscription, token string) {
+	defer conn.Close()
+	defer subscription.Close()
+
+	replies := make(chan *dto.GatewayMessage)
+	readerDone, writerDone := make(chan struct{}), make(chan struct{})
+	defer close(writerDone)
+	go func() {
+		defer close(readerDone)
+		c.readGateway(conn, subscription, replies, writerDone)
+	}()
+
+	heartbeat := time.NewTicker(gatewayHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case message, ok := <-subscription.Events:
+			if !ok {
+				closeGateway(conn, subscription.Err())
+				return
+			}
+			err = writeGatewayMessage(conn, message)
+		case reply := <-replies:
+			err = writeGatewayMessage(conn, reply)
+		case <-heartbeat.C:
+			if !c.tokenValid(token) {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Authentication expired"), time.Now().Add(gatewayWriteWait))
+				return
+			}
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(gatewayWriteWait))
+		case <-readerDone:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *EventsController) readGateway(conn *websocket.Conn, subscription *service.Subscription, replies chan<- *dto.GatewayMessage, writerDone <-chan struct{}) {
+	conn.SetReadLimit(gatewayMessageLimit)
+	conn.SetReadDeadline(time.Now().Add(gatewayReadWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(gatewayReadWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(gatewayReadWait))
+
+		reply := &dto.GatewayMessage{}
+		request := &dto.GatewayRequest{}
+		if err := sonic.Unmarshal(data, request); err != nil {
+			reply.Type, reply.Message = dto.GatewayError, "Malformed message"
+		} else if request.Op == dto.GatewayPing {
+			reply.Type = dto.GatewayPong
+		} else if topics, err := subscription.Update(request); err != nil {
+			reply.Type, reply.Message = dto.GatewayError, err.Error()
+		} else {
+			reply.Type, reply.Topics = dto.GatewaySubscribed, topics
+		}
+
+		select {
+		case replies <- reply:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// tokenValid reports whether the token a gateway client connected with is still good, anonymous clients always are.
+// The client stays connected when the check itself fails.
+func (c *EventsController) tokenValid(token string) bool {
+	if token == "" {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayWriteWait)
+	defer cancel()
+
+	_, err := c.registry.AuthService.Authenticate(ctx, token)
+	var codedErr *constants.CodedError
+	if errors.As(err, &codedErr) && codedErr.Code() == http.StatusUnauthorized {
+		return false
+	}
+	if err != nil {
+		c.log.Errorf("checking the token of a gateway client: %v", err)
+	}
+	return true
+}
+
+func writeGatewayMessage(conn *websocket.Conn, message *dto.GatewayMessage) error {
+	data, err := sonic.Marshal(message)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(gatewayWriteWait))
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// closeGateway tells the client why its subscription ended.
+func closeGateway(conn *websocket.Conn, reason error) {
+	code, text := websocket.CloseNormalClosure, ""
+	switch {
+	case errors.Is(reason, service.ErrEventsFellBehind):
+		code, text = websocket.CloseTryAgainLater, "Fell behind the events"
+	case errors.Is(reason, service.ErrEventsShutdown):
+		code, text = websocket.CloseGoingAway, "Shutting down"
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(gatewayWriteWait))
+}
+
+func NewEventsController(log *customtypes.Logger, registry *service.Registry) *EventsController {
+	return &EventsController{log: log, registry: registry}
+}
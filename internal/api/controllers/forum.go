@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"context"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,15 +12,16 @@ import (
 type ForumController struct {
 	log      *customtypes.Logger
 	registry *service.Registry
+	cursors  *CursorCodec
 }
 
 func (c *ForumController) CreateForum(ctx *fiber.Ctx) error {
 	request := &dto.CreateForumRequest{}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
-	response, err := c.registry.ForumService.CreateForum(context.Background(), request)
+	response, err := c.registry.ForumService.CreateForum(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -32,7 +32,7 @@ func (c *ForumController) CreateForum(ctx *fiber.Ctx) error {
 func (c *ForumController) GetForumBySlug(ctx *fiber.Ctx) error {
 	request := &dto.GetForumBySlugRequest{Slug: ctx.Params("slug")}
 
-	response, err := c.registry.ForumService.GetForumBySlug(context.Background(), request)
+	response, err := c.registry.ForumService.GetForumBySlug(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -43,22 +43,82 @@ func (c *ForumController) GetForumBySlug(ctx *fiber.Ctx) error {
 func (c *ForumController) GetForumThreads(ctx *fiber.Ctx) error {
 	limit, _ := strconv.ParseInt(ctx.Query("limit", "100"), 10, 64)
 	desc, _ := strconv.ParseBool(ctx.Query("desc"))
-	request := &dto.GetForumThreadsRequest{Slug: ctx.Params("slug"), Limit: limit, Since: ctx.Query("since"), Desc: desc}
+	cursor, err := c.cursors.queryCursor(ctx)
+	if err != nil {
+		return err
+	}
+	request := &dto.GetForumThreadsRequest{Slug: ctx.Params("slug"), Limit: limit, Since: ctx.Query("since"), Desc: desc, Cursor: cursor}
 
-	response, err := c.registry.ForumService.GetForumThreads(context.Background(), request)
+	response, err := c.registry.ForumService.GetForumThreads(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
 
+	if err := c.cursors.setLinks(ctx, response); err != nil {
+		return err
+	}
 	return ctx.Status(response.Code).JSON(response.Data)
 }
 
 func (c *ForumController) GetForumUsers(ctx *fiber.Ctx) error {
 	limit, _ := strconv.ParseInt(ctx.Query("limit", "100"), 10, 64)
 	desc, _ := strconv.ParseBool(ctx.Query("desc"))
-	request := &dto.GetForumUsersRequest{Slug: ctx.Params("slug"), Limit: limit, Since: ctx.Query("since"), Desc: desc}
+	cursor, err := c.cursors.queryCursor(ctx)
+	if err != nil {
+		return err
+	}
+	request := &dto.GetForumUsersRequest{Slug: ctx.Params("slug"), Limit: limit, Since: ctx.Query("since"), Desc: desc, Cursor: cursor}
+
+	response, err := c.registry.ForumService.GetForumUsers(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	if err := c.cursors.setLinks(ctx, response); err != nil {
+		return err
+	}
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumController) GetForumChildren(ctx *fiber.Ctx) error {
+	request := &dto.GetForumChildrenRequest{Slug: ctx.Params("slug")}
+
+	response, err := c.registry.ForumService.GetForumChildren(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumController) GetForumTree(ctx *fiber.Ctx) error {
+	response, err := c.registry.ForumService.GetForumTree(ctx.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumController) UpdateForum(ctx *fiber.Ctx) error {
+	request := &dto.UpdateForumRequest{}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+	slug := ctx.Params("slug")
+
+	response, err := c.registry.ForumService.UpdateForum(ctx.UserContext(), slug, request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumController) DeleteForum(ctx *fiber.Ctx) error {
+	request := &dto.DeleteForumRequest{Slug: ctx.Params("slug"), Mode: ctx.Query("mode")}
 
-	response, err := c.registry.ForumService.GetForumUsers(context.Background(), request)
+	response, err := c.registry.ForumService.DeleteForum(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -66,6 +126,6 @@ func (c *ForumController) GetForumUsers(ctx *fiber.Ctx) error {
 	return ctx.Status(response.Code).JSON(response.Data)
 }
 
-func NewForumController(log *customtypes.Logger, registry *service.Registry) *ForumController {
-	return &ForumController{log: log, registry: registry}
+func NewForumController(log *customtypes.Logger, registry *service.Registry, cursors *CursorCodec) *ForumController {
+	return &ForumController{log: log, registry: registry, cursors: cursors}
 }
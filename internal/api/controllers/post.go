@@ -1,11 +1,12 @@
 package controllers
 
 import (
-	"context"
+	"net/http"
 	"strconv"
 
 	"github.com/bytedance/sonic"
 	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/model/dto"
 	service "github.com/senago/technopark-dbms/internal/services"
@@ -14,16 +15,17 @@ import (
 type PostsController struct {
 	log      *customtypes.Logger
 	registry *service.Registry
+	cursors  *CursorCodec
 }
 
 func (c *PostsController) CreatePosts(ctx *fiber.Ctx) error {
 	posts := []*dto.PostData{}
 	if err := sonic.Unmarshal(ctx.Body(), &posts); err != nil {
-		return err
+		return constants.WrapCodedError(err, http.StatusBadRequest)
 	}
 
 	slugOrID := ctx.Params("slug_or_id")
-	response, err := c.registry.PostsService.CreatePosts(context.Background(), slugOrID, posts)
+	response, err := c.registry.PostsService.CreatePosts(ctx.UserContext(), slugOrID, posts)
 	if err != nil {
 		return err
 	}
@@ -32,17 +34,23 @@ func (c *PostsController) CreatePosts(ctx *fiber.Ctx) error {
 }
 
 func (c *PostsController) GetPosts(ctx *fiber.Ctx) error {
-	slugOrID := ctx.Params("slug_or_id")
-	sort := ctx.Query("sort", "flat")
 	since, _ := strconv.ParseInt(ctx.Query("since", "-1"), 10, 64)
 	desc, _ := strconv.ParseBool(ctx.Query("desc"))
 	limit, _ := strconv.ParseInt(ctx.Query("limit", "100"), 10, 64)
+	cursor, err := c.cursors.queryCursor(ctx)
+	if err != nil {
+		return err
+	}
+	request := &dto.GetPostsRequest{SlugOrID: ctx.Params("slug_or_id"), Sort: ctx.Query("sort", "flat"), Since: since, Desc: desc, Limit: limit, Cursor: cursor}
 
-	response, err := c.registry.PostsService.GetPosts(context.Background(), slugOrID, sort, since, desc, limit)
+	response, err := c.registry.PostsService.GetPosts(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
 
+	if err := c.cursors.setLinks(ctx, response); err != nil {
+		return err
+	}
 	return ctx.Status(response.Code).JSON(response.Data)
 }
 
@@ -50,7 +58,7 @@ func (c *PostsController) GetPostDetails(ctx *fiber.Ctx) error {
 	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
 	request := &dto.GetPostDetailsRequest{ID: id, Related: ctx.Query("related")}
 
-	response, err := c.registry.PostsService.GetPostDetails(context.Background(), request)
+	response, err := c.registry.PostsService.GetPostDetails(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -61,11 +69,64 @@ func (c *PostsController) GetPostDetails(ctx *fiber.Ctx) error {
 func (c *PostsController) UpdatePost(ctx *fiber.Ctx) error {
 	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
 	request := &dto.UpdatePostRequest{ID: id}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+
+	response, err := c.registry.PostsService.UpdatePost(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *PostsController) GetPostRevisions(ctx *fiber.Ctx) error {
+	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	request := &dto.GetPostRevisionsRequest{ID: id}
+
+	response, err := c.registry.PostsService.GetPostRevisions(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *PostsController) GetPostRevisionDiff(ctx *fiber.Ctx) error {
+	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	number, _ := strconv.ParseInt(ctx.Params("n"), 10, 64)
+	request := &dto.GetPostRevisionDiffRequest{ID: id, Number: number}
+
+	response, err := c.registry.PostsService.GetPostRevisionDiff(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *PostsController) DeletePost(ctx *fiber.Ctx) error {
+	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	hard, _ := strconv.ParseBool(ctx.Query("hard"))
+	request := &dto.DeletePostRequest{ID: id, Hard: hard}
+
+	response, err := c.registry.PostsService.DeletePost(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *PostsController) SplitPost(ctx *fiber.Ctx) error {
+	id, _ := strconv.ParseInt(ctx.Params("id"), 10, 64)
+	request := &dto.SplitPostRequest{ID: id}
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
-	response, err := c.registry.PostsService.UpdatePost(context.Background(), request)
+	response, err := c.registry.PostsService.SplitPost(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -73,6 +134,6 @@ func (c *PostsController) UpdatePost(ctx *fiber.Ctx) error {
 	return ctx.Status(response.Code).JSON(response.Data)
 }
 
-func NewPostsController(log *customtypes.Logger, registry *service.Registry) *PostsController {
-	return &PostsController{log: log, registry: registry}
+func NewPostsController(log *customtypes.Logger, registry *service.Registry, cursors *CursorCodec) *PostsController {
+	return &PostsController{log: log, registry: registry, cursors: cursors}
 }
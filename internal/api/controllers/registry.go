@@ -12,22 +12,29 @@ type Registry struct {
 	ForumThreadController *ForumThreadController
 	PostsController       *PostsController
 	ServiceController     *ServiceController
+	SearchController      *SearchController
+	AuthController        *AuthController
+	RoleController        *RoleController
+	EventsController      *EventsController
+
+	// Services are the services behind the controllers, for the background work some of them do.
+	Services *service.Registry
 }
 
-func NewRegistry(log *customtypes.Logger, dbConn *customtypes.DBConn) *Registry {
-	repository, err := db.NewRepository(dbConn)
-	if err != nil {
-		log.Fatal(err)
-	}
-	serviceRegistry := service.NewRegistry(log, repository)
+func NewRegistry(log *customtypes.Logger, repository *db.Repository, cursors *CursorCodec, services *service.Config) *Registry {
+	serviceRegistry := service.NewRegistry(log, repository, services)
 
-	registry := &Registry{}
+	registry := &Registry{Services: serviceRegistry}
 
 	registry.UserController = NewUserController(log, serviceRegistry)
-	registry.ForumController = NewForumController(log, serviceRegistry)
+	registry.ForumController = NewForumController(log, serviceRegistry, cursors)
 	registry.ForumThreadController = NewForumThreadController(log, serviceRegistry)
-	registry.PostsController = NewPostsController(log, serviceRegistry)
-	registry.ServiceController = NewServiceController(log, repository)
+	registry.PostsController = NewPostsController(log, serviceRegistry, cursors)
+	registry.ServiceController = NewServiceController(log, repository, serviceRegistry)
+	registry.SearchController = NewSearchController(log, serviceRegistry, cursors)
+	registry.AuthController = NewAuthController(log, serviceRegistry)
+	registry.RoleController = NewRoleController(log, serviceRegistry)
+	registry.EventsController = NewEventsController(log, serviceRegistry)
 
 	return registry
 }
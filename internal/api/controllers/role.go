@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	service "github.com/senago/technopark-dbms/internal/services"
+)
+
+type RoleController struct {
+	log      *customtypes.Logger
+	registry *service.Registry
+}
+
+func (c *RoleController) SetUserRole(ctx *fiber.Ctx) error {
+	request := &dto.SetUserRoleRequest{Nickname: ctx.Params("nickname")}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+
+	response, err := c.registry.RoleService.SetUserRole(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *RoleController) GetForumModerators(ctx *fiber.Ctx) error {
+	request := &dto.GetForumModeratorsRequest{Slug: ctx.Params("slug")}
+
+	response, err := c.registry.RoleService.GetForumModerators(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *RoleController) UpdateForumModerators(ctx *fiber.Ctx) error {
+	request := &dto.UpdateForumModeratorsRequest{Slug: ctx.Params("slug")}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+
+	response, err := c.registry.RoleService.UpdateForumModerators(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func NewRoleController(log *customtypes.Logger, registry *service.Registry) *RoleController {
+	return &RoleController{log: log, registry: registry}
+}
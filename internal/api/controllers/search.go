@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	service "github.com/senago/technopark-dbms/internal/services"
+)
+
+type SearchController struct {
+	log      *customtypes.Logger
+	registry *service.Registry
+	cursors  *CursorCodec
+}
+
+func (c *SearchController) Search(ctx *fiber.Ctx) error {
+	limit, _ := strconv.ParseInt(ctx.Query("limit", "20"), 10, 64)
+	cursor, err := c.cursors.queryCursor(ctx)
+	if err != nil {
+		return err
+	}
+	request := &dto.SearchRequest{Query: ctx.Query("q"), Forum: ctx.Query("forum"), Author: ctx.Query("author"), Type: ctx.Query("type"), Limit: limit, Cursor: cursor}
+
+	response, err := c.registry.SearchService.Search(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	if err := c.cursors.setLinks(ctx, response); err != nil {
+		return err
+	}
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func NewSearchController(log *customtypes.Logger, registry *service.Registry, cursors *CursorCodec) *SearchController {
+	return &SearchController{log: log, registry: registry, cursors: cursors}
+}
@@ -1,21 +1,22 @@
 package controllers
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/db"
+	service "github.com/senago/technopark-dbms/internal/services"
 )
 
 type ServiceController struct {
-	log *customtypes.Logger
-	db  *db.Repository
+	log      *customtypes.Logger
+	db       *db.Repository
+	registry *service.Registry
 }
 
 func (c *ServiceController) Status(ctx *fiber.Ctx) error {
-	response, err := c.db.ServiceRepository.Status(context.Background())
+	response, err := c.db.ServiceRepository.Status(ctx.UserContext())
 	if err != nil {
 		return err
 	}
@@ -23,13 +24,16 @@ func (c *ServiceController) Status(ctx *fiber.Ctx) error {
 }
 
 func (c *ServiceController) Delete(ctx *fiber.Ctx) error {
-	err := c.db.ServiceRepository.Delete(context.Background())
+	if err := c.registry.RoleService.AuthorizeClear(ctx.UserContext()); err != nil {
+		return err
+	}
+	err := c.db.ServiceRepository.Delete(ctx.UserContext())
 	if err != nil {
 		return err
 	}
 	return ctx.SendStatus(http.StatusOK)
 }
 
-func NewServiceController(log *customtypes.Logger, db *db.Repository) *ServiceController {
-	return &ServiceController{log: log, db: db}
+func NewServiceController(log *customtypes.Logger, db *db.Repository, registry *service.Registry) *ServiceController {
+	return &ServiceController{log: log, db: db, registry: registry}
 }
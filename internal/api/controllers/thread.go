@@ -1,8 +1,6 @@
 package controllers
 
 import (
-	"context"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/model/dto"
@@ -16,11 +14,11 @@ type ForumThreadController struct {
 
 func (c *ForumThreadController) CreateForumThread(ctx *fiber.Ctx) error {
 	request := &dto.CreateForumThreadRequest{Forum: ctx.Params("slug")}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
-	response, err := c.registry.ForumThreadService.CreateForumThread(context.Background(), request)
+	response, err := c.registry.ForumThreadService.CreateForumThread(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -30,12 +28,12 @@ func (c *ForumThreadController) CreateForumThread(ctx *fiber.Ctx) error {
 
 func (c *ForumThreadController) UpdateVote(ctx *fiber.Ctx) error {
 	request := &dto.UpdateVoteRequest{}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
 	slugOrID := ctx.Params("slug_or_id")
-	response, err := c.registry.ForumThreadService.UpdateVote(context.Background(), slugOrID, request)
+	response, err := c.registry.ForumThreadService.UpdateVote(ctx.UserContext(), slugOrID, request)
 	if err != nil {
 		return err
 	}
@@ -46,7 +44,7 @@ func (c *ForumThreadController) UpdateVote(ctx *fiber.Ctx) error {
 func (c *ForumThreadController) GetForumThreadDetails(ctx *fiber.Ctx) error {
 	slugOrID := ctx.Params("slug_or_id")
 
-	response, err := c.registry.ForumThreadService.GetThreadDetails(context.Background(), slugOrID)
+	response, err := c.registry.ForumThreadService.GetThreadDetails(ctx.UserContext(), slugOrID)
 	if err != nil {
 		return err
 	}
@@ -56,12 +54,57 @@ func (c *ForumThreadController) GetForumThreadDetails(ctx *fiber.Ctx) error {
 
 func (c *ForumThreadController) UpdateForumThread(ctx *fiber.Ctx) error {
 	request := &dto.UpdateForumThreadRequest{}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+	slugOrID := ctx.Params("slug_or_id")
+
+	response, err := c.registry.ForumThreadService.UpdateForumThread(ctx.UserContext(), slugOrID, request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumThreadController) ModerateThread(ctx *fiber.Ctx) error {
+	request := &dto.ModerateThreadRequest{}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+	slugOrID := ctx.Params("slug_or_id")
+
+	response, err := c.registry.ForumThreadService.ModerateThread(ctx.UserContext(), slugOrID, request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumThreadController) MoveThread(ctx *fiber.Ctx) error {
+	request := &dto.MoveThreadRequest{}
+	if err := parseBody(ctx, request); err != nil {
+		return err
+	}
+	slugOrID := ctx.Params("slug_or_id")
+
+	response, err := c.registry.ForumThreadService.MoveThread(ctx.UserContext(), slugOrID, request)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(response.Code).JSON(response.Data)
+}
+
+func (c *ForumThreadController) MergeThread(ctx *fiber.Ctx) error {
+	request := &dto.MergeThreadRequest{}
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 	slugOrID := ctx.Params("slug_or_id")
 
-	response, err := c.registry.ForumThreadService.UpdateForumThread(context.Background(), slugOrID, request)
+	response, err := c.registry.ForumThreadService.MergeThread(ctx.UserContext(), slugOrID, request)
 	if err != nil {
 		return err
 	}
@@ -1,8 +1,6 @@
 package controllers
 
 import (
-	"context"
-
 	"github.com/gofiber/fiber/v2"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/model/dto"
@@ -16,11 +14,11 @@ type UserController struct {
 
 func (c *UserController) CreateUser(ctx *fiber.Ctx) error {
 	request := &dto.CreateUserRequest{Nickname: ctx.Params("nickname")}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
-	response, err := c.registry.UserService.CreateUser(context.Background(), request)
+	response, err := c.registry.UserService.CreateUser(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -31,7 +29,7 @@ func (c *UserController) CreateUser(ctx *fiber.Ctx) error {
 func (c *UserController) GetUserProfile(ctx *fiber.Ctx) error {
 	request := &dto.GetUserProfileRequest{Nickname: ctx.Params("nickname")}
 
-	response, err := c.registry.UserService.GetUserProfile(context.Background(), request)
+	response, err := c.registry.UserService.GetUserProfile(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -41,11 +39,11 @@ func (c *UserController) GetUserProfile(ctx *fiber.Ctx) error {
 
 func (c *UserController) UpdateUserProfile(ctx *fiber.Ctx) error {
 	request := &dto.UpdateUserProfileRequest{Nickname: ctx.Params("nickname")}
-	if err := ctx.BodyParser(request); err != nil {
+	if err := parseBody(ctx, request); err != nil {
 		return err
 	}
 
-	response, err := c.registry.UserService.UpdateUserProfile(context.Background(), request)
+	response, err := c.registry.UserService.UpdateUserProfile(ctx.UserContext(), request)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type clientGoneKey struct{}
+
+// watchDisconnect returns a context that is cancelled when the client closes conn, found out by waiting for
+// the connection to become readable and peeking at it, as nothing else reads from it while a request is handled.
+// stop ends the watch and has to be called before the handler returns, fasthttp reads the next request after that.
+// Connections that can not be peeked at, such as those of tests, are not watched.
+func watchDisconnect(parent context.Context, conn net.Conn) (ctx context.Context, stop func()) {
+	sysConn, ok := conn.(syscall.Conn)
+	if !ok || !canPeek {
+		return parent, func() {}
+	}
+	raw, err := sysConn.SyscallConn()
+	if err != nil {
+		return parent, func() {}
+	}
+
+	gone := new(int32)
+	ctx, cancel := context.WithCancel(context.WithValue(parent, clientGoneKey{}, gone))
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		closed := false
+		// A deadline in the past makes Read give up waiting, anything else ends the wait with an answer.
+		err := raw.Read(func(fd uintptr) bool {
+			var ready bool
+			closed, ready = peekClosed(fd)
+			return ready
+		})
+		if err == nil && closed {
+			atomic.StoreInt32(gone, 1)
+			cancel()
+		}
+	}()
+
+	return ctx, func() {
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+		<-watching
+		// fasthttp sets the deadlines it is configured with before reading the next request.
+		_ = conn.SetReadDeadline(time.Time{})
+		cancel()
+	}
+}
+
+// clientGone reports whether the context was cancelled because the client went away.
+func clientGone(ctx context.Context) bool {
+	gone, ok := ctx.Value(clientGoneKey{}).(*int32)
+	return ok && atomic.LoadInt32(gone) == 1
+}
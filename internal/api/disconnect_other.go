@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package api
+
+const canPeek = false
+
+func peekClosed(uintptr) (closed, ready bool) {
+	return false, true
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return listener.Addr().String()
+}
+
+func TestWithRequestContextCancelsWhenClientLeaves(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(withRequestContext)
+	app.Get("/wait", func(ctx *fiber.Ctx) error {
+		select {
+		case <-ctx.UserContext().Done():
+			cancelled <- clientGone(ctx.UserContext())
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+		return nil
+	})
+	addr := serve(t, app)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("GET /wait HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case gone := <-cancelled:
+		if !gone {
+			t.Fatal("the request was not cancelled because the client left")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler did not finish")
+	}
+}
+
+func TestWithRequestContextKeepsConnectionsAlive(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(withRequestContext)
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		if err := ctx.UserContext().Err(); err != nil {
+			return err
+		}
+		return ctx.SendString("ok")
+	})
+	addr := serve(t, app)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, response.StatusCode)
+		}
+		// Give the connection time to sit idle between requests, as it would with a watch left behind.
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package api
+
+import "syscall"
+
+const canPeek = true
+
+// peekClosed looks at the socket without taking anything from it. It is ready once the socket has data,
+// which is the next request of a pipelining client, or has been closed by the client.
+func peekClosed(fd uintptr) (closed, ready bool) {
+	var b [1]byte
+	n, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return false, false
+	}
+	return err != nil || n == 0, true
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+// statusClientClosedRequest is the status nginx logs for requests the client gave up on.
+const statusClientClosedRequest = 499
+
+// pgErrorCodes maps SQLSTATE codes that are caused by the request rather than by the service to http status codes.
+var pgErrorCodes = map[string]int{
+	"23505": http.StatusConflict,           // unique_violation
+	"23503": http.StatusNotFound,           // foreign_key_violation
+	"23502": http.StatusBadRequest,         // not_null_violation
+	"23514": http.StatusBadRequest,         // check_violation
+	"22001": http.StatusBadRequest,         // string_data_right_truncation
+	"22003": http.StatusBadRequest,         // numeric_value_out_of_range
+	"22007": http.StatusBadRequest,         // invalid_datetime_format
+	"22008": http.StatusBadRequest,         // datetime_field_overflow
+	"22P02": http.StatusBadRequest,         // invalid_text_representation
+	"40001": http.StatusServiceUnavailable, // serialization_failure
+	"40P01": http.StatusServiceUnavailable, // deadlock_detected
+	"53300": http.StatusServiceUnavailable, // too_many_connections
+	"57014": http.StatusGatewayTimeout,     // query_canceled
+}
+
+// newErrorHandler renders every error returned by a handler as a JSON dto.ErrorResponse.
+// Errors that are not attributable to the request are logged and their details hidden.
+func newErrorHandler(log *customtypes.Logger) fiber.ErrorHandler {
+	return func(ctx *fiber.Ctx, err error) error {
+		code, message := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+
+		var codedErr *constants.CodedError
+		var pgErr *pgconn.PgError
+		var fiberErr *fiber.Error
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			code, message = http.StatusGatewayTimeout, "Request timed out"
+		case errors.Is(err, context.Canceled) && clientGone(ctx.UserContext()):
+			// Nobody is there to get the response, the status is for the metrics and traces.
+			code, message = statusClientClosedRequest, "Client closed request"
+		case errors.Is(err, context.Canceled):
+			code, message = http.StatusServiceUnavailable, "Request cancelled"
+		case errors.As(err, &codedErr):
+			code, message = codedErr.Code(), codedErr.Error()
+		case errors.As(err, &pgErr):
+			if pgCode, ok := pgErrorCodes[pgErr.Code]; ok {
+				code, message = pgCode, pgErr.Message
+			}
+		case errors.As(err, &fiberErr):
+			code, message = fiberErr.Code, fiberErr.Message
+		}
+
+		if code >= http.StatusInternalServerError {
+			log.Errorw("request failed", "method", ctx.Method(), "path", ctx.Path(), "status", code, "error", err)
+		}
+
+		return ctx.Status(code).JSON(dto.ErrorResponse{Message: message})
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	// IdempotencyKeyHeader carries the key a client retries a mutating request with.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from an earlier request with the same key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// idempotencyPollInterval is how often a request waits to see whether the one holding its key is done.
+	idempotencyPollInterval = 50 * time.Millisecond
+)
+
+// Idempotency makes mutating requests sent with an Idempotency-Key header safe to retry. The response to the first
+// request is kept for TTL and replayed to the retries, keys are scoped to the principal making the request.
+// Retries arriving while the first request is in flight wait for it for up to Wait, then get 409 Conflict.
+// The key is held for the first request for Lease, in case the instance serving it goes away. Logins and API key
+// creation are not covered, their responses are credentials.
+type Idempotency struct {
+	TTL   time.Duration
+	Wait  time.Duration
+	Lease time.Duration
+	// JanitorInterval is how often expired keys are deleted.
+	JanitorInterval time.Duration
+}
+
+// middleware replays, holds off or serves and records requests sent with an idempotency key. Responses are
+// rendered here to be recorded, except for server errors and 429 Too Many Requests, which release the key
+// so that the request can be retried for real.
+func (i *Idempotency) middleware(log *customtypes.Logger, repo db.IdempotencyRepository) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		key := ctx.Get(IdempotencyKeyHeader)
+		if key == "" || ctx.Method() == fiber.MethodGet || ctx.Method() == fiber.MethodHead {
+			return ctx.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return constants.NewCodedError("Idempotency key is too long", http.StatusBadRequest)
+		}
+
+		userCtx := ctx.UserContext()
+		kind, id := auth.Principal(userCtx, ctx.IP())
+		sum := sha256.Sum256([]byte(ctx.Method() + " " + ctx.OriginalURL() + "\n" + string(ctx.Body())))
+		record := &core.IdempotencyRecord{Key: kind + ":" + id + ":" + key, Fingerprint: hex.EncodeToString(sum[:])}
+
+		deadline := time.Now().Add(i.Wait)
+		for {
+			record.Expires = time.Now().Add(i.Lease)
+			existing, err := repo.ReserveIdempotencyKey(userCtx, record)
+			// A key released or expired under the reservation is waited for like one in flight, the next try takes it.
+			if err != nil && !errors.Is(err, constants.ErrDBNotFound) {
+				return err
+			}
+			if err == nil && existing == nil {
+				break
+			}
+
+			if existing != nil && existing.Fingerprint != record.Fingerprint {
+				return constants.NewCodedError("Idempotency key was used for a different request", http.StatusUnprocessableEntity)
+			}
+			if existing != nil && existing.Status != 0 {
+				ctx.Set(IdempotentReplayedHeader, "true")
+				if existing.ContentType != "" {
+					ctx.Set(fiber.HeaderContentType, existing.ContentType)
+				}
+				return ctx.Status(existing.Status).Send(existing.Body)
+			}
+			if !time.Now().Before(deadline) {
+				return constants.NewCodedError("A request with the same idempotency key is in progress", http.StatusConflict)
+			}
+
+			select {
+			case <-userCtx.Done():
+				return userCtx.Err()
+			case <-time.After(idempotencyPollInterval):
+			}
+		}
+
+		if err := ctx.Next(); err != nil {
+			if err := ctx.App().Config().ErrorHandler(ctx, err); err != nil {
+				_ = ctx.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// The request context may be gone by now, while the key must not stay reserved for the whole lease.
+		storeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		status := ctx.Response().StatusCode()
+		var err error
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			err = repo.ReleaseIdempotencyKey(storeCtx, record.Key)
+		} else {
+			contentType := string(ctx.Response().Header.ContentType())
+			err = repo.CompleteIdempotencyKey(storeCtx, record.Key, status, contentType, ctx.Response().Body(), time.Now().Add(i.TTL))
+		}
+		if err != nil {
+			// The request has been served either way, a retry gets to run it again.
+			log.Errorw("failed to record the response to an idempotent request", "key", record.Key, "error", err)
+		}
+		return nil
+	}
+}
+
+// janitor deletes expired keys every JanitorInterval until ctx is done, or never without an interval.
+func (i *Idempotency) janitor(ctx context.Context, log *customtypes.Logger, repo db.IdempotencyRepository) {
+	if i.JanitorInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(i.JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+				log.Warnw("failed to delete expired idempotency keys", "error", err)
+			} else if deleted > 0 {
+				log.Debugw("deleted expired idempotency keys", "count", deleted)
+			}
+		}
+	}
+}
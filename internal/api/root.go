@@ -2,16 +2,41 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
 
 	"github.com/bytedance/sonic"
 	"github.com/gofiber/fiber/v2"
 	"github.com/senago/technopark-dbms/internal/api/controllers"
 	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/metrics"
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+	service "github.com/senago/technopark-dbms/internal/services"
+	"github.com/senago/technopark-dbms/internal/tracing"
 )
 
+type Config struct {
+	Timeouts Timeouts
+	// CursorSecret signs pagination cursors. When empty a random one is used,
+	// so cursors do not survive restarts and are not shared between instances.
+	CursorSecret string
+	// AdminToken grants administrative access to requests sending it in the X-Admin-Token header.
+	// Administrative operations are disabled when it is empty.
+	AdminToken string
+	Services   service.Config
+	Metrics    *metrics.Metrics
+	// RateLimiter limits requests by the group given to their route: auth, post, vote or read.
+	RateLimiter *ratelimit.Limiter
+	Idempotency Idempotency
+}
+
 type APIService struct {
 	log    *customtypes.Logger
 	router *fiber.App
+	// stopBackground stops the deletion of expired idempotency keys and refilled rate limit buckets
+	// and ends the streams of events.
+	stopBackground context.CancelFunc
+	events         *controllers.EventsController
 }
 
 func (svc *APIService) Serve(addr string) {
@@ -19,44 +44,107 @@ func (svc *APIService) Serve(addr string) {
 }
 
 func (svc *APIService) Shutdown(ctx context.Context) error {
-	return svc.router.Shutdown()
+	svc.stopBackground()
+	if err := svc.router.Shutdown(); err != nil {
+		return err
+	}
+	return svc.events.DrainGateways(ctx)
 }
 
-func NewAPIService(log *customtypes.Logger, dbConn *customtypes.DBConn) (*APIService, error) {
+func NewAPIService(log *customtypes.Logger, repository *db.Repository, config *Config) (*APIService, error) {
 	svc := &APIService{
 		log: log,
 		router: fiber.New(fiber.Config{
-			JSONEncoder: sonic.Marshal,
-			JSONDecoder: sonic.Unmarshal,
+			JSONEncoder:  sonic.Marshal,
+			JSONDecoder:  sonic.Unmarshal,
+			ErrorHandler: newErrorHandler(log),
 		}),
 	}
 
-	controllersRegistry := controllers.NewRegistry(log, dbConn)
+	cursorKey := []byte(config.CursorSecret)
+	if len(cursorKey) == 0 {
+		log.Warn("service.cursor_secret is not set, using a random one")
+		cursorKey = make([]byte, 32)
+		if _, err := rand.Read(cursorKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Services.TokenSecret) == 0 {
+		log.Warn("service.auth.token_secret is not set, using a random one")
+		config.Services.TokenSecret = make([]byte, 32)
+		if _, err := rand.Read(config.Services.TokenSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	controllersRegistry := controllers.NewRegistry(log, repository, controllers.NewCursorCodec(cursorKey), &config.Services)
+	timeout := config.Timeouts.withTimeout
+	limit := config.RateLimiter.Middleware
+
+	svc.router.Use(withRequestContext, config.Metrics.Middleware(), tracing.Middleware(), controllers.AdminTokens(config.AdminToken))
+	svc.router.Get("/metrics", config.Metrics.Handler())
+
+	api := svc.router.Group("/api", controllersRegistry.AuthController.Authenticate)
+
+	// The responses of these carry credentials, which idempotency would keep in clear, so they are routed before it.
+	api.Post("/auth/login", timeout("auth_login"), limit("auth"), controllersRegistry.AuthController.Login)
+	api.Post("/user/:nickname/keys", timeout("user_keys_create"), limit("auth"), controllersRegistry.AuthController.CreateAPIKey)
+
+	api.Use(config.Idempotency.middleware(log, repository.IdempotencyRepository))
+
+	api.Post("/auth/logout", timeout("auth_logout"), controllersRegistry.AuthController.Logout)
+
+	api.Post("/user/:nickname/create", timeout("user_create"), limit("auth"), controllersRegistry.UserController.CreateUser)
+	api.Get("/user/:nickname/profile", timeout("user_profile"), limit("read"), controllersRegistry.UserController.GetUserProfile)
+	api.Post("/user/:nickname/profile", timeout("user_update"), limit("post"), controllersRegistry.UserController.UpdateUserProfile)
+	api.Post("/user/:nickname/role", timeout("user_role"), controllersRegistry.RoleController.SetUserRole)
+	api.Get("/user/:nickname/keys", timeout("user_keys"), limit("read"), controllersRegistry.AuthController.GetAPIKeys)
+	api.Delete("/user/:nickname/keys/:id", timeout("user_keys_revoke"), controllersRegistry.AuthController.RevokeAPIKey)
+
+	api.Get("/forums", timeout("forums"), limit("read"), controllersRegistry.ForumController.GetForumTree)
+	api.Post("/forum/create", timeout("forum_create"), limit("post"), controllersRegistry.ForumController.CreateForum)
+	api.Get("/forum/:slug/details", timeout("forum_details"), limit("read"), controllersRegistry.ForumController.GetForumBySlug)
+	api.Get("/forum/:slug/threads", timeout("forum_threads"), limit("read"), controllersRegistry.ForumController.GetForumThreads)
+	api.Get("/forum/:slug/users", timeout("forum_users"), limit("read"), controllersRegistry.ForumController.GetForumUsers)
+	api.Get("/forum/:slug/children", timeout("forum_children"), limit("read"), controllersRegistry.ForumController.GetForumChildren)
+	api.Post("/forum/:slug/details", timeout("forum_update"), controllersRegistry.ForumController.UpdateForum)
+	api.Delete("/forum/:slug", timeout("forum_delete"), controllersRegistry.ForumController.DeleteForum)
+	api.Get("/forum/:slug/moderators", timeout("forum_moderators"), limit("read"), controllersRegistry.RoleController.GetForumModerators)
+	api.Post("/forum/:slug/moderators", timeout("forum_moderators_update"), controllersRegistry.RoleController.UpdateForumModerators)
 
-	api := svc.router.Group("/api")
+	api.Post("/forum/:slug/create", timeout("thread_create"), limit("post"), controllersRegistry.ForumThreadController.CreateForumThread)
 
-	api.Post("/user/:nickname/create", controllersRegistry.UserController.CreateUser)
-	api.Get("/user/:nickname/profile", controllersRegistry.UserController.GetUserProfile)
-	api.Post("/user/:nickname/profile", controllersRegistry.UserController.UpdateUserProfile)
+	api.Post("/thread/:slug_or_id/create", timeout("posts_create"), limit("post"), controllersRegistry.PostsController.CreatePosts)
+	api.Post("/thread/:slug_or_id/vote", timeout("thread_vote"), limit("vote"), controllersRegistry.ForumThreadController.UpdateVote)
+	api.Get("/thread/:slug_or_id/details", timeout("thread_details"), limit("read"), controllersRegistry.ForumThreadController.GetForumThreadDetails)
+	api.Get("/thread/:slug_or_id/posts", timeout("posts"), limit("read"), controllersRegistry.PostsController.GetPosts)
+	api.Get("/thread/:slug_or_id/stream", timeout("thread_stream"), limit("read"), controllersRegistry.EventsController.StreamThread)
+	api.Post("/thread/:slug_or_id/details", timeout("thread_update"), limit("post"), controllersRegistry.ForumThreadController.UpdateForumThread)
+	api.Post("/thread/:slug_or_id/moderate", timeout("thread_moderate"), controllersRegistry.ForumThreadController.ModerateThread)
+	api.Post("/thread/:slug_or_id/move", timeout("thread_move"), controllersRegistry.ForumThreadController.MoveThread)
+	api.Post("/thread/:slug_or_id/merge", timeout("thread_merge"), controllersRegistry.ForumThreadController.MergeThread)
 
-	api.Post("/forum/create", controllersRegistry.ForumController.CreateForum)
-	api.Get("/forum/:slug/details", controllersRegistry.ForumController.GetForumBySlug)
-	api.Get("/forum/:slug/threads", controllersRegistry.ForumController.GetForumThreads)
-	api.Get("/forum/:slug/users", controllersRegistry.ForumController.GetForumUsers)
+	api.Get("/post/:id/details", timeout("post_details"), limit("read"), controllersRegistry.PostsController.GetPostDetails)
+	api.Post("/post/:id/details", timeout("post_update"), limit("post"), controllersRegistry.PostsController.UpdatePost)
+	api.Get("/post/:id/revisions", timeout("post_revisions"), limit("read"), controllersRegistry.PostsController.GetPostRevisions)
+	api.Get("/post/:id/revisions/:n/diff", timeout("post_revision_diff"), limit("read"), controllersRegistry.PostsController.GetPostRevisionDiff)
+	api.Post("/post/:id/split", timeout("post_split"), controllersRegistry.PostsController.SplitPost)
+	api.Delete("/post/:id", timeout("post_delete"), controllersRegistry.PostsController.DeletePost)
 
-	api.Post("/forum/:slug/create", controllersRegistry.ForumThreadController.CreateForumThread)
+	api.Get("/search", timeout("search"), limit("read"), controllersRegistry.SearchController.Search)
 
-	api.Post("/thread/:slug_or_id/create", controllersRegistry.PostsController.CreatePosts)
-	api.Post("/thread/:slug_or_id/vote", controllersRegistry.ForumThreadController.UpdateVote)
-	api.Get("/thread/:slug_or_id/details", controllersRegistry.ForumThreadController.GetForumThreadDetails)
-	api.Get("/thread/:slug_or_id/posts", controllersRegistry.PostsController.GetPosts)
-	api.Post("/thread/:slug_or_id/details", controllersRegistry.ForumThreadController.UpdateForumThread)
+	api.Get("/ws", timeout("ws"), limit("read"), controllersRegistry.EventsController.Gateway)
 
-	api.Get("/post/:id/details", controllersRegistry.PostsController.GetPostDetails)
-	api.Post("/post/:id/details", controllersRegistry.PostsController.UpdatePost)
+	api.Get("/service/status", timeout("service_status"), limit("read"), controllersRegistry.ServiceController.Status)
+	api.Post("/service/clear", timeout("service_clear"), controllersRegistry.ServiceController.Delete)
 
-	api.Get("/service/status", controllersRegistry.ServiceController.Status)
-	api.Post("/service/clear", controllersRegistry.ServiceController.Delete)
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	go config.Idempotency.janitor(backgroundCtx, log, repository.IdempotencyRepository)
+	go config.RateLimiter.Janitor(backgroundCtx)
+	go controllersRegistry.Services.EventsService.Run(backgroundCtx)
+	svc.stopBackground = stopBackground
+	svc.events = controllersRegistry.EventsController
 
 	return svc, nil
 }
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Timeouts holds the deadlines applied to request contexts. Routes are looked up by the name they are
+// registered with, a "<route>_<sort>" entry takes precedence for requests with that sort query parameter,
+// e.g. posts_tree for GET /thread/:slug_or_id/posts?sort=tree. Routes without an entry get Default.
+type Timeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+func (t *Timeouts) lookup(ctx *fiber.Ctx, route string) time.Duration {
+	if sort := ctx.Query("sort"); sort != "" {
+		if timeout, ok := t.Routes[route+"_"+sort]; ok {
+			return timeout
+		}
+	}
+	if timeout, ok := t.Routes[route]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// withTimeout bounds the request's user context by the route's timeout. The user context comes from withRequestContext,
+// so in-flight requests are also cancelled when the server shuts down or the client goes away.
+func (t *Timeouts) withTimeout(route string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userCtx := ctx.UserContext()
+		var cancel context.CancelFunc
+		if timeout := t.lookup(ctx, route); timeout > 0 {
+			userCtx, cancel = context.WithTimeout(userCtx, timeout)
+		} else {
+			userCtx, cancel = context.WithCancel(userCtx)
+		}
+		defer cancel()
+
+		ctx.SetUserContext(userCtx)
+		if err := ctx.Next(); err != nil {
+			// Whatever the error looks like after passing through pgx, a done context means
+			// the request ran out of time, the client went away or the server is shutting down.
+			if ctxErr := userCtx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+				return fmt.Errorf("%w: %v", ctxErr, err)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// withRequestContext bases the user context on the fasthttp request context, which is cancelled when the server
+// shuts down, and cancels it when the client closes the connection too. The middlewares after it derive theirs from it.
+func withRequestContext(ctx *fiber.Ctx) error {
+	userCtx, stop := watchDisconnect(ctx.Context(), ctx.Context().Conn())
+	defer stop()
+
+	ctx.SetUserContext(userCtx)
+	return ctx.Next()
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// APIKeyPrefix starts every API key, telling keys apart from session tokens.
+	APIKeyPrefix = "tpk_"
+	// apiKeyShown is the length of the start of a key that is kept in the clear to tell keys apart.
+	apiKeyShown = len(APIKeyPrefix) + 6
+)
+
+// NewAPIKey returns a random API key along with the start of it that may be shown later on.
+func NewAPIKey() (key, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:apiKeyShown], nil
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a session token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns the hash a key is stored and looked up by. Keys are random enough for a plain
+// SHA-256 to protect them, unlike passwords.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
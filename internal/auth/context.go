@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Identity is the authenticated user a request is made by.
+type Identity struct {
+	Nickname string
+	// Session is the ID of the session the request's token belongs to.
+	Session string
+	// Key is the ID of the API key the request was made with instead, which limits it to Scopes and,
+	// unless empty, Forums.
+	Key    int64
+	Scopes []string
+	Forums []string
+}
+
+// Grants reports whether the identity may act within scope in some forum at least.
+// Identities established by a session may do anything their user may.
+func (i *Identity) Grants(scope string) bool {
+	if i.Key == 0 {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether the identity may act within scope in the forum, or in every forum for an empty one.
+func (i *Identity) Permits(scope, forum string) bool {
+	if !i.Grants(scope) {
+		return false
+	}
+	if i.Key == 0 || len(i.Forums) == 0 {
+		return true
+	}
+	for _, f := range i.Forums {
+		if strings.EqualFold(f, forum) {
+			return true
+		}
+	}
+	return false
+}
+
+// Kinds of principals, which are who requests are made by as far as state kept per client is concerned.
+const (
+	PrincipalUser = "user"
+	PrincipalKey  = "key"
+	PrincipalIP   = "ip"
+)
+
+// Principal returns who a request is made by: the user by lowercased nickname, the API key it was made with
+// by ID, so that the keys of a user are told apart, or for anonymous requests the IP address it came from.
+func Principal(ctx context.Context, ip string) (kind, id string) {
+	identity, ok := FromContext(ctx)
+	switch {
+	case !ok:
+		return PrincipalIP, ip
+	case identity.Key != 0:
+		return PrincipalKey, strconv.FormatInt(identity.Key, 10)
+	default:
+		return PrincipalUser, strings.ToLower(identity.Nickname)
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity carried by ctx, if the request was authenticated.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+type adminKey struct{}
+
+// WithAdmin returns a copy of ctx marking the request as administrative, whoever it is made by.
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// IsAdmin reports whether ctx was marked administrative by WithAdmin.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
@@ -19,8 +19,17 @@ func (ce *CodedError) Code() int {
 	return ce.code
 }
 
+func (ce *CodedError) Unwrap() error {
+	return ce.err
+}
+
 func NewCodedError(msg string, code int) *CodedError {
-	return &CodedError{errors.New(msg), http.StatusNotFound}
+	return &CodedError{errors.New(msg), code}
+}
+
+// WrapCodedError attaches an http status code to an existing error, which stays reachable through errors.Is and errors.As.
+func WrapCodedError(err error, code int) *CodedError {
+	return &CodedError{err, code}
 }
 
 var (
@@ -29,4 +38,7 @@ var (
 
 	// User
 	ErrUserAlreadyExists = &CodedError{errors.New("User with given nickname already exists"), http.StatusConflict}
+
+	// Posts
+	ErrParentPostConflict = &CodedError{errors.New("Parent post was created in another thread"), http.StatusConflict}
 )
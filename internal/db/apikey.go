@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	apiKeyColumns = "id, nickname, name, prefix, hash, scopes, forums::text[], created, last_used, revoked_at"
+
+	queryCreateAPIKey = `INSERT INTO api_keys (nickname, name, prefix, hash, scopes, forums)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6::text[], '{}')::citext[]) RETURNING id, created;`
+
+	queryGetAPIKeys      = "SELECT " + apiKeyColumns + " FROM api_keys WHERE nickname = $1 ORDER BY id;"
+	queryGetAPIKeyByHash = "SELECT " + apiKeyColumns + " FROM api_keys WHERE hash = $1;"
+
+	queryTouchAPIKey  = "UPDATE api_keys SET last_used = $2 WHERE id = $1 AND (last_used IS NULL OR last_used < $3);"
+	queryRevokeAPIKey = "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1 AND nickname = $2 RETURNING " + apiKeyColumns + ";"
+)
+
+// apiKeyTouchInterval is how stale the last use of a key may get, so that busy keys are not written on every request.
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyRepository interface {
+	// CreateAPIKey stores a key, filling in its ID and creation time.
+	CreateAPIKey(ctx context.Context, key *core.APIKey) error
+	// GetAPIKeys lists the keys of a user, revoked ones included, in the order they were created.
+	GetAPIKeys(ctx context.Context, nickname string) ([]*core.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error)
+	// TouchAPIKey records the use of a key, unless it was recorded less than a minute before.
+	TouchAPIKey(ctx context.Context, id int64, used time.Time) error
+	// RevokeAPIKey revokes a key of the user, revoking it again keeps the original time.
+	RevokeAPIKey(ctx context.Context, nickname string, id int64) (*core.APIKey, error)
+}
+
+type apiKeyRepositoryImpl struct {
+	dbConn querier
+}
+
+func scanAPIKey(row pgx.Row) (*core.APIKey, error) {
+	k := &core.APIKey{}
+	err := row.Scan(&k.ID, &k.Nickname, &k.Name, &k.Prefix, &k.Hash, &k.Scopes, &k.Forums, &k.Created, &k.LastUsed, &k.RevokedAt)
+	return k, err
+}
+
+func (repo *apiKeyRepositoryImpl) CreateAPIKey(ctx context.Context, key *core.APIKey) error {
+	return repo.dbConn.QueryRow(ctx, queryCreateAPIKey, key.Nickname, key.Name, key.Prefix, key.Hash, key.Scopes, key.Forums).Scan(&key.ID, &key.Created)
+}
+
+func (repo *apiKeyRepositoryImpl) GetAPIKeys(ctx context.Context, nickname string) ([]*core.APIKey, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetAPIKeys, nickname)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*core.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (repo *apiKeyRepositoryImpl) GetAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error) {
+	key, err := scanAPIKey(repo.dbConn.QueryRow(ctx, queryGetAPIKeyByHash, hash))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return key, nil
+}
+
+func (repo *apiKeyRepositoryImpl) TouchAPIKey(ctx context.Context, id int64, used time.Time) error {
+	_, err := repo.dbConn.Exec(ctx, queryTouchAPIKey, id, used, used.Add(-apiKeyTouchInterval))
+	return err
+}
+
+func (repo *apiKeyRepositoryImpl) RevokeAPIKey(ctx context.Context, nickname string, id int64) (*core.APIKey, error) {
+	key, err := scanAPIKey(repo.dbConn.QueryRow(ctx, queryRevokeAPIKey, id, nickname))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return key, nil
+}
+
+func NewAPIKeyRepository(dbConn querier) *apiKeyRepositoryImpl {
+	return &apiKeyRepositoryImpl{dbConn: dbConn}
+}
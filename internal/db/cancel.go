@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+)
+
+// cancelRequestTimeout bounds the time spent delivering a cancel request to Postgres.
+const cancelRequestTimeout = time.Second
+
+// cancelingQuerier runs every statement on an explicitly acquired connection and, if the context is done
+// before the statement finishes, asks Postgres to cancel it. On its own pgx only drops the connection,
+// which leaves the backend running the query to completion.
+type cancelingQuerier struct {
+	dbConn *customtypes.DBConn
+}
+
+func (q *cancelingQuerier) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	conn, err := q.dbConn.Acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+	defer watchCancel(ctx, conn)()
+
+	return conn.Exec(ctx, sql, arguments...)
+}
+
+func (q *cancelingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := q.dbConn.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop := watchCancel(ctx, conn)
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		stop()
+		conn.Release()
+		return nil, err
+	}
+
+	return &cancelingRows{Rows: rows, release: func() {
+		stop()
+		conn.Release()
+	}}, nil
+}
+
+func (q *cancelingQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := q.dbConn.Acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	stop := watchCancel(ctx, conn)
+
+	return &cancelingRow{Row: conn.QueryRow(ctx, sql, args...), release: func() {
+		stop()
+		conn.Release()
+	}}
+}
+
+// watchCancel sends a cancel request for the statement running on conn once ctx is done.
+// The returned function stops watching and must be called before conn is released,
+// so that a late cancel request can not hit a statement of the connection's next user.
+func watchCancel(ctx context.Context, conn *pgxpool.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			cancelCtx, cancel := context.WithTimeout(context.Background(), cancelRequestTimeout)
+			defer cancel()
+			_ = conn.Conn().PgConn().CancelRequest(cancelCtx)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+type cancelingRows struct {
+	pgx.Rows
+	release func()
+	once    sync.Once
+}
+
+func (rows *cancelingRows) Close() {
+	rows.Rows.Close()
+	rows.once.Do(rows.release)
+}
+
+type cancelingRow struct {
+	pgx.Row
+	release func()
+}
+
+func (row *cancelingRow) Scan(dest ...any) error {
+	defer row.release()
+	return row.Row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (row errRow) Scan(dest ...any) error {
+	return row.err
+}
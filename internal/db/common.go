@@ -1,12 +1,35 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/senago/technopark-dbms/internal/constants"
 )
 
+// querier is the subset of methods shared by the connection pool and pgx.Tx,
+// so that the same repository code can run either standalone or inside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Keyset is the position of a row after which a keyset-paginated listing continues.
+// Which fields are meaningful depends on the listing's sort key.
+type Keyset struct {
+	Created  time.Time
+	Nickname string
+	ID       int64
+	Rank     float32
+	Kind     string
+	Pinned   bool
+	Path     []int64
+}
+
 func wrapErr(err error) error {
 	if errors.Is(err, pgx.ErrNoRows) {
 		return constants.ErrDBNotFound
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+
+	"github.com/bytedance/sonic"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+// eventsChannel is the channel the triggers of 0015_forum_events notify.
+const eventsChannel = "forum_events"
+
+type EventsRepository interface {
+	// ListenEvents calls handle with the events of all forums as their transactions commit,
+	// until ctx is done or the connection is lost. handle is called with one event at a time and must not block.
+	ListenEvents(ctx context.Context, handle func(*core.Event)) error
+}
+
+// eventsRepositoryImpl listens on a connection of its own, notifications are not delivered to transactions.
+type eventsRepositoryImpl struct {
+	dbConn *customtypes.DBConn
+}
+
+func (repo *eventsRepositoryImpl) ListenEvents(ctx context.Context, handle func(*core.Event)) error {
+	pooled, err := repo.dbConn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is taken out of the pool and closed rather than put back, it would go on receiving notifications.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel+";"); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		event := &core.Event{}
+		if err := sonic.UnmarshalString(notification.Payload, event); err != nil {
+			continue
+		}
+		handle(event)
+	}
+}
+
+func NewEventsRepository(dbConn *customtypes.DBConn) *eventsRepositoryImpl {
+	return &eventsRepositoryImpl{dbConn: dbConn}
+}
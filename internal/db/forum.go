@@ -2,45 +2,154 @@ package db
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/model/core"
 )
 
 const (
-	queryCreateForum = `INSERT INTO forums (title, "user", slug) VALUES ($1, $2, $3);`
+	queryCreateForum = `INSERT INTO forums (title, "user", slug, parent) VALUES ($1, $2, $3, NULLIF($4::citext, ''));`
 
-	queryGetForumBySlug = `SELECT title, "user", slug, posts, threads FROM forums WHERE slug = $1;`
+	forumColumns = `title, "user", slug, posts, threads, archived_at, COALESCE(parent, '')`
+
+	queryGetForumBySlug   = "SELECT " + forumColumns + " FROM forums WHERE slug = $1;"
+	queryGetForums        = "SELECT " + forumColumns + " FROM forums ORDER BY slug;"
+	queryGetForumChildren = "SELECT " + forumColumns + " FROM forums WHERE parent = $1 ORDER BY slug;"
+
+	// API keys refer to forums by slug without a foreign key, so a new slug is carried over to them here.
+	queryUpdateForum = `WITH renamed_keys AS (
+		UPDATE api_keys SET forums = array_replace(forums, $1::citext, $4::citext)
+		WHERE $1::citext = ANY (forums) AND EXISTS (SELECT 1 FROM forums WHERE slug = $1)
+	) UPDATE forums SET title = $2, "user" = $3, slug = $4 WHERE slug = $1 RETURNING ` + forumColumns + ";"
+
+	queryArchiveForum = "UPDATE forums SET archived_at = COALESCE(archived_at, now()) WHERE slug = $1 RETURNING " + forumColumns + ";"
+
+	queryPurgeForumVotes   = "DELETE FROM votes WHERE thread IN (SELECT id FROM threads WHERE forum = $1);"
+	queryPurgeForumPosts   = "DELETE FROM posts WHERE forum = $1;"
+	queryPurgeForumThreads = "DELETE FROM threads WHERE forum = $1;"
+	queryPurgeForumUsers   = "DELETE FROM forum_users WHERE forum = $1;"
+	queryPurgeForum        = "DELETE FROM forums WHERE slug = $1;"
+
+	queryGetForumUsersPage     = "SELECT nickname, fullname, about, email FROM forum_users WHERE forum = $1 AND nickname > $2 ORDER BY nickname LIMIT $3;"
+	queryGetForumUsersPageDesc = "SELECT nickname, fullname, about, email FROM forum_users WHERE forum = $1 AND nickname < $2 ORDER BY nickname DESC LIMIT $3;"
 )
 
 type ForumRepository interface {
 	CreateForum(ctx context.Context, forum *core.Forum) error
 
 	GetForumBySlug(ctx context.Context, slug string) (*core.Forum, error)
+	// GetForums lists every forum by slug, GetForumChildren only the direct sub-forums of one.
+	GetForums(ctx context.Context) ([]*core.Forum, error)
+	GetForumChildren(ctx context.Context, slug string) ([]*core.Forum, error)
+	// UpdateForum sets the title, owner and slug of a forum, a new slug is carried over to its threads, posts, users and API keys.
+	UpdateForum(ctx context.Context, slug string, forum *core.Forum) (*core.Forum, error)
+	// ArchiveForum makes a forum read-only, archiving it again keeps the original time.
+	ArchiveForum(ctx context.Context, slug string) (*core.Forum, error)
+	// PurgeForum removes a forum with its threads, posts, votes and users and returns the number of removed threads and posts.
+	// Its statements depend on each other, so it has to be run in a transaction.
+	PurgeForum(ctx context.Context, slug string) (threads int64, posts int64, err error)
 	GetForumUsers(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.User, error)
 	GetForumThreads(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.Thread, error)
+
+	GetForumUsersPage(ctx context.Context, slug string, limit int64, after *Keyset, desc bool) ([]*core.User, error)
+	// GetForumThreadsPage lists threads by created and id in the direction given by desc, always starting with the pinned ones.
+	// As the position of pinned threads does not depend on desc, the page's direction is given separately: back walks backwards.
+	GetForumThreadsPage(ctx context.Context, slug string, limit int64, after *Keyset, desc, back bool) ([]*core.Thread, error)
 }
 
 type forumRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *forumRepositoryImpl) CreateForum(ctx context.Context, forum *core.Forum) error {
-	_, err := repo.dbConn.Exec(ctx, queryCreateForum, &forum.Title, &forum.User, &forum.Slug)
+	_, err := repo.dbConn.Exec(ctx, queryCreateForum, &forum.Title, &forum.User, &forum.Slug, &forum.Parent)
 	return err
 }
 
 func (repo *forumRepositoryImpl) GetForumBySlug(ctx context.Context, slug string) (*core.Forum, error) {
-	forum := &core.Forum{}
-	err := repo.dbConn.QueryRow(ctx, queryGetForumBySlug, slug).Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
-	return forum, wrapErr(err)
+	forum, err := scanForum(repo.dbConn.QueryRow(ctx, queryGetForumBySlug, slug))
+	if err != nil {
+		return &core.Forum{}, wrapErr(err)
+	}
+	return forum, nil
+}
+
+func (repo *forumRepositoryImpl) GetForums(ctx context.Context) ([]*core.Forum, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetForums)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return queryForums(rows)
+}
+
+func (repo *forumRepositoryImpl) GetForumChildren(ctx context.Context, slug string) ([]*core.Forum, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetForumChildren, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return queryForums(rows)
+}
+
+func (repo *forumRepositoryImpl) UpdateForum(ctx context.Context, slug string, forum *core.Forum) (*core.Forum, error) {
+	f, err := scanForum(repo.dbConn.QueryRow(ctx, queryUpdateForum, slug, forum.Title, forum.User, forum.Slug))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return f, nil
+}
+
+func (repo *forumRepositoryImpl) ArchiveForum(ctx context.Context, slug string) (*core.Forum, error) {
+	f, err := scanForum(repo.dbConn.QueryRow(ctx, queryArchiveForum, slug))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return f, nil
+}
+
+func (repo *forumRepositoryImpl) PurgeForum(ctx context.Context, slug string) (int64, int64, error) {
+	if _, err := repo.dbConn.Exec(ctx, queryPurgeForumVotes, slug); err != nil {
+		return 0, 0, err
+	}
+	posts, err := repo.dbConn.Exec(ctx, queryPurgeForumPosts, slug)
+	if err != nil {
+		return 0, 0, err
+	}
+	threads, err := repo.dbConn.Exec(ctx, queryPurgeForumThreads, slug)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := repo.dbConn.Exec(ctx, queryPurgeForumUsers, slug); err != nil {
+		return 0, 0, err
+	}
+
+	forums, err := repo.dbConn.Exec(ctx, queryPurgeForum, slug)
+	if err != nil {
+		return 0, 0, err
+	}
+	if forums.RowsAffected() == 0 {
+		return 0, 0, constants.ErrDBNotFound
+	}
+
+	return threads.RowsAffected(), posts.RowsAffected(), nil
 }
 
 func (repo *forumRepositoryImpl) GetForumUsers(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.User, error) {
-	query := constructGetForumUsersQuery(limit, since, desc)
-	rows, err := repo.dbConn.Query(ctx, query, slug)
+	q := newSelectQuery("SELECT nickname, fullname, about, email FROM forum_users").where("forum = ?", slug)
+	if since != "" {
+		if desc {
+			q.where("nickname < ?", since)
+		} else {
+			q.where("nickname > ?", since)
+		}
+	}
+	query, args := q.orderBy(desc, "nickname").limit(limit).build()
+
+	rows, err := repo.dbConn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -55,74 +164,120 @@ func (repo *forumRepositoryImpl) GetForumUsers(ctx context.Context, slug string,
 		users = append(users, u)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 func (repo *forumRepositoryImpl) GetForumThreads(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.Thread, error) {
-	var rows pgx.Rows
-	var err error
+	q := newSelectQuery("SELECT "+threadColumns+" FROM threads").where("forum = ?", slug).where("deleted_at IS NULL")
+	if since != "" {
+		if desc {
+			q.where("created <= ?", since)
+		} else {
+			q.where("created >= ?", since)
+		}
+	}
+	q.orderBy(desc, "pinned DESC", "created")
+	if limit > 0 {
+		q.limit(limit)
+	}
+	query, args := q.build()
+
+	rows, err := repo.dbConn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	query := "SELECT t.id, t.title, t.author, t.forum, t.message, t.votes, t.slug, t.created FROM threads as t LEFT JOIN forums f ON t.forum = f.slug WHERE f.slug = $1 "
+	return queryThreads(rows)
+}
 
-	queryOrderBy := "ORDER BY t.created "
+func (repo *forumRepositoryImpl) GetForumUsersPage(ctx context.Context, slug string, limit int64, after *Keyset, desc bool) ([]*core.User, error) {
+	query := queryGetForumUsersPage
 	if desc {
-		queryOrderBy += "DESC "
+		query = queryGetForumUsersPageDesc
 	}
-	if limit > 0 {
-		queryOrderBy += fmt.Sprintf("LIMIT %d ", limit)
+
+	rows, err := repo.dbConn.Query(ctx, query, slug, after.Nickname, limit)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	if since != "" {
-		querySince := "AND t.created >= $2 "
-		if since != "" && desc {
-			querySince = "AND t.created <= $2 "
-		} else if since != "" && !desc {
-			querySince = "AND t.created >= $2 "
+	users := make([]*core.User, 0, limit)
+	for rows.Next() {
+		u := &core.User{}
+		if err := rows.Scan(&u.Nickname, &u.Fullname, &u.About, &u.Email); err != nil {
+			return nil, err
 		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
 
-		query += querySince + queryOrderBy
-		rows, err = repo.dbConn.Query(ctx, query, slug, since)
-	} else {
-		query += queryOrderBy
-		rows, err = repo.dbConn.Query(ctx, query, slug)
+func (repo *forumRepositoryImpl) GetForumThreadsPage(ctx context.Context, slug string, limit int64, after *Keyset, desc, back bool) ([]*core.Thread, error) {
+	scanDesc := desc != back
+	pinnedAfter, pinnedOrder := "pinned < ?", "pinned DESC"
+	if back {
+		pinnedAfter, pinnedOrder = "pinned > ?", "pinned ASC"
+	}
+	keyAfter := "(created, id) > (?, ?)"
+	if scanDesc {
+		keyAfter = "(created, id) < (?, ?)"
 	}
+
+	query, args := newSelectQuery("SELECT "+threadColumns+" FROM threads").
+		where("forum = ?", slug).
+		where("deleted_at IS NULL").
+		where("("+pinnedAfter+" OR (pinned = ? AND "+keyAfter+"))", after.Pinned, after.Pinned, after.Created, after.ID).
+		orderBy(scanDesc, pinnedOrder, "created", "id").
+		limit(limit).
+		build()
+
+	rows, err := repo.dbConn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	threads := make([]*core.Thread, 0, rows.CommandTag().RowsAffected())
+	return queryThreads(rows)
+}
+
+func queryThreads(rows pgx.Rows) ([]*core.Thread, error) {
+	threads := []*core.Thread{}
 	for rows.Next() {
-		t := &core.Thread{}
-		if err := rows.Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created); err != nil {
+		t, err := scanThread(rows)
+		if err != nil {
 			return nil, err
 		}
 		threads = append(threads, t)
 	}
 
-	return threads, nil
-}
-
-func NewForumRepository(dbConn *customtypes.DBConn) *forumRepositoryImpl {
-	return &forumRepositoryImpl{dbConn: dbConn}
+	return threads, rows.Err()
 }
 
-func constructGetForumUsersQuery(limit int64, since string, desc bool) string {
-	query := "SELECT u.nickname, u.fullname, u.about, u.email from forum_users u where u.forum = $1 "
-
-	if len(since) > 0 {
-		if desc {
-			query += fmt.Sprintf("and u.nickname < '%s' ", since)
-		} else {
-			query += fmt.Sprintf("and u.nickname > '%s' ", since)
+func queryForums(rows pgx.Rows) ([]*core.Forum, error) {
+	forums := []*core.Forum{}
+	for rows.Next() {
+		f, err := scanForum(rows)
+		if err != nil {
+			return nil, err
 		}
+		forums = append(forums, f)
 	}
 
-	query += "ORDER BY u.nickname "
-	if desc {
-		query += "DESC "
+	return forums, rows.Err()
+}
+
+// scanForum reads a row of forumColumns.
+func scanForum(row pgx.Row) (*core.Forum, error) {
+	f := &core.Forum{}
+	if err := row.Scan(&f.Title, &f.User, &f.Slug, &f.Posts, &f.Threads, &f.ArchivedAt, &f.Parent); err != nil {
+		return nil, err
 	}
-	query += fmt.Sprintf("LIMIT %d ", limit)
+	return f, nil
+}
 
-	return query
+func NewForumRepository(dbConn querier) *forumRepositoryImpl {
+	return &forumRepositoryImpl{dbConn: dbConn}
 }
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	// An expired record is taken over as if there was none, which is what lets abandoned reservations go.
+	queryReserveIdempotencyKey = `INSERT INTO idempotency_keys AS k (key, fingerprint, expires) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = '', body = NULL, created = now(), expires = EXCLUDED.expires
+		WHERE k.expires <= now()
+		RETURNING created;`
+	queryGetIdempotencyKey = `SELECT key, fingerprint, COALESCE(status, 0), content_type, body, created, expires
+		FROM idempotency_keys WHERE key = $1;`
+
+	queryCompleteIdempotencyKey       = "UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4, expires = $5 WHERE key = $1;"
+	queryReleaseIdempotencyKey        = "DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL;"
+	queryDeleteExpiredIdempotencyKeys = "DELETE FROM idempotency_keys WHERE expires <= now();"
+)
+
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey stores a record without a response unless there is a live one with the same key,
+	// which is returned instead. A reservation lasts until the Expires of the record. When the live record
+	// expires before it can be read, constants.ErrDBNotFound is returned and the reservation may be tried again.
+	ReserveIdempotencyKey(ctx context.Context, record *core.IdempotencyRecord) (*core.IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the response to a reserved key, to be replayed until expires.
+	CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte, expires time.Time) error
+	// ReleaseIdempotencyKey drops a reservation, so that the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+type idempotencyRepositoryImpl struct {
+	dbConn querier
+}
+
+func (repo *idempotencyRepositoryImpl) ReserveIdempotencyKey(ctx context.Context, record *core.IdempotencyRecord) (*core.IdempotencyRecord, error) {
+	err := repo.dbConn.QueryRow(ctx, queryReserveIdempotencyKey, record.Key, record.Fingerprint, record.Expires).Scan(&record.Created)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	existing := &core.IdempotencyRecord{}
+	err = repo.dbConn.QueryRow(ctx, queryGetIdempotencyKey, record.Key).Scan(
+		&existing.Key, &existing.Fingerprint, &existing.Status, &existing.ContentType, &existing.Body, &existing.Created, &existing.Expires)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, constants.ErrDBNotFound
+	}
+	return existing, err
+}
+
+func (repo *idempotencyRepositoryImpl) CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte, expires time.Time) error {
+	_, err := repo.dbConn.Exec(ctx, queryCompleteIdempotencyKey, key, status, contentType, body, expires)
+	return err
+}
+
+func (repo *idempotencyRepositoryImpl) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := repo.dbConn.Exec(ctx, queryReleaseIdempotencyKey, key)
+	return err
+}
+
+func (repo *idempotencyRepositoryImpl) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	tag, err := repo.dbConn.Exec(ctx, queryDeleteExpiredIdempotencyKeys)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func NewIdempotencyRepository(dbConn querier) *idempotencyRepositoryImpl {
+	return &idempotencyRepositoryImpl{dbConn: dbConn}
+}
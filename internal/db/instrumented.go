@@ -0,0 +1,588 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+)
+
+// QueryObserver is told about every completed repository method call of an instrumented Repository.
+type QueryObserver func(repository, method string, duration time.Duration, err error)
+
+// Instrument returns a Repository that reports the duration of every method call of r to observe,
+// including calls made through the repositories handed to WithTx callbacks.
+func Instrument(r *Repository, observe QueryObserver) *Repository {
+	return &Repository{
+		UserRepository:        &instrumentedUserRepository{next: r.UserRepository, observe: observe},
+		ForumRepository:       &instrumentedForumRepository{next: r.ForumRepository, observe: observe},
+		ForumThreadRepository: &instrumentedForumThreadRepository{next: r.ForumThreadRepository, observe: observe},
+		PostsRepository:       &instrumentedPostsRepository{next: r.PostsRepository, observe: observe},
+		VotesRepository:       &instrumentedVotesRepository{next: r.VotesRepository, observe: observe},
+		ServiceRepository:     &instrumentedServiceRepository{next: r.ServiceRepository, observe: observe},
+		SearchRepository:      &instrumentedSearchRepository{next: r.SearchRepository, observe: observe},
+		SessionRepository:     &instrumentedSessionRepository{next: r.SessionRepository, observe: observe},
+		RoleRepository:        &instrumentedRoleRepository{next: r.RoleRepository, observe: observe},
+		APIKeyRepository:      &instrumentedAPIKeyRepository{next: r.APIKeyRepository, observe: observe},
+		RateLimitRepository:   &instrumentedRateLimitRepository{next: r.RateLimitRepository, observe: observe},
+		IdempotencyRepository: &instrumentedIdempotencyRepository{next: r.IdempotencyRepository, observe: observe},
+		// Listening lasts as long as the caller wants, its duration says nothing about the database.
+		EventsRepository: r.EventsRepository,
+
+		runTx: func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+			return r.runTx(ctx, opts, func(tx *Repository) error { return fn(Instrument(tx, observe)) })
+		},
+	}
+}
+
+type instrumentedUserRepository struct {
+	next    UserRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedUserRepository) CreateUser(ctx context.Context, user *core.User) error {
+	start := time.Now()
+	err := repo.next.CreateUser(ctx, user)
+	repo.observe("UserRepository", "CreateUser", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedUserRepository) GetUserByEmail(ctx context.Context, email string) (*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetUserByEmail(ctx, email)
+	repo.observe("UserRepository", "GetUserByEmail", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedUserRepository) GetUserByNickname(ctx context.Context, nickname string) (*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetUserByNickname(ctx, nickname)
+	repo.observe("UserRepository", "GetUserByNickname", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedUserRepository) GetUsersByEmailOrNickname(ctx context.Context, email, nickname string) ([]*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetUsersByEmailOrNickname(ctx, email, nickname)
+	repo.observe("UserRepository", "GetUsersByEmailOrNickname", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedUserRepository) GetUsersByNicknames(ctx context.Context, nicknames []string) ([]*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetUsersByNicknames(ctx, nicknames)
+	repo.observe("UserRepository", "GetUsersByNicknames", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedUserRepository) UpdateUser(ctx context.Context, user *core.User) (*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.UpdateUser(ctx, user)
+	repo.observe("UserRepository", "UpdateUser", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedUserRepository) SetUserPassword(ctx context.Context, nickname string, hash string) error {
+	start := time.Now()
+	err := repo.next.SetUserPassword(ctx, nickname, hash)
+	repo.observe("UserRepository", "SetUserPassword", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedUserRepository) GetUserPasswordHash(ctx context.Context, nickname string) (string, string, error) {
+	start := time.Now()
+	storedNickname, hash, err := repo.next.GetUserPasswordHash(ctx, nickname)
+	repo.observe("UserRepository", "GetUserPasswordHash", time.Since(start), err)
+	return storedNickname, hash, err
+}
+
+type instrumentedForumRepository struct {
+	next    ForumRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedForumRepository) CreateForum(ctx context.Context, forum *core.Forum) error {
+	start := time.Now()
+	err := repo.next.CreateForum(ctx, forum)
+	repo.observe("ForumRepository", "CreateForum", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedForumRepository) GetForumBySlug(ctx context.Context, slug string) (*core.Forum, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumBySlug(ctx, slug)
+	repo.observe("ForumRepository", "GetForumBySlug", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) GetForums(ctx context.Context) ([]*core.Forum, error) {
+	start := time.Now()
+	res, err := repo.next.GetForums(ctx)
+	repo.observe("ForumRepository", "GetForums", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) GetForumChildren(ctx context.Context, slug string) ([]*core.Forum, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumChildren(ctx, slug)
+	repo.observe("ForumRepository", "GetForumChildren", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) UpdateForum(ctx context.Context, slug string, forum *core.Forum) (*core.Forum, error) {
+	start := time.Now()
+	res, err := repo.next.UpdateForum(ctx, slug, forum)
+	repo.observe("ForumRepository", "UpdateForum", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) ArchiveForum(ctx context.Context, slug string) (*core.Forum, error) {
+	start := time.Now()
+	res, err := repo.next.ArchiveForum(ctx, slug)
+	repo.observe("ForumRepository", "ArchiveForum", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) PurgeForum(ctx context.Context, slug string) (int64, int64, error) {
+	start := time.Now()
+	threads, posts, err := repo.next.PurgeForum(ctx, slug)
+	repo.observe("ForumRepository", "PurgeForum", time.Since(start), err)
+	return threads, posts, err
+}
+
+func (repo *instrumentedForumRepository) GetForumUsers(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumUsers(ctx, slug, limit, since, desc)
+	repo.observe("ForumRepository", "GetForumUsers", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) GetForumThreads(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumThreads(ctx, slug, limit, since, desc)
+	repo.observe("ForumRepository", "GetForumThreads", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) GetForumUsersPage(ctx context.Context, slug string, limit int64, after *Keyset, desc bool) ([]*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumUsersPage(ctx, slug, limit, after, desc)
+	repo.observe("ForumRepository", "GetForumUsersPage", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumRepository) GetForumThreadsPage(ctx context.Context, slug string, limit int64, after *Keyset, desc, back bool) ([]*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumThreadsPage(ctx, slug, limit, after, desc, back)
+	repo.observe("ForumRepository", "GetForumThreadsPage", time.Since(start), err)
+	return res, err
+}
+
+type instrumentedForumThreadRepository struct {
+	next    ForumThreadRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedForumThreadRepository) CreateForumThread(ctx context.Context, thread *core.Thread) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.CreateForumThread(ctx, thread)
+	repo.observe("ForumThreadRepository", "CreateForumThread", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) GetForumThreadByID(ctx context.Context, id int64) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumThreadByID(ctx, id)
+	repo.observe("ForumThreadRepository", "GetForumThreadByID", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) GetForumThreadBySlug(ctx context.Context, slug string) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumThreadBySlug(ctx, slug)
+	repo.observe("ForumThreadRepository", "GetForumThreadBySlug", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) UpdateForumThreadByID(ctx context.Context, id int64, title string, message string) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.UpdateForumThreadByID(ctx, id, title, message)
+	repo.observe("ForumThreadRepository", "UpdateForumThreadByID", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) ModerateForumThread(ctx context.Context, id int64, moderation *ThreadModeration) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.ModerateForumThread(ctx, id, moderation)
+	repo.observe("ForumThreadRepository", "ModerateForumThread", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) LockForumThreads(ctx context.Context, ids ...int64) error {
+	start := time.Now()
+	err := repo.next.LockForumThreads(ctx, ids...)
+	repo.observe("ForumThreadRepository", "LockForumThreads", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedForumThreadRepository) MoveForumThread(ctx context.Context, thread *core.Thread, forum string) (*core.Thread, error) {
+	start := time.Now()
+	res, err := repo.next.MoveForumThread(ctx, thread, forum)
+	repo.observe("ForumThreadRepository", "MoveForumThread", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedForumThreadRepository) MergeForumThread(ctx context.Context, from int64, into int64) error {
+	start := time.Now()
+	err := repo.next.MergeForumThread(ctx, from, into)
+	repo.observe("ForumThreadRepository", "MergeForumThread", time.Since(start), err)
+	return err
+}
+
+type instrumentedPostsRepository struct {
+	next    PostsRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedPostsRepository) CreatePosts(ctx context.Context, forum string, thread int64, posts []*dto.PostData) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.CreatePosts(ctx, forum, thread, posts)
+	repo.observe("PostsRepository", "CreatePosts", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) CheckParentPost(ctx context.Context, parent int) (int, error) {
+	start := time.Now()
+	res, err := repo.next.CheckParentPost(ctx, parent)
+	repo.observe("PostsRepository", "CheckParentPost", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsThreads(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsThreads(ctx, ids)
+	repo.observe("PostsRepository", "GetPostsThreads", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsFlat(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsFlat(ctx, id, since, desc, limit)
+	repo.observe("PostsRepository", "GetPostsFlat", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsTree(ctx, id, since, desc, limit)
+	repo.observe("PostsRepository", "GetPostsTree", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsParentTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsParentTree(ctx, id, since, desc, limit)
+	repo.observe("PostsRepository", "GetPostsParentTree", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostDetails(ctx context.Context, id int64, related string) (*dto.PostDetails, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostDetails(ctx, id, related)
+	repo.observe("PostsRepository", "GetPostDetails", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostByID(ctx context.Context, id int64) (*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostByID(ctx, id)
+	repo.observe("PostsRepository", "GetPostByID", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsFlatPage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsFlatPage(ctx, thread, limit, after, desc)
+	repo.observe("PostsRepository", "GetPostsFlatPage", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsTreePage(ctx, thread, limit, after, desc)
+	repo.observe("PostsRepository", "GetPostsTreePage", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostsParentTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostsParentTreePage(ctx, thread, limit, after, desc)
+	repo.observe("PostsRepository", "GetPostsParentTreePage", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) UpdatePost(ctx context.Context, id int64, message, editor, reason string) (*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.UpdatePost(ctx, id, message, editor, reason)
+	repo.observe("PostsRepository", "UpdatePost", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) GetPostRevisions(ctx context.Context, id int64) ([]*core.PostRevision, error) {
+	start := time.Now()
+	res, err := repo.next.GetPostRevisions(ctx, id)
+	repo.observe("PostsRepository", "GetPostRevisions", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) DeletePost(ctx context.Context, id int64) (*core.Post, error) {
+	start := time.Now()
+	res, err := repo.next.DeletePost(ctx, id)
+	repo.observe("PostsRepository", "DeletePost", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) MovePostTree(ctx context.Context, id int64, thread int64) (int64, error) {
+	start := time.Now()
+	res, err := repo.next.MovePostTree(ctx, id, thread)
+	repo.observe("PostsRepository", "MovePostTree", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedPostsRepository) DeletePostTree(ctx context.Context, id int64) (int64, error) {
+	start := time.Now()
+	res, err := repo.next.DeletePostTree(ctx, id)
+	repo.observe("PostsRepository", "DeletePostTree", time.Since(start), err)
+	return res, err
+}
+
+type instrumentedVotesRepository struct {
+	next    VotesRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedVotesRepository) CreateVote(ctx context.Context, vote *core.Vote) error {
+	start := time.Now()
+	err := repo.next.CreateVote(ctx, vote)
+	repo.observe("VotesRepository", "CreateVote", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedVotesRepository) VoteExists(ctx context.Context, nickname string, threadID int64) (bool, error) {
+	start := time.Now()
+	res, err := repo.next.VoteExists(ctx, nickname, threadID)
+	repo.observe("VotesRepository", "VoteExists", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedVotesRepository) UpdateVote(ctx context.Context, threadID int64, nickname string, voice int64) (bool, error) {
+	start := time.Now()
+	res, err := repo.next.UpdateVote(ctx, threadID, nickname, voice)
+	repo.observe("VotesRepository", "UpdateVote", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedVotesRepository) SetVote(ctx context.Context, vote *core.Vote) error {
+	start := time.Now()
+	err := repo.next.SetVote(ctx, vote)
+	repo.observe("VotesRepository", "SetVote", time.Since(start), err)
+	return err
+}
+
+type instrumentedServiceRepository struct {
+	next    ServiceRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedServiceRepository) Status(ctx context.Context) (*core.ServiceInfo, error) {
+	start := time.Now()
+	res, err := repo.next.Status(ctx)
+	repo.observe("ServiceRepository", "Status", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedServiceRepository) Delete(ctx context.Context) error {
+	start := time.Now()
+	err := repo.next.Delete(ctx)
+	repo.observe("ServiceRepository", "Delete", time.Since(start), err)
+	return err
+}
+
+type instrumentedSearchRepository struct {
+	next    SearchRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedSearchRepository) Search(ctx context.Context, filter *SearchFilter, limit int64, after *Keyset, desc bool) ([]*core.SearchResult, error) {
+	start := time.Now()
+	res, err := repo.next.Search(ctx, filter, limit, after, desc)
+	repo.observe("SearchRepository", "Search", time.Since(start), err)
+	return res, err
+}
+
+type instrumentedSessionRepository struct {
+	next    SessionRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedSessionRepository) CreateSession(ctx context.Context, session *core.Session) error {
+	start := time.Now()
+	err := repo.next.CreateSession(ctx, session)
+	repo.observe("SessionRepository", "CreateSession", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedSessionRepository) GetSession(ctx context.Context, id string) (*core.Session, error) {
+	start := time.Now()
+	res, err := repo.next.GetSession(ctx, id)
+	repo.observe("SessionRepository", "GetSession", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedSessionRepository) DeleteSession(ctx context.Context, id string) error {
+	start := time.Now()
+	err := repo.next.DeleteSession(ctx, id)
+	repo.observe("SessionRepository", "DeleteSession", time.Since(start), err)
+	return err
+}
+
+type instrumentedRoleRepository struct {
+	next    RoleRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedRoleRepository) GetUserRole(ctx context.Context, nickname string) (string, error) {
+	start := time.Now()
+	res, err := repo.next.GetUserRole(ctx, nickname)
+	repo.observe("RoleRepository", "GetUserRole", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedRoleRepository) SetUserRole(ctx context.Context, nickname string, role string) error {
+	start := time.Now()
+	err := repo.next.SetUserRole(ctx, nickname, role)
+	repo.observe("RoleRepository", "SetUserRole", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedRoleRepository) IsForumModerator(ctx context.Context, forum string, nickname string) (bool, error) {
+	start := time.Now()
+	res, err := repo.next.IsForumModerator(ctx, forum, nickname)
+	repo.observe("RoleRepository", "IsForumModerator", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedRoleRepository) GetForumModerators(ctx context.Context, forum string) ([]*core.User, error) {
+	start := time.Now()
+	res, err := repo.next.GetForumModerators(ctx, forum)
+	repo.observe("RoleRepository", "GetForumModerators", time.Since(start), err)
+	return res, err
+}
+
+func (repo *instrumentedRoleRepository) AddForumModerator(ctx context.Context, forum string, nickname string) error {
+	start := time.Now()
+	err := repo.next.AddForumModerator(ctx, forum, nickname)
+	repo.observe("RoleRepository", "AddForumModerator", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedRoleRepository) RemoveForumModerator(ctx context.Context, forum string, nickname string) error {
+	start := time.Now()
+	err := repo.next.RemoveForumModerator(ctx, forum, nickname)
+	repo.observe("RoleRepository", "RemoveForumModerator", time.Since(start), err)
+	return err
+}
+
+type instrumentedAPIKeyRepository struct {
+	next    APIKeyRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedAPIKeyRepository) CreateAPIKey(ctx context.Context, key *core.APIKey) error {
+	start := time.Now()
+	err := repo.next.CreateAPIKey(ctx, key)
+	repo.observe("APIKeyRepository", "CreateAPIKey", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedAPIKeyRepository) GetAPIKeys(ctx context.Context, nickname string) ([]*core.APIKey, error) {
+	start := time.Now()
+	keys, err := repo.next.GetAPIKeys(ctx, nickname)
+	repo.observe("APIKeyRepository", "GetAPIKeys", time.Since(start), err)
+	return keys, err
+}
+
+func (repo *instrumentedAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error) {
+	start := time.Now()
+	key, err := repo.next.GetAPIKeyByHash(ctx, hash)
+	repo.observe("APIKeyRepository", "GetAPIKeyByHash", time.Since(start), err)
+	return key, err
+}
+
+func (repo *instrumentedAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64, used time.Time) error {
+	start := time.Now()
+	err := repo.next.TouchAPIKey(ctx, id, used)
+	repo.observe("APIKeyRepository", "TouchAPIKey", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedAPIKeyRepository) RevokeAPIKey(ctx context.Context, nickname string, id int64) (*core.APIKey, error) {
+	start := time.Now()
+	key, err := repo.next.RevokeAPIKey(ctx, nickname, id)
+	repo.observe("APIKeyRepository", "RevokeAPIKey", time.Since(start), err)
+	return key, err
+}
+
+type instrumentedRateLimitRepository struct {
+	next    RateLimitRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedRateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	start := time.Now()
+	allowed, retryAfter, err := repo.next.Take(ctx, key, limit)
+	repo.observe("RateLimitRepository", "Take", time.Since(start), err)
+	return allowed, retryAfter, err
+}
+
+func (repo *instrumentedRateLimitRepository) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	start := time.Now()
+	deleted, err := repo.next.Sweep(ctx, idle)
+	repo.observe("RateLimitRepository", "Sweep", time.Since(start), err)
+	return deleted, err
+}
+
+type instrumentedIdempotencyRepository struct {
+	next    IdempotencyRepository
+	observe QueryObserver
+}
+
+func (repo *instrumentedIdempotencyRepository) ReserveIdempotencyKey(ctx context.Context, record *core.IdempotencyRecord) (*core.IdempotencyRecord, error) {
+	start := time.Now()
+	existing, err := repo.next.ReserveIdempotencyKey(ctx, record)
+	repo.observe("IdempotencyRepository", "ReserveIdempotencyKey", time.Since(start), err)
+	return existing, err
+}
+
+func (repo *instrumentedIdempotencyRepository) CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte, expires time.Time) error {
+	start := time.Now()
+	err := repo.next.CompleteIdempotencyKey(ctx, key, status, contentType, body, expires)
+	repo.observe("IdempotencyRepository", "CompleteIdempotencyKey", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedIdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	start := time.Now()
+	err := repo.next.ReleaseIdempotencyKey(ctx, key)
+	repo.observe("IdempotencyRepository", "ReleaseIdempotencyKey", time.Since(start), err)
+	return err
+}
+
+func (repo *instrumentedIdempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	start := time.Now()
+	deleted, err := repo.next.DeleteExpiredIdempotencyKeys(ctx)
+	repo.observe("IdempotencyRepository", "DeleteExpiredIdempotencyKeys", time.Since(start), err)
+	return deleted, err
+}
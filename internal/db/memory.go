@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+)
+
+// The in-memory backend reproduces the semantics of db/db.sql without a database:
+// citext columns are compared case-insensitively, posts get a materialized path,
+// and the work of the triggers (forum counters, forum_users, thread votes) is done inline.
+// It is meant for demos and hermetic tests, not for production load.
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+type memPost struct {
+	core.Post
+}
+
+type memVoteKey struct {
+	nickname string
+	thread   int64
+}
+
+// memData holds the tables of the in-memory backend.
+type memData struct {
+	users      map[string]*core.User // by lowercased nickname
+	userEmails map[string]string     // lowercased email to lowercased nickname
+	userOrder  []string
+
+	forums map[string]*core.Forum // by lowercased slug
+
+	threads      map[int64]*core.Thread
+	threadOrder  []int64
+	nextThreadID int64
+
+	posts       map[int64]*memPost
+	threadPosts map[int64][]int64
+	nextPostID  int64
+
+	postRevisions map[int64][]*core.PostRevision
+
+	forumUsers map[string]map[string]*core.User // lowercased forum slug to lowercased nickname
+	votes      map[memVoteKey]int64
+
+	passwords map[string]string // lowercased nickname to password hash
+	sessions  map[string]*core.Session
+
+	roles           map[string]string              // lowercased nickname to global role, members are left out
+	forumModerators map[string]map[string]struct{} // lowercased forum slug to lowercased nicknames
+
+	apiKeys      map[int64]*core.APIKey
+	nextAPIKeyID int64
+
+	rateLimits      map[string]*ratelimit.Bucket
+	idempotencyKeys map[string]*core.IdempotencyRecord
+}
+
+func newMemData() memData {
+	return memData{
+		users:         map[string]*core.User{},
+		userEmails:    map[string]string{},
+		forums:        map[string]*core.Forum{},
+		threads:       map[int64]*core.Thread{},
+		posts:         map[int64]*memPost{},
+		threadPosts:   map[int64][]int64{},
+		postRevisions: map[int64][]*core.PostRevision{},
+		forumUsers:    map[string]map[string]*core.User{},
+		votes:         map[memVoteKey]int64{},
+		passwords:     map[string]string{},
+		sessions:      map[string]*core.Session{},
+
+		roles:           map[string]string{},
+		forumModerators: map[string]map[string]struct{}{},
+
+		apiKeys:         map[int64]*core.APIKey{},
+		rateLimits:      map[string]*ratelimit.Bucket{},
+		idempotencyKeys: map[string]*core.IdempotencyRecord{},
+	}
+}
+
+type memStore struct {
+	mu sync.Mutex
+	memData
+
+	// listeners are called with the events of committed changes, they outlive a clear.
+	listeners      map[int64]func(*core.Event)
+	nextListenerID int64
+}
+
+func newMemStore() *memStore {
+	return &memStore{memData: newMemData(), listeners: map[int64]func(*core.Event){}}
+}
+
+// memSession is the handle repositories use to access the store. Outside of a transaction
+// every call takes the store lock on its own; inside one the lock is held for the whole
+// transaction and mutations record how to undo themselves.
+type memSession struct {
+	store  *memStore
+	inTx   bool
+	undo   []func()
+	events []*core.Event
+}
+
+func (sess *memSession) lock() func() {
+	if sess.inTx {
+		return func() {}
+	}
+	sess.store.mu.Lock()
+	return sess.store.mu.Unlock
+}
+
+// onRollback registers fn to be called if the surrounding transaction is rolled back.
+func (sess *memSession) onRollback(fn func()) {
+	if sess.inTx {
+		sess.undo = append(sess.undo, fn)
+	}
+}
+
+func (sess *memSession) rollback() {
+	for i := len(sess.undo) - 1; i >= 0; i-- {
+		sess.undo[i]()
+	}
+	sess.undo = nil
+	sess.events = nil
+}
+
+// notify does the work of the event triggers: the event reaches the listeners once the change is committed.
+func (sess *memSession) notify(event *core.Event) {
+	if sess.inTx {
+		sess.events = append(sess.events, event)
+		return
+	}
+	for _, listener := range sess.store.listeners {
+		listener(event)
+	}
+}
+
+// commit delivers the events held back by a transaction, the store lock must be held.
+func (sess *memSession) commit() {
+	events := sess.events
+	sess.events, sess.inTx = nil, false
+	for _, event := range events {
+		sess.notify(event)
+	}
+}
+
+// citext mimics comparison of citext values. The result never shares memory with s:
+// fiber hands out strings backed by reused request buffers, so whatever the store keeps must be copied.
+func citext(s string) string {
+	return strings.ToLower(strings.Clone(s))
+}
+
+func memUniqueViolation(constraint string) error {
+	return &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: constraint, Message: "duplicate key value violates unique constraint \"" + constraint + "\""}
+}
+
+func memForeignKeyViolation(constraint string) error {
+	return &pgconn.PgError{Code: pgForeignKeyViolation, ConstraintName: constraint, Message: "insert or update violates foreign key constraint \"" + constraint + "\""}
+}
+
+// renameForum does the work of ON UPDATE CASCADE on the references to forums.slug.
+func (sess *memSession) renameForum(key, slug string) {
+	s := sess.store
+	newKey := citext(slug)
+
+	forum := s.forums[key]
+	delete(s.forums, key)
+	s.forums[newKey] = forum
+
+	users, hasUsers := s.forumUsers[key]
+	if hasUsers {
+		delete(s.forumUsers, key)
+		s.forumUsers[newKey] = users
+	}
+	moderators, hasModerators := s.forumModerators[key]
+	if hasModerators {
+		delete(s.forumModerators, key)
+		s.forumModerators[newKey] = moderators
+	}
+
+	threads := map[*core.Thread]string{}
+	for _, t := range s.threads {
+		if citext(t.Forum) == key {
+			threads[t] = t.Forum
+			t.Forum = slug
+		}
+	}
+	children := map[*core.Forum]string{}
+	for _, f := range s.forums {
+		if f.Parent != "" && citext(f.Parent) == key {
+			children[f] = f.Parent
+			f.Parent = slug
+		}
+	}
+	posts := map[*memPost]string{}
+	for _, p := range s.posts {
+		if citext(p.Forum) == key {
+			posts[p] = p.Forum
+			p.Forum = slug
+		}
+	}
+	// API keys refer to forums without a foreign key, UpdateForum carries the new slug over to them.
+	keyForums := map[*core.APIKey][]string{}
+	for _, k := range s.apiKeys {
+		for i, f := range k.Forums {
+			if citext(f) == key {
+				if _, ok := keyForums[k]; !ok {
+					keyForums[k] = append([]string{}, k.Forums...)
+				}
+				k.Forums[i] = slug
+			}
+		}
+	}
+
+	sess.onRollback(func() {
+		delete(s.forums, newKey)
+		s.forums[key] = forum
+		if hasUsers {
+			delete(s.forumUsers, newKey)
+			s.forumUsers[key] = users
+		}
+		if hasModerators {
+			delete(s.forumModerators, newKey)
+			s.forumModerators[key] = moderators
+		}
+		for t, forum := range threads {
+			t.Forum = forum
+		}
+		for f, parent := range children {
+			f.Parent = parent
+		}
+		for p, forum := range posts {
+			p.Forum = forum
+		}
+		for k, forums := range keyForums {
+			k.Forums = forums
+		}
+	})
+}
+
+// forumsWhere returns copies of the forums accepted by filter, ordered by slug.
+func (sess *memSession) forumsWhere(filter func(*core.Forum) bool) []*core.Forum {
+	forums := []*core.Forum{}
+	for _, forum := range sess.store.forums {
+		if filter(forum) {
+			f := *forum
+			forums = append(forums, &f)
+		}
+	}
+	sort.Slice(forums, func(i, j int) bool { return citext(forums[i].Slug) < citext(forums[j].Slug) })
+	return forums
+}
+
+// addForumUser does the work of the update_forum_user trigger.
+func (sess *memSession) addForumUser(forum, nickname string) {
+	s := sess.store
+	user, ok := s.users[citext(nickname)]
+	if !ok {
+		return
+	}
+
+	users, ok := s.forumUsers[citext(forum)]
+	if !ok {
+		users = map[string]*core.User{}
+		s.forumUsers[citext(forum)] = users
+	}
+	if _, ok := users[citext(nickname)]; ok {
+		return
+	}
+
+	snapshot := *user
+	users[citext(nickname)] = &snapshot
+	sess.onRollback(func() { delete(users, citext(nickname)) })
+}
+
+func newMemRepository(sess *memSession) *Repository {
+	repository := &Repository{}
+
+	repository.UserRepository = &userRepositoryMem{sess: sess}
+	repository.ForumRepository = &forumRepositoryMem{sess: sess}
+	repository.ForumThreadRepository = &forumThreadRepositoryMem{sess: sess}
+	repository.PostsRepository = &postsRepositoryMem{sess: sess}
+	repository.VotesRepository = &votesRepositoryMem{sess: sess}
+	repository.ServiceRepository = &serviceRepositoryMem{sess: sess}
+	repository.SearchRepository = &searchRepositoryMem{sess: sess}
+	repository.SessionRepository = &sessionRepositoryMem{sess: sess}
+	repository.RoleRepository = &roleRepositoryMem{sess: sess}
+	repository.APIKeyRepository = &apiKeyRepositoryMem{sess: sess}
+	repository.RateLimitRepository = &rateLimitRepositoryMem{sess: sess}
+	repository.IdempotencyRepository = &idempotencyRepositoryMem{sess: sess}
+	repository.EventsRepository = &eventsRepositoryMem{sess: sess}
+
+	return repository
+}
+
+// NewMemoryRepository returns a Repository backed by an empty in-memory store.
+// Transactions are serialized by a single store-wide lock and rolled back with an undo log.
+func NewMemoryRepository() (*Repository, error) {
+	store := newMemStore()
+
+	repository := newMemRepository(&memSession{store: store})
+	repository.runTx = func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+
+		sess := &memSession{store: store, inTx: true}
+		txRepository := newMemRepository(sess)
+		txRepository.runTx = joinTx(txRepository)
+
+		if err := fn(txRepository); err != nil {
+			sess.rollback()
+			return err
+		}
+		sess.commit()
+		return nil
+	}
+
+	return repository, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type apiKeyRepositoryMem struct {
+	sess *memSession
+}
+
+// copyAPIKey copies a key along with its scopes and forums, so that callers do not share them with the store.
+func copyAPIKey(key *core.APIKey) *core.APIKey {
+	k := *key
+	k.Scopes = append([]string{}, key.Scopes...)
+	k.Forums = append([]string{}, key.Forums...)
+	return &k
+}
+
+func (repo *apiKeyRepositoryMem) CreateAPIKey(ctx context.Context, key *core.APIKey) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(key.Nickname)]; !ok {
+		return memForeignKeyViolation("api_keys_nickname_fkey")
+	}
+	for _, stored := range s.apiKeys {
+		if stored.Hash == key.Hash {
+			return memUniqueViolation("api_keys_hash_key")
+		}
+	}
+
+	s.nextAPIKeyID++
+	stored := copyAPIKey(key)
+	stored.ID, stored.Created = s.nextAPIKeyID, time.Now()
+	stored.Nickname, stored.Name, stored.Hash = strings.Clone(key.Nickname), strings.Clone(key.Name), strings.Clone(key.Hash)
+	s.apiKeys[stored.ID] = stored
+	repo.sess.onRollback(func() {
+		delete(s.apiKeys, stored.ID)
+		s.nextAPIKeyID--
+	})
+
+	key.ID, key.Created = stored.ID, stored.Created
+	return nil
+}
+
+func (repo *apiKeyRepositoryMem) GetAPIKeys(ctx context.Context, nickname string) ([]*core.APIKey, error) {
+	defer repo.sess.lock()()
+
+	keys := []*core.APIKey{}
+	for _, key := range repo.sess.store.apiKeys {
+		if citext(key.Nickname) == citext(nickname) {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+func (repo *apiKeyRepositoryMem) GetAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error) {
+	defer repo.sess.lock()()
+
+	for _, key := range repo.sess.store.apiKeys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, constants.ErrDBNotFound
+}
+
+func (repo *apiKeyRepositoryMem) TouchAPIKey(ctx context.Context, id int64, used time.Time) error {
+	defer repo.sess.lock()()
+
+	key, ok := repo.sess.store.apiKeys[id]
+	if !ok || (key.LastUsed != nil && !key.LastUsed.Before(used.Add(-apiKeyTouchInterval))) {
+		return nil
+	}
+	previous := key.LastUsed
+	key.LastUsed = &used
+	repo.sess.onRollback(func() { key.LastUsed = previous })
+
+	return nil
+}
+
+func (repo *apiKeyRepositoryMem) RevokeAPIKey(ctx context.Context, nickname string, id int64) (*core.APIKey, error) {
+	defer repo.sess.lock()()
+
+	key, ok := repo.sess.store.apiKeys[id]
+	if !ok || citext(key.Nickname) != citext(nickname) {
+		return nil, constants.ErrDBNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		repo.sess.onRollback(func() { key.RevokedAt = nil })
+	}
+
+	return copyAPIKey(key), nil
+}
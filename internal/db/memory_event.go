@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type eventsRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *eventsRepositoryMem) ListenEvents(ctx context.Context, handle func(*core.Event)) error {
+	s := repo.sess.store
+
+	s.mu.Lock()
+	s.nextListenerID++
+	id := s.nextListenerID
+	s.listeners[id] = func(event *core.Event) {
+		e := *event
+		handle(&e)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.listeners, id)
+	s.mu.Unlock()
+	return ctx.Err()
+}
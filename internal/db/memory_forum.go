@@ -0,0 +1,327 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const pgInvalidDatetimeFormat = "22007"
+
+type forumRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *forumRepositoryMem) CreateForum(ctx context.Context, forum *core.Forum) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(forum.User)]; !ok {
+		return memForeignKeyViolation("forums_user_fkey")
+	}
+	if _, ok := s.forums[citext(forum.Parent)]; forum.Parent != "" && !ok {
+		return memForeignKeyViolation("forums_parent_fkey")
+	}
+	key := citext(forum.Slug)
+	if _, ok := s.forums[key]; ok {
+		return memUniqueViolation("forums_pkey")
+	}
+
+	s.forums[key] = &core.Forum{Title: strings.Clone(forum.Title), User: strings.Clone(forum.User), Slug: strings.Clone(forum.Slug), Parent: strings.Clone(forum.Parent)}
+	repo.sess.onRollback(func() { delete(s.forums, key) })
+
+	return nil
+}
+
+func (repo *forumRepositoryMem) GetForumBySlug(ctx context.Context, slug string) (*core.Forum, error) {
+	defer repo.sess.lock()()
+
+	forum, ok := repo.sess.store.forums[citext(slug)]
+	if !ok {
+		return &core.Forum{}, constants.ErrDBNotFound
+	}
+	f := *forum
+	return &f, nil
+}
+
+func (repo *forumRepositoryMem) GetForums(ctx context.Context) ([]*core.Forum, error) {
+	defer repo.sess.lock()()
+
+	return repo.sess.forumsWhere(func(*core.Forum) bool { return true }), nil
+}
+
+func (repo *forumRepositoryMem) GetForumChildren(ctx context.Context, slug string) ([]*core.Forum, error) {
+	defer repo.sess.lock()()
+
+	key := citext(slug)
+	return repo.sess.forumsWhere(func(f *core.Forum) bool { return f.Parent != "" && citext(f.Parent) == key }), nil
+}
+
+func (repo *forumRepositoryMem) UpdateForum(ctx context.Context, slug string, forum *core.Forum) (*core.Forum, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key, newKey := citext(slug), citext(forum.Slug)
+	stored, ok := s.forums[key]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+	if _, ok := s.users[citext(forum.User)]; !ok {
+		return nil, memForeignKeyViolation("forums_user_fkey")
+	}
+	if _, ok := s.forums[newKey]; ok && newKey != key {
+		return nil, memUniqueViolation("forums_pkey")
+	}
+
+	previous := *stored
+	stored.Title, stored.User, stored.Slug = strings.Clone(forum.Title), strings.Clone(forum.User), strings.Clone(forum.Slug)
+	repo.sess.onRollback(func() { *stored = previous })
+
+	// Like ON UPDATE CASCADE, a slug differing only in case is equal to the old one and leaves the references alone.
+	if newKey != key {
+		repo.sess.renameForum(key, stored.Slug)
+	}
+
+	f := *stored
+	return &f, nil
+}
+
+func (repo *forumRepositoryMem) ArchiveForum(ctx context.Context, slug string) (*core.Forum, error) {
+	defer repo.sess.lock()()
+
+	stored, ok := repo.sess.store.forums[citext(slug)]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+	if stored.ArchivedAt == nil {
+		now := time.Now()
+		stored.ArchivedAt = &now
+		repo.sess.onRollback(func() { stored.ArchivedAt = nil })
+	}
+
+	f := *stored
+	return &f, nil
+}
+
+func (repo *forumRepositoryMem) PurgeForum(ctx context.Context, slug string) (int64, int64, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(slug)
+	forum, ok := s.forums[key]
+	if !ok {
+		return 0, 0, constants.ErrDBNotFound
+	}
+
+	previousOrder := s.threadOrder
+	threads := map[int64]*core.Thread{}
+	kept := make([]int64, 0, len(previousOrder))
+	for _, id := range previousOrder {
+		if t := s.threads[id]; citext(t.Forum) == key {
+			threads[id] = t
+			continue
+		}
+		kept = append(kept, id)
+	}
+
+	posts, threadPosts, revisions := map[int64]*memPost{}, map[int64][]int64{}, map[int64][]*core.PostRevision{}
+	for id := range threads {
+		delete(s.threads, id)
+		threadPosts[id] = s.threadPosts[id]
+		delete(s.threadPosts, id)
+		for _, postID := range threadPosts[id] {
+			posts[postID] = s.posts[postID]
+			delete(s.posts, postID)
+			if r, ok := s.postRevisions[postID]; ok {
+				revisions[postID] = r
+				delete(s.postRevisions, postID)
+			}
+		}
+	}
+
+	votes := map[memVoteKey]int64{}
+	for vote, voice := range s.votes {
+		if _, ok := threads[vote.thread]; ok {
+			votes[vote] = voice
+			delete(s.votes, vote)
+		}
+	}
+
+	// Like ON DELETE SET NULL, sub-forums become top-level forums.
+	children := map[*core.Forum]string{}
+	for _, f := range s.forums {
+		if f.Parent != "" && citext(f.Parent) == key {
+			children[f], f.Parent = f.Parent, ""
+		}
+	}
+
+	users, moderators := s.forumUsers[key], s.forumModerators[key]
+	s.threadOrder = kept
+	delete(s.forumUsers, key)
+	delete(s.forumModerators, key)
+	delete(s.forums, key)
+
+	repo.sess.onRollback(func() {
+		s.forums[key] = forum
+		for f, parent := range children {
+			f.Parent = parent
+		}
+		if users != nil {
+			s.forumUsers[key] = users
+		}
+		if moderators != nil {
+			s.forumModerators[key] = moderators
+		}
+		s.threadOrder = previousOrder
+		for id, t := range threads {
+			s.threads[id] = t
+			s.threadPosts[id] = threadPosts[id]
+		}
+		for id, p := range posts {
+			s.posts[id] = p
+		}
+		for id, r := range revisions {
+			s.postRevisions[id] = r
+		}
+		for vote, voice := range votes {
+			s.votes[vote] = voice
+		}
+	})
+
+	return int64(len(threads)), int64(len(posts)), nil
+}
+
+func (repo *forumRepositoryMem) GetForumUsers(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.User, error) {
+	defer repo.sess.lock()()
+
+	forumUsers := repo.sess.store.forumUsers[citext(slug)]
+	users := make([]*core.User, 0, len(forumUsers))
+	for key, user := range forumUsers {
+		if since != "" && ((desc && key >= citext(since)) || (!desc && key <= citext(since))) {
+			continue
+		}
+		u := *user
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if desc {
+			return citext(users[i].Nickname) > citext(users[j].Nickname)
+		}
+		return citext(users[i].Nickname) < citext(users[j].Nickname)
+	})
+
+	return memLimit(users, limit), nil
+}
+
+func (repo *forumRepositoryMem) GetForumThreads(ctx context.Context, slug string, limit int64, since string, desc bool) ([]*core.Thread, error) {
+	var sinceTime time.Time
+	if since != "" {
+		var err error
+		if sinceTime, err = time.Parse(time.RFC3339Nano, since); err != nil {
+			return nil, &pgconn.PgError{Code: pgInvalidDatetimeFormat, Message: "invalid input syntax for type timestamp with time zone: \"" + since + "\""}
+		}
+	}
+
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	threads := []*core.Thread{}
+	for _, id := range s.threadOrder {
+		thread := s.threads[id]
+		if citext(thread.Forum) != citext(slug) || thread.DeletedAt != nil {
+			continue
+		}
+		if since != "" && ((desc && thread.Created.After(sinceTime)) || (!desc && thread.Created.Before(sinceTime))) {
+			continue
+		}
+		t := *thread
+		threads = append(threads, &t)
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		if threads[i].Pinned != threads[j].Pinned {
+			return threads[i].Pinned
+		}
+		if desc {
+			return threads[i].Created.After(threads[j].Created)
+		}
+		return threads[i].Created.Before(threads[j].Created)
+	})
+
+	if limit > 0 {
+		threads = memLimit(threads, limit)
+	}
+	return threads, nil
+}
+
+func (repo *forumRepositoryMem) GetForumUsersPage(ctx context.Context, slug string, limit int64, after *Keyset, desc bool) ([]*core.User, error) {
+	defer repo.sess.lock()()
+
+	forumUsers := repo.sess.store.forumUsers[citext(slug)]
+	users := make([]*core.User, 0, len(forumUsers))
+	for key, user := range forumUsers {
+		if (desc && key >= citext(after.Nickname)) || (!desc && key <= citext(after.Nickname)) {
+			continue
+		}
+		u := *user
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return (citext(users[i].Nickname) < citext(users[j].Nickname)) != desc
+	})
+
+	return memLimit(users, limit), nil
+}
+
+func (repo *forumRepositoryMem) GetForumThreadsPage(ctx context.Context, slug string, limit int64, after *Keyset, desc, back bool) ([]*core.Thread, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	// less orders threads as they are listed: pinned first, then by created and id in the direction of the listing.
+	less := func(a *core.Thread, pinned bool, created time.Time, id int64) bool {
+		if a.Pinned != pinned {
+			return a.Pinned
+		}
+		if !a.Created.Equal(created) {
+			return a.Created.Before(created) != desc
+		}
+		return (a.ID < id) != desc
+	}
+
+	threads := []*core.Thread{}
+	for _, id := range s.threadOrder {
+		thread := s.threads[id]
+		if citext(thread.Forum) != citext(slug) || thread.DeletedAt != nil {
+			continue
+		}
+		if thread.Pinned == after.Pinned && thread.Created.Equal(after.Created) && thread.ID == after.ID || less(thread, after.Pinned, after.Created, after.ID) != back {
+			continue
+		}
+		t := *thread
+		threads = append(threads, &t)
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return less(threads[i], threads[j].Pinned, threads[j].Created, threads[j].ID) != back
+	})
+
+	return memLimit(threads, limit), nil
+}
+
+// memLimit mimics LIMIT, which for a non-positive value returns no rows.
+func memLimit[T any](rows []T, limit int64) []T {
+	if limit <= 0 {
+		return rows[:0]
+	}
+	if int64(len(rows)) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
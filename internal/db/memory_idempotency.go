@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type idempotencyRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *idempotencyRepositoryMem) ReserveIdempotencyKey(ctx context.Context, record *core.IdempotencyRecord) (*core.IdempotencyRecord, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	now := time.Now()
+	previous, ok := s.idempotencyKeys[record.Key]
+	if ok && previous.Expires.After(now) {
+		existing := *previous
+		existing.Body = append([]byte(nil), previous.Body...)
+		return &existing, nil
+	}
+
+	key := strings.Clone(record.Key)
+	s.idempotencyKeys[key] = &core.IdempotencyRecord{Key: key, Fingerprint: strings.Clone(record.Fingerprint), Created: now, Expires: record.Expires}
+	repo.sess.onRollback(func() {
+		if ok {
+			s.idempotencyKeys[key] = previous
+		} else {
+			delete(s.idempotencyKeys, key)
+		}
+	})
+
+	record.Created = now
+	return nil, nil
+}
+
+func (repo *idempotencyRepositoryMem) CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte, expires time.Time) error {
+	defer repo.sess.lock()()
+
+	stored, ok := repo.sess.store.idempotencyKeys[key]
+	if !ok {
+		return nil
+	}
+	previous := *stored
+	stored.Status, stored.ContentType, stored.Body, stored.Expires = status, strings.Clone(contentType), append([]byte(nil), body...), expires
+	repo.sess.onRollback(func() { *stored = previous })
+
+	return nil
+}
+
+func (repo *idempotencyRepositoryMem) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	stored, ok := s.idempotencyKeys[key]
+	if !ok || stored.Status != 0 {
+		return nil
+	}
+	delete(s.idempotencyKeys, key)
+	repo.sess.onRollback(func() { s.idempotencyKeys[key] = stored })
+
+	return nil
+}
+
+func (repo *idempotencyRepositoryMem) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	now := time.Now()
+	expired := map[string]*core.IdempotencyRecord{}
+	for key, stored := range s.idempotencyKeys {
+		if !stored.Expires.After(now) {
+			expired[key] = stored
+			delete(s.idempotencyKeys, key)
+		}
+	}
+	repo.sess.onRollback(func() {
+		for key, stored := range expired {
+			s.idempotencyKeys[key] = stored
+		}
+	})
+
+	return int64(len(expired)), nil
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+type postsRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *postsRepositoryMem) CreatePosts(ctx context.Context, forum string, thread int64, posts []*dto.PostData) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	storedForum, ok := s.forums[citext(forum)]
+	if !ok {
+		return nil, memForeignKeyViolation("posts_forum_fkey")
+	}
+	if _, ok := s.threads[thread]; !ok {
+		return nil, memForeignKeyViolation("posts_thread_fkey")
+	}
+	for _, post := range posts {
+		if _, ok := s.users[citext(post.Author)]; !ok {
+			return nil, memForeignKeyViolation("posts_author_fkey")
+		}
+	}
+
+	forum = strings.Clone(forum)
+	newPosts := make([]*core.Post, 0, len(posts))
+	insertTime := time.Unix(0, time.Now().UnixNano()/1e6*1e6)
+	for _, post := range posts {
+		s.nextPostID++
+		p := &memPost{Post: core.Post{ID: s.nextPostID, Parent: post.Parent, Author: strings.Clone(post.Author), Message: strings.Clone(post.Message), Forum: forum, Thread: thread, Created: insertTime}}
+		if parent, ok := s.posts[post.Parent]; ok {
+			p.Path = append(append(make([]int64, 0, len(parent.Path)+1), parent.Path...), p.ID)
+		} else {
+			p.Path = []int64{p.ID}
+		}
+
+		s.posts[p.ID] = p
+		s.threadPosts[thread] = append(s.threadPosts[thread], p.ID)
+		storedForum.Posts++
+		repo.sess.onRollback(func() {
+			delete(s.posts, p.ID)
+			s.threadPosts[thread] = s.threadPosts[thread][:len(s.threadPosts[thread])-1]
+			s.nextPostID--
+			storedForum.Posts--
+		})
+		repo.sess.addForumUser(forum, post.Author)
+		repo.sess.notify(&core.Event{Thread: thread, Kind: core.EventPost, Post: p.ID})
+
+		created := p.Post
+		newPosts = append(newPosts, &created)
+	}
+
+	return newPosts, nil
+}
+
+func (repo *postsRepositoryMem) CheckParentPost(ctx context.Context, parent int) (int, error) {
+	defer repo.sess.lock()()
+
+	post, ok := repo.sess.store.posts[int64(parent)]
+	if !ok {
+		return 0, constants.ErrDBNotFound
+	}
+	return int(post.Thread), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsThreads(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	defer repo.sess.lock()()
+
+	threads := make(map[int64]int64, len(ids))
+	for _, id := range ids {
+		if post, ok := repo.sess.store.posts[id]; ok {
+			threads[id] = post.Thread
+		}
+	}
+	return threads, nil
+}
+
+func (repo *postsRepositoryMem) GetPostsFlat(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	posts := repo.threadPosts(int64(id), func(p *memPost) bool {
+		return since == -1 || (desc && p.ID < since) || (!desc && p.ID > since)
+	})
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created) != desc
+		}
+		return (a.ID < b.ID) != desc
+	})
+
+	return memPostsOf(memLimit(posts, limit)), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	var sincePath []int64
+	if since != -1 {
+		sincePost, ok := repo.sess.store.posts[since]
+		if !ok {
+			// Comparison with the NULL path of a missing post matches nothing.
+			return []*core.Post{}, nil
+		}
+		sincePath = sincePost.Path
+	}
+
+	posts := repo.threadPosts(int64(id), func(p *memPost) bool {
+		if since == -1 {
+			return true
+		}
+		cmp := comparePaths(p.Path, sincePath)
+		return (desc && cmp < 0) || (!desc && cmp > 0)
+	})
+	sort.SliceStable(posts, func(i, j int) bool {
+		if desc {
+			return comparePaths(posts[i].Path, posts[j].Path) > 0
+		}
+		return comparePaths(posts[i].Path, posts[j].Path) < 0
+	})
+
+	if limit > 0 {
+		posts = memLimit(posts, limit)
+	}
+	return memPostsOf(posts), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsParentTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	var sinceRoot int64
+	if since != -1 {
+		sincePost, ok := repo.sess.store.posts[since]
+		if !ok {
+			return []*core.Post{}, nil
+		}
+		sinceRoot = sincePost.Path[0]
+	}
+
+	roots := repo.threadPosts(int64(id), func(p *memPost) bool {
+		if p.Parent != 0 {
+			return false
+		}
+		return since == -1 || (desc && p.Path[0] < sinceRoot) || (!desc && p.Path[0] > sinceRoot)
+	})
+	sort.Slice(roots, func(i, j int) bool { return (roots[i].ID < roots[j].ID) != desc })
+
+	return memPostsOf(repo.subtrees(memLimit(roots, limit), desc)), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsFlatPage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	less := func(p *memPost, created time.Time, id int64) bool {
+		if !p.Created.Equal(created) {
+			return p.Created.Before(created)
+		}
+		return p.ID < id
+	}
+
+	posts := repo.threadPosts(thread, func(p *memPost) bool {
+		return !(p.Created.Equal(after.Created) && p.ID == after.ID) && less(p, after.Created, after.ID) == desc
+	})
+	sort.Slice(posts, func(i, j int) bool { return less(posts[i], posts[j].Created, posts[j].ID) != desc })
+
+	return memPostsOf(memLimit(posts, limit)), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	posts := repo.threadPosts(thread, func(p *memPost) bool {
+		cmp := comparePaths(p.Path, after.Path)
+		return (desc && cmp < 0) || (!desc && cmp > 0)
+	})
+	sort.Slice(posts, func(i, j int) bool { return (comparePaths(posts[i].Path, posts[j].Path) < 0) != desc })
+
+	return memPostsOf(memLimit(posts, limit)), nil
+}
+
+func (repo *postsRepositoryMem) GetPostsParentTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	defer repo.sess.lock()()
+
+	roots := repo.threadPosts(thread, func(p *memPost) bool {
+		return p.Parent == 0 && ((desc && p.ID < after.ID) || (!desc && p.ID > after.ID))
+	})
+	sort.Slice(roots, func(i, j int) bool { return (roots[i].ID < roots[j].ID) != desc })
+
+	return memPostsOf(repo.subtrees(memLimit(roots, limit), desc)), nil
+}
+
+func (repo *postsRepositoryMem) GetPostDetails(ctx context.Context, id int64, related string) (*dto.PostDetails, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+
+	postDetails := &dto.PostDetails{}
+	for _, arg := range strings.Split(related, ",") {
+		switch arg {
+		case "user":
+			author, ok := s.users[citext(post.Author)]
+			if !ok {
+				return nil, constants.ErrDBNotFound
+			}
+			u := *author
+			postDetails.Author = &u
+		case "thread":
+			thread, ok := s.threads[post.Thread]
+			if !ok {
+				return nil, constants.ErrDBNotFound
+			}
+			t := *thread
+			postDetails.Thread = &t
+		case "forum":
+			forum, ok := s.forums[citext(post.Forum)]
+			if !ok {
+				return nil, constants.ErrDBNotFound
+			}
+			f := *forum
+			postDetails.Forum = &f
+		}
+	}
+
+	return postDetails, nil
+}
+
+func (repo *postsRepositoryMem) GetPostByID(ctx context.Context, id int64) (*core.Post, error) {
+	defer repo.sess.lock()()
+
+	post, ok := repo.sess.store.posts[id]
+	if !ok {
+		return &core.Post{}, constants.ErrDBNotFound
+	}
+	return post.view(), nil
+}
+
+func (repo *postsRepositoryMem) UpdatePost(ctx context.Context, id int64, message, editor, reason string) (*core.Post, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+	user, ok := s.users[citext(editor)]
+	if !ok {
+		return nil, memForeignKeyViolation("post_revisions_editor_fkey")
+	}
+
+	previous, revisions := post.Post, s.postRevisions[id]
+	s.postRevisions[id] = append(revisions[:len(revisions):len(revisions)], &core.PostRevision{
+		Number: int64(len(revisions)) + 1, Post: id, Editor: user.Nickname, Reason: strings.Clone(reason),
+		Message: previous.Message, Created: time.Unix(0, time.Now().UnixNano()/1e3*1e3),
+	})
+	post.Message, post.IsEdited = strings.Clone(message), true
+	repo.sess.onRollback(func() {
+		post.Post = previous
+		s.postRevisions[id] = revisions
+	})
+	if previous.Message != post.Message {
+		repo.sess.notify(&core.Event{Thread: post.Thread, Kind: core.EventEdit, Post: id})
+	}
+
+	return post.view(), nil
+}
+
+func (repo *postsRepositoryMem) GetPostRevisions(ctx context.Context, id int64) ([]*core.PostRevision, error) {
+	defer repo.sess.lock()()
+
+	revisions := []*core.PostRevision{}
+	for _, r := range repo.sess.store.postRevisions[id] {
+		revision := *r
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
+func (repo *postsRepositoryMem) DeletePost(ctx context.Context, id int64) (*core.Post, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	post, ok := s.posts[id]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+
+	if post.DeletedAt == nil {
+		deletedAt := time.Unix(0, time.Now().UnixNano()/1e3*1e3)
+		post.DeletedAt = &deletedAt
+		forum := s.forums[citext(post.Forum)]
+		forum.Posts--
+		repo.sess.onRollback(func() {
+			post.DeletedAt = nil
+			forum.Posts++
+		})
+		repo.sess.notify(&core.Event{Thread: post.Thread, Kind: core.EventEdit, Post: id})
+	}
+
+	return post.view(), nil
+}
+
+func (repo *postsRepositoryMem) MovePostTree(ctx context.Context, id int64, thread int64) (int64, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	root, ok := s.posts[id]
+	if !ok {
+		return 0, constants.ErrDBNotFound
+	}
+	if _, ok := s.threads[thread]; !ok {
+		return 0, memForeignKeyViolation("posts_thread_fkey")
+	}
+	from, rootPath := root.Thread, root.Path
+
+	previousFrom, previousTo := s.threadPosts[from], s.threadPosts[thread]
+	previousPosts := map[*memPost]memPost{}
+	kept, moved := make([]int64, 0, len(previousFrom)), previousTo[:len(previousTo):len(previousTo)]
+	for _, postID := range previousFrom {
+		p := s.posts[postID]
+		if len(p.Path) < len(rootPath) || comparePaths(p.Path[:len(rootPath)], rootPath) != 0 {
+			kept = append(kept, postID)
+			continue
+		}
+		previousPosts[p] = *p
+		p.Thread, p.Path = thread, append([]int64(nil), p.Path[len(rootPath)-1:]...)
+		if p == root {
+			p.Parent = 0
+		}
+		moved = append(moved, postID)
+	}
+	s.threadPosts[from], s.threadPosts[thread] = kept, moved
+
+	repo.sess.onRollback(func() {
+		for p, previous := range previousPosts {
+			*p = previous
+		}
+		s.threadPosts[from], s.threadPosts[thread] = previousFrom, previousTo
+	})
+
+	return int64(len(previousPosts)), nil
+}
+
+func (repo *postsRepositoryMem) DeletePostTree(ctx context.Context, id int64) (int64, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	root, ok := s.posts[id]
+	if !ok {
+		return 0, constants.ErrDBNotFound
+	}
+	forum := s.forums[citext(root.Forum)]
+
+	previousOrder := s.threadPosts[root.Thread]
+	removed := map[int64]*memPost{}
+	kept := make([]int64, 0, len(previousOrder))
+	for _, postID := range previousOrder {
+		p := s.posts[postID]
+		if len(p.Path) >= len(root.Path) && comparePaths(p.Path[:len(root.Path)], root.Path) == 0 {
+			removed[postID] = p
+			continue
+		}
+		kept = append(kept, postID)
+	}
+
+	uncounted := int64(0)
+	removedRevisions := map[int64][]*core.PostRevision{}
+	for postID, p := range removed {
+		delete(s.posts, postID)
+		if revisions, ok := s.postRevisions[postID]; ok {
+			removedRevisions[postID] = revisions
+			delete(s.postRevisions, postID)
+		}
+		if p.DeletedAt == nil {
+			uncounted++
+		}
+	}
+	s.threadPosts[root.Thread] = kept
+	forum.Posts -= uncounted
+	repo.sess.onRollback(func() {
+		for postID, p := range removed {
+			s.posts[postID] = p
+		}
+		for postID, revisions := range removedRevisions {
+			s.postRevisions[postID] = revisions
+		}
+		s.threadPosts[root.Thread] = previousOrder
+		forum.Posts += uncounted
+	})
+
+	return int64(len(removed)), nil
+}
+
+// threadPosts returns the posts of the thread accepted by filter, in insertion order.
+func (repo *postsRepositoryMem) threadPosts(thread int64, filter func(p *memPost) bool) []*memPost {
+	s := repo.sess.store
+
+	posts := []*memPost{}
+	for _, id := range s.threadPosts[thread] {
+		if p := s.posts[id]; filter(p) {
+			posts = append(posts, p)
+		}
+	}
+	return posts
+}
+
+// subtrees returns the posts under the given roots, subtrees ordered by root id and posts within them by path.
+func (repo *postsRepositoryMem) subtrees(roots []*memPost, desc bool) []*memPost {
+	selected := make(map[int64]bool, len(roots))
+	for _, root := range roots {
+		selected[root.ID] = true
+	}
+
+	posts := []*memPost{}
+	for _, p := range repo.sess.store.posts {
+		if selected[p.Path[0]] {
+			posts = append(posts, p)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if desc && a.Path[0] != b.Path[0] {
+			return a.Path[0] > b.Path[0]
+		}
+		return comparePaths(a.Path, b.Path) < 0
+	})
+	return posts
+}
+
+func memPostsOf(posts []*memPost) []*core.Post {
+	res := make([]*core.Post, 0, len(posts))
+	for _, p := range posts {
+		res = append(res, p.view())
+	}
+	return res
+}
+
+// view returns a copy of the post as it is shown to clients, with the message of a deleted post hidden.
+func (p *memPost) view() *core.Post {
+	post := p.Post
+	tombstone(&post)
+	return &post
+}
+
+// comparePaths orders materialized paths the way Postgres orders bigint arrays.
+func comparePaths(a, b []int64) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+)
+
+type rateLimitRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *rateLimitRepositoryMem) Take(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	b, ok := s.rateLimits[key]
+	if !ok {
+		b = &ratelimit.Bucket{}
+		s.rateLimits[key] = b
+	}
+	// Buckets are not rolled back, like the unlogged rows of rate_limits taken outside of transactions.
+	allowed, retryAfter := b.Take(limit, time.Now())
+	return allowed, retryAfter, nil
+}
+
+func (repo *rateLimitRepositoryMem) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	deleted, before := int64(0), time.Now().Add(-idle)
+	for key, b := range s.rateLimits {
+		if b.Updated.Before(before) {
+			delete(s.rateLimits, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
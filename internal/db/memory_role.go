@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type roleRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *roleRepositoryMem) GetUserRole(ctx context.Context, nickname string) (string, error) {
+	defer repo.sess.lock()()
+
+	if role, ok := repo.sess.store.roles[citext(nickname)]; ok {
+		return role, nil
+	}
+	return core.RoleMember, nil
+}
+
+func (repo *roleRepositoryMem) SetUserRole(ctx context.Context, nickname string, role string) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(nickname)
+	if _, ok := s.users[key]; !ok {
+		return memForeignKeyViolation("user_roles_nickname_fkey")
+	}
+
+	previous, had := s.roles[key]
+	if role == core.RoleMember {
+		delete(s.roles, key)
+	} else {
+		s.roles[key] = strings.Clone(role)
+	}
+	repo.sess.onRollback(func() {
+		if had {
+			s.roles[key] = previous
+		} else {
+			delete(s.roles, key)
+		}
+	})
+
+	return nil
+}
+
+func (repo *roleRepositoryMem) IsForumModerator(ctx context.Context, forum string, nickname string) (bool, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if f, ok := s.forums[citext(forum)]; ok && citext(f.User) == citext(nickname) {
+		return true, nil
+	}
+	_, ok := s.forumModerators[citext(forum)][citext(nickname)]
+	return ok, nil
+}
+
+func (repo *roleRepositoryMem) GetForumModerators(ctx context.Context, forum string) ([]*core.User, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	moderators := s.forumModerators[citext(forum)]
+	users := make([]*core.User, 0, len(moderators))
+	for key := range moderators {
+		u := *s.users[key]
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Nickname < users[j].Nickname })
+
+	return users, nil
+}
+
+func (repo *roleRepositoryMem) AddForumModerator(ctx context.Context, forum string, nickname string) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	forumKey, key := citext(forum), citext(nickname)
+	if _, ok := s.forums[forumKey]; !ok {
+		return memForeignKeyViolation("forum_moderators_forum_fkey")
+	}
+	if _, ok := s.users[key]; !ok {
+		return memForeignKeyViolation("forum_moderators_nickname_fkey")
+	}
+
+	moderators, ok := s.forumModerators[forumKey]
+	if !ok {
+		moderators = map[string]struct{}{}
+		s.forumModerators[forumKey] = moderators
+	}
+	if _, ok := moderators[key]; ok {
+		return nil
+	}
+	moderators[key] = struct{}{}
+	repo.sess.onRollback(func() { delete(moderators, key) })
+
+	return nil
+}
+
+func (repo *roleRepositoryMem) RemoveForumModerator(ctx context.Context, forum string, nickname string) error {
+	defer repo.sess.lock()()
+
+	moderators := repo.sess.store.forumModerators[citext(forum)]
+	key := citext(nickname)
+	if _, ok := moderators[key]; !ok {
+		return nil
+	}
+	delete(moderators, key)
+	repo.sess.onRollback(func() { moderators[key] = struct{}{} })
+
+	return nil
+}
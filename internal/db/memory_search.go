@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+// searchRepositoryMem approximates full-text search: every word of the query has to occur in the document,
+// ignoring case, and the rank is the share of the document's words that matched. There is no stemming.
+type searchRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *searchRepositoryMem) Search(ctx context.Context, filter *SearchFilter, limit int64, after *Keyset, desc bool) ([]*core.SearchResult, error) {
+	terms := map[string]bool{}
+	for _, word := range memWords(filter.Query) {
+		terms[word] = true
+	}
+	if len(terms) == 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	matches := func(forum, author string) bool {
+		return (filter.Forum == "" || citext(forum) == citext(filter.Forum)) && (filter.Author == "" || citext(author) == citext(filter.Author))
+	}
+
+	results := []*core.SearchResult{}
+	if filter.Type != SearchTypeThread {
+		for _, p := range s.posts {
+			if p.DeletedAt != nil || s.threads[p.Thread].DeletedAt != nil || !matches(p.Forum, p.Author) {
+				continue
+			}
+			if rank, ok := memRank(terms, p.Message); ok {
+				results = append(results, &core.SearchResult{Type: SearchTypePost, ID: p.ID, Thread: p.Thread, Forum: p.Forum, Author: p.Author,
+					Snippet: memHighlight(terms, p.Message), Rank: rank, Created: p.Created})
+			}
+		}
+	}
+	if filter.Type != SearchTypePost {
+		for _, t := range s.threads {
+			if t.DeletedAt != nil || !matches(t.Forum, t.Author) {
+				continue
+			}
+			if rank, ok := memRank(terms, t.Title+" "+t.Message); ok {
+				results = append(results, &core.SearchResult{Type: SearchTypeThread, ID: t.ID, Thread: t.ID, Forum: t.Forum, Author: t.Author,
+					Title: t.Title, Snippet: memHighlight(terms, t.Message), Rank: rank, Created: t.Created})
+			}
+		}
+	}
+
+	less := func(a *core.SearchResult, rank float32, kind string, id int64) bool {
+		if a.Rank != rank {
+			return a.Rank < rank
+		}
+		if a.Type != kind {
+			return a.Type < kind
+		}
+		return a.ID < id
+	}
+
+	if after != nil {
+		filtered := results[:0]
+		for _, r := range results {
+			if !(r.Rank == after.Rank && r.Type == after.Kind && r.ID == after.ID) && less(r, after.Rank, after.Kind, after.ID) == desc {
+				filtered = append(filtered, r)
+			}
+		}
+		results = filtered
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return less(results[i], results[j].Rank, results[j].Type, results[j].ID) != desc
+	})
+
+	return memLimit(results, limit), nil
+}
+
+func memWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+func memRank(terms map[string]bool, text string) (float32, bool) {
+	words := memWords(text)
+	found, hits := map[string]bool{}, 0
+	for _, word := range words {
+		if terms[word] {
+			found[word] = true
+			hits++
+		}
+	}
+	if len(found) < len(terms) {
+		return 0, false
+	}
+	return float32(hits) / float32(len(words)), true
+}
+
+// memHighlight marks the matched words the way ts_headline does by default.
+func memHighlight(terms map[string]bool, text string) string {
+	snippet := strings.Builder{}
+	word := strings.Builder{}
+	flush := func() {
+		if w := word.String(); terms[strings.ToLower(w)] {
+			snippet.WriteString("<b>" + w + "</b>")
+		} else {
+			snippet.WriteString(w)
+		}
+		word.Reset()
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		snippet.WriteRune(r)
+	}
+	flush()
+	return snippet.String()
+}
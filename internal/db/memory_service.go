@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type serviceRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *serviceRepositoryMem) Status(ctx context.Context) (*core.ServiceInfo, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	posts := int64(0)
+	for _, p := range s.posts {
+		if p.DeletedAt == nil {
+			posts++
+		}
+	}
+
+	threads := int64(0)
+	for _, t := range s.threads {
+		if t.DeletedAt == nil {
+			threads++
+		}
+	}
+
+	return &core.ServiceInfo{
+		User:   int64(len(s.users)),
+		Forum:  int64(len(s.forums)),
+		Thread: threads,
+		Post:   posts,
+	}, nil
+}
+
+func (repo *serviceRepositoryMem) Delete(ctx context.Context) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	previous := s.memData
+	s.memData = newMemData()
+	repo.sess.onRollback(func() { s.memData = previous })
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type sessionRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *sessionRepositoryMem) CreateSession(ctx context.Context, session *core.Session) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(session.Nickname)]; !ok {
+		return memForeignKeyViolation("sessions_nickname_fkey")
+	}
+	if _, ok := s.sessions[session.ID]; ok {
+		return memUniqueViolation("sessions_pkey")
+	}
+
+	now := time.Now()
+	expired := map[string]*core.Session{}
+	for id, stored := range s.sessions {
+		if citext(stored.Nickname) == citext(session.Nickname) && !stored.Expires.After(now) {
+			expired[id] = stored
+			delete(s.sessions, id)
+		}
+	}
+
+	id := strings.Clone(session.ID)
+	s.sessions[id] = &core.Session{ID: id, Nickname: strings.Clone(session.Nickname), Created: session.Created, Expires: session.Expires}
+	repo.sess.onRollback(func() {
+		delete(s.sessions, id)
+		for id, stored := range expired {
+			s.sessions[id] = stored
+		}
+	})
+
+	return nil
+}
+
+func (repo *sessionRepositoryMem) GetSession(ctx context.Context, id string) (*core.Session, error) {
+	defer repo.sess.lock()()
+
+	stored, ok := repo.sess.store.sessions[id]
+	if !ok || !stored.Expires.After(time.Now()) {
+		return nil, constants.ErrDBNotFound
+	}
+	s := *stored
+	return &s, nil
+}
+
+func (repo *sessionRepositoryMem) DeleteSession(ctx context.Context, id string) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	stored, ok := s.sessions[id]
+	if !ok {
+		return constants.ErrDBNotFound
+	}
+	delete(s.sessions, id)
+	repo.sess.onRollback(func() { s.sessions[stored.ID] = stored })
+
+	return nil
+}
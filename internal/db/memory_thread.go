@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type forumThreadRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *forumThreadRepositoryMem) CreateForumThread(ctx context.Context, thread *core.Thread) (*core.Thread, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(thread.Author)]; !ok {
+		return &core.Thread{}, memForeignKeyViolation("threads_author_fkey")
+	}
+	forum, ok := s.forums[citext(thread.Forum)]
+	if !ok {
+		return &core.Thread{}, memForeignKeyViolation("threads_forum_fkey")
+	}
+
+	s.nextThreadID++
+	t := &core.Thread{
+		ID:      s.nextThreadID,
+		Title:   strings.Clone(thread.Title),
+		Author:  strings.Clone(thread.Author),
+		Forum:   strings.Clone(thread.Forum),
+		Message: strings.Clone(thread.Message),
+		Slug:    strings.Clone(thread.Slug),
+		Created: thread.Created,
+	}
+	s.threads[t.ID] = t
+	s.threadOrder = append(s.threadOrder, t.ID)
+	forum.Threads++
+	repo.sess.onRollback(func() {
+		delete(s.threads, t.ID)
+		s.threadOrder = s.threadOrder[:len(s.threadOrder)-1]
+		s.nextThreadID--
+		forum.Threads--
+	})
+	repo.sess.addForumUser(t.Forum, t.Author)
+	repo.sess.notify(&core.Event{Kind: core.EventThread, Thread: t.ID})
+
+	created := *t
+	return &created, nil
+}
+
+func (repo *forumThreadRepositoryMem) GetForumThreadByID(ctx context.Context, id int64) (*core.Thread, error) {
+	defer repo.sess.lock()()
+
+	thread, ok := repo.sess.store.threads[id]
+	if !ok {
+		return &core.Thread{}, constants.ErrDBNotFound
+	}
+	t := *thread
+	return &t, nil
+}
+
+func (repo *forumThreadRepositoryMem) GetForumThreadBySlug(ctx context.Context, slug string) (*core.Thread, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	for _, id := range s.threadOrder {
+		if thread := s.threads[id]; citext(thread.Slug) == citext(slug) {
+			t := *thread
+			return &t, nil
+		}
+	}
+	return &core.Thread{}, constants.ErrDBNotFound
+}
+
+func (repo *forumThreadRepositoryMem) UpdateForumThreadByID(ctx context.Context, id int64, title string, message string) (*core.Thread, error) {
+	defer repo.sess.lock()()
+
+	thread, ok := repo.sess.store.threads[id]
+	if !ok {
+		return &core.Thread{}, constants.ErrDBNotFound
+	}
+
+	previous := *thread
+	thread.Title, thread.Message = strings.Clone(title), strings.Clone(message)
+	repo.sess.onRollback(func() { *thread = previous })
+
+	t := *thread
+	return &t, nil
+}
+
+func (repo *forumThreadRepositoryMem) ModerateForumThread(ctx context.Context, id int64, moderation *ThreadModeration) (*core.Thread, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	thread, ok := s.threads[id]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+	forum := s.forums[citext(thread.Forum)]
+
+	previous, previousThreads := *thread, forum.Threads
+	if moderation.Locked != nil {
+		thread.Locked = *moderation.Locked
+	}
+	if moderation.Pinned != nil {
+		thread.Pinned = *moderation.Pinned
+	}
+	if moderation.Deleted != nil {
+		if *moderation.Deleted && thread.DeletedAt == nil {
+			deletedAt := time.Unix(0, time.Now().UnixNano()/1e3*1e3)
+			thread.DeletedAt = &deletedAt
+			forum.Threads--
+		} else if !*moderation.Deleted && thread.DeletedAt != nil {
+			thread.DeletedAt = nil
+			forum.Threads++
+		}
+	}
+	repo.sess.onRollback(func() {
+		*thread = previous
+		forum.Threads = previousThreads
+	})
+
+	t := *thread
+	return &t, nil
+}
+
+// LockForumThreads has nothing to do: transactions of the in-memory backend hold the store lock throughout.
+func (repo *forumThreadRepositoryMem) LockForumThreads(ctx context.Context, ids ...int64) error {
+	return nil
+}
+
+func (repo *forumThreadRepositoryMem) MoveForumThread(ctx context.Context, thread *core.Thread, forum string) (*core.Thread, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	stored, ok := s.threads[thread.ID]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+	from, to := s.forums[citext(stored.Forum)], s.forums[citext(forum)]
+	if to == nil {
+		return nil, memForeignKeyViolation("threads_forum_fkey")
+	}
+
+	previous := *stored
+	forum = strings.Clone(forum)
+	stored.Forum = forum
+
+	posts, previousForums := int64(0), make(map[*memPost]string, len(s.threadPosts[thread.ID]))
+	for _, id := range s.threadPosts[thread.ID] {
+		p := s.posts[id]
+		previousForums[p] = p.Forum
+		p.Forum = forum
+		if p.DeletedAt == nil {
+			posts++
+		}
+	}
+
+	threads := int64(1)
+	if stored.DeletedAt != nil {
+		threads = 0
+	}
+	from.Posts, from.Threads = from.Posts-posts, from.Threads-threads
+	to.Posts, to.Threads = to.Posts+posts, to.Threads+threads
+
+	repo.sess.onRollback(func() {
+		*stored = previous
+		for p, forum := range previousForums {
+			p.Forum = forum
+		}
+		from.Posts, from.Threads = from.Posts+posts, from.Threads+threads
+		to.Posts, to.Threads = to.Posts-posts, to.Threads-threads
+	})
+
+	repo.sess.addForumUser(forum, stored.Author)
+	for p := range previousForums {
+		repo.sess.addForumUser(forum, p.Author)
+	}
+
+	t := *stored
+	return &t, nil
+}
+
+func (repo *forumThreadRepositoryMem) MergeForumThread(ctx context.Context, from int64, into int64) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	source, ok := s.threads[from]
+	if !ok {
+		return constants.ErrDBNotFound
+	}
+	if _, ok := s.threads[into]; !ok {
+		return memForeignKeyViolation("posts_thread_fkey")
+	}
+	forum := s.forums[citext(source.Forum)]
+
+	previousSource, previousFrom, previousInto := *source, s.threadPosts[from], s.threadPosts[into]
+	merged := append(previousInto[:len(previousInto):len(previousInto)], previousFrom...)
+	for _, id := range previousFrom {
+		s.posts[id].Thread = into
+	}
+	s.threadPosts[into] = merged
+	delete(s.threadPosts, from)
+
+	if source.DeletedAt == nil {
+		deletedAt := time.Unix(0, time.Now().UnixNano()/1e3*1e3)
+		source.DeletedAt = &deletedAt
+		forum.Threads--
+	}
+
+	repo.sess.onRollback(func() {
+		for _, id := range previousFrom {
+			s.posts[id].Thread = from
+		}
+		s.threadPosts[from], s.threadPosts[into] = previousFrom, previousInto
+		if previousSource.DeletedAt == nil {
+			forum.Threads++
+		}
+		*source = previousSource
+	})
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type userRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *userRepositoryMem) CreateUser(ctx context.Context, user *core.User) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(user.Nickname)
+	if _, ok := s.users[key]; ok {
+		return memUniqueViolation("users_pkey")
+	}
+	if _, ok := s.userEmails[citext(user.Email)]; ok {
+		return memUniqueViolation("users_email_key")
+	}
+
+	u := core.User{Nickname: strings.Clone(user.Nickname), Fullname: strings.Clone(user.Fullname), About: strings.Clone(user.About), Email: strings.Clone(user.Email)}
+	s.users[key] = &u
+	s.userEmails[citext(user.Email)] = key
+	s.userOrder = append(s.userOrder, key)
+	repo.sess.onRollback(func() {
+		delete(s.users, key)
+		delete(s.userEmails, citext(user.Email))
+		s.userOrder = s.userOrder[:len(s.userOrder)-1]
+	})
+
+	return nil
+}
+
+func (repo *userRepositoryMem) GetUserByEmail(ctx context.Context, email string) (*core.User, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key, ok := s.userEmails[citext(email)]
+	if !ok {
+		return &core.User{}, constants.ErrDBNotFound
+	}
+	u := *s.users[key]
+	return &u, nil
+}
+
+func (repo *userRepositoryMem) GetUserByNickname(ctx context.Context, nickname string) (*core.User, error) {
+	defer repo.sess.lock()()
+
+	user, ok := repo.sess.store.users[citext(nickname)]
+	if !ok {
+		return &core.User{}, constants.ErrDBNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (repo *userRepositoryMem) GetUsersByEmailOrNickname(ctx context.Context, email, nickname string) ([]*core.User, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	users := []*core.User{}
+	for _, key := range s.userOrder {
+		user := s.users[key]
+		if citext(user.Email) == citext(email) || key == citext(nickname) {
+			u := *user
+			users = append(users, &u)
+		}
+	}
+
+	return users, nil
+}
+
+func (repo *userRepositoryMem) GetUsersByNicknames(ctx context.Context, nicknames []string) ([]*core.User, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	seen := make(map[string]bool, len(nicknames))
+	users := make([]*core.User, 0, len(nicknames))
+	for _, nickname := range nicknames {
+		key := citext(nickname)
+		user, ok := s.users[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		u := *user
+		users = append(users, &u)
+	}
+
+	return users, nil
+}
+
+func (repo *userRepositoryMem) UpdateUser(ctx context.Context, user *core.User) (*core.User, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(user.Nickname)
+	stored, ok := s.users[key]
+	if !ok {
+		return nil, constants.ErrDBNotFound
+	}
+
+	updated := *stored
+	if v := strings.Trim(user.Fullname, " "); v != "" {
+		updated.Fullname = strings.Clone(v)
+	}
+	if v := strings.Trim(user.About, " "); v != "" {
+		updated.About = strings.Clone(v)
+	}
+	if v := strings.Trim(user.Email, " "); v != "" {
+		if owner, ok := s.userEmails[citext(v)]; ok && owner != key {
+			return nil, memUniqueViolation("users_email_key")
+		}
+		updated.Email = strings.Clone(v)
+	}
+
+	previous := *stored
+	delete(s.userEmails, citext(previous.Email))
+	s.userEmails[citext(updated.Email)] = key
+	*stored = updated
+	repo.sess.onRollback(func() {
+		delete(s.userEmails, citext(updated.Email))
+		s.userEmails[citext(previous.Email)] = key
+		*stored = previous
+	})
+	if updated != previous {
+		repo.sess.notify(&core.Event{Kind: core.EventUser, Nickname: stored.Nickname})
+	}
+
+	return &core.User{Nickname: user.Nickname, Fullname: updated.Fullname, About: updated.About, Email: updated.Email}, nil
+}
+
+func (repo *userRepositoryMem) SetUserPassword(ctx context.Context, nickname string, hash string) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(nickname)
+	if _, ok := s.users[key]; !ok {
+		return constants.ErrDBNotFound
+	}
+
+	previous, had := s.passwords[key]
+	s.passwords[key] = strings.Clone(hash)
+	repo.sess.onRollback(func() {
+		if had {
+			s.passwords[key] = previous
+		} else {
+			delete(s.passwords, key)
+		}
+	})
+
+	return nil
+}
+
+func (repo *userRepositoryMem) GetUserPasswordHash(ctx context.Context, nickname string) (string, string, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := citext(nickname)
+	user, ok := s.users[key]
+	if !ok {
+		return "", "", constants.ErrDBNotFound
+	}
+	return user.Nickname, s.passwords[key], nil
+}
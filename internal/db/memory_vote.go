@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type votesRepositoryMem struct {
+	sess *memSession
+}
+
+func (repo *votesRepositoryMem) CreateVote(ctx context.Context, vote *core.Vote) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(vote.Nickname)]; !ok {
+		return memForeignKeyViolation("votes_nickname_fkey")
+	}
+	thread, ok := s.threads[vote.ThreadID]
+	if !ok {
+		return memForeignKeyViolation("votes_thread_fkey")
+	}
+	key := memVoteKey{nickname: citext(vote.Nickname), thread: vote.ThreadID}
+	if _, ok := s.votes[key]; ok {
+		return memUniqueViolation("votes_less")
+	}
+
+	s.votes[key] = vote.Voice
+	thread.Votes += vote.Voice
+	repo.sess.onRollback(func() {
+		delete(s.votes, key)
+		thread.Votes -= vote.Voice
+	})
+	if vote.Voice != 0 {
+		repo.sess.notify(&core.Event{Thread: thread.ID, Kind: core.EventVotes, Votes: thread.Votes})
+	}
+
+	return nil
+}
+
+func (repo *votesRepositoryMem) VoteExists(ctx context.Context, nickname string, threadID int64) (bool, error) {
+	defer repo.sess.lock()()
+
+	_, ok := repo.sess.store.votes[memVoteKey{nickname: citext(nickname), thread: threadID}]
+	return ok, nil
+}
+
+func (repo *votesRepositoryMem) UpdateVote(ctx context.Context, threadID int64, nickname string, voice int64) (bool, error) {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	key := memVoteKey{nickname: citext(nickname), thread: threadID}
+	previous, ok := s.votes[key]
+	if !ok || previous == voice {
+		return false, nil
+	}
+
+	thread := s.threads[threadID]
+	s.votes[key] = voice
+	thread.Votes += voice - previous
+	repo.sess.onRollback(func() {
+		s.votes[key] = previous
+		thread.Votes -= voice - previous
+	})
+	repo.sess.notify(&core.Event{Thread: threadID, Kind: core.EventVotes, Votes: thread.Votes})
+
+	return true, nil
+}
+
+func (repo *votesRepositoryMem) SetVote(ctx context.Context, vote *core.Vote) error {
+	defer repo.sess.lock()()
+	s := repo.sess.store
+
+	if _, ok := s.users[citext(vote.Nickname)]; !ok {
+		return memForeignKeyViolation("votes_nickname_fkey")
+	}
+	thread, ok := s.threads[vote.ThreadID]
+	if !ok {
+		return memForeignKeyViolation("votes_thread_fkey")
+	}
+	key := memVoteKey{nickname: citext(vote.Nickname), thread: vote.ThreadID}
+	previous, voted := s.votes[key]
+	if voted && previous == vote.Voice {
+		return nil
+	}
+
+	s.votes[key] = vote.Voice
+	thread.Votes += vote.Voice - previous
+	repo.sess.onRollback(func() {
+		if voted {
+			s.votes[key] = previous
+		} else {
+			delete(s.votes, key)
+		}
+		thread.Votes -= vote.Voice - previous
+	})
+	if vote.Voice != previous {
+		repo.sess.notify(&core.Event{Thread: thread.ID, Kind: core.EventVotes, Votes: thread.Votes})
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationsLockID is the key of the advisory lock that serializes migrations
+// between several instances starting against the same database.
+const migrationsLockID = 7_400_201_101
+
+const (
+	queryCreateMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version integer NOT NULL PRIMARY KEY,
+  name text NOT NULL,
+  applied_at timestamp with time zone NOT NULL DEFAULT now()
+);`
+	queryGetAppliedMigrations = "SELECT version, applied_at FROM schema_migrations ORDER BY version;"
+	queryInsertMigration      = "INSERT INTO schema_migrations (version, name) VALUES ($1, $2);"
+	queryDeleteMigration      = "DELETE FROM schema_migrations WHERE version = $1;"
+
+	queryAdvisoryLock   = "SELECT pg_advisory_lock($1);"
+	queryAdvisoryUnlock = "SELECT pg_advisory_unlock($1);"
+)
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus describes a known migration and whether it has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies the numbered migrations embedded from internal/db/migrations.
+// Every migration runs in its own transaction, and the whole run holds an advisory lock.
+type Migrator struct {
+	log        *customtypes.Logger
+	dbConn     *customtypes.DBConn
+	migrations []*migration
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.migrations[len(m.migrations)-1].version)
+}
+
+// Down reverts the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].version]; ok {
+				return m.revert(ctx, conn, m.migrations[i])
+			}
+		}
+		m.log.Info("no migrations to revert")
+		return nil
+	})
+}
+
+// To applies or reverts migrations until version is the latest applied one, 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version: %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.version]; ok && mig.version > version {
+				if err := m.revert(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.version]; !ok && mig.version <= version {
+				if err := m.apply(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status lists every known migration in order.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+	err := m.withLock(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, mig := range m.migrations {
+			appliedAt, ok := applied[mig.version]
+			statuses = append(statuses, &MigrationStatus{Version: mig.version, Name: mig.name, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, mig *migration) error {
+	m.log.Infof("applying migration %04d_%s", mig.version, mig.name)
+
+	return conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.up); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", mig.version, mig.name, err)
+		}
+		_, err := tx.Exec(ctx, queryInsertMigration, mig.version, mig.name)
+		return err
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *pgxpool.Conn, mig *migration) error {
+	if mig.down == "" {
+		return fmt.Errorf("migration %04d_%s can not be reverted", mig.version, mig.name)
+	}
+	m.log.Infof("reverting migration %04d_%s", mig.version, mig.name)
+
+	return conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.down); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", mig.version, mig.name, err)
+		}
+		_, err := tx.Exec(ctx, queryDeleteMigration, mig.version)
+		return err
+	})
+}
+
+// withLock runs fn on a dedicated connection holding the migrations advisory lock,
+// passing it the applied versions along with their application time.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.dbConn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, queryAdvisoryLock, migrationsLockID); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), queryAdvisoryUnlock, migrationsLockID)
+
+	if _, err := conn.Exec(ctx, queryCreateMigrationsTable); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(ctx, queryGetAppliedMigrations)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) find(version int) *migration {
+	for _, mig := range m.migrations {
+		if mig.version == version {
+			return mig
+		}
+	}
+	return nil
+}
+
+func loadMigrations(fsys fs.FS) ([]*migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		match := migrationFileRe.FindStringSubmatch(file[len("migrations/"):])
+		if match == nil {
+			return nil, fmt.Errorf("malformed migration file name: %s", file)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: match[2]}
+			byVersion[version] = mig
+		} else if mig.name != match[2] {
+			return nil, fmt.Errorf("conflicting names for migration %d: %s and %s", version, mig.name, match[2])
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			mig.up = string(content)
+		} else {
+			mig.down = string(content)
+		}
+	}
+
+	migrations := make([]*migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", mig.version, mig.name)
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found")
+	}
+
+	return migrations, nil
+}
+
+func NewMigrator(log *customtypes.Logger, dbConn *customtypes.DBConn) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{log: log, dbConn: dbConn, migrations: migrations}, nil
+}
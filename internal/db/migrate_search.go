@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// queryGetSearchConfigs returns the text search configuration each search column is generated with.
+	queryGetSearchConfigs = `SELECT d.adrelid::regclass::text, (regexp_match(pg_get_expr(d.adbin, d.adrelid), 'to_tsvector\(''([^'']+)''::regconfig'))[1]
+		FROM pg_attrdef d JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+		WHERE d.adrelid IN (to_regclass('posts'), to_regclass('threads')) AND a.attname = 'search';`
+	// queryResolveSearchConfig fails for configurations that do not exist and names the others the way pg_get_expr does.
+	queryResolveSearchConfig = "SELECT $1::regconfig::text;"
+
+	// queryRebuildSearchColumns is migration 0003 with the configuration left to fill in as a literal.
+	queryRebuildSearchColumns = `DROP INDEX IF EXISTS thread_search_gin;
+DROP INDEX IF EXISTS post_search_gin;
+ALTER TABLE threads DROP COLUMN search;
+ALTER TABLE posts DROP COLUMN search;
+
+ALTER TABLE posts ADD COLUMN search tsvector
+  GENERATED ALWAYS AS (to_tsvector(%[1]s, message)) STORED;
+
+ALTER TABLE threads ADD COLUMN search tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector(%[1]s, title), 'A') || setweight(to_tsvector(%[1]s, message), 'B')) STORED;
+
+CREATE INDEX post_search_gin ON posts USING gin (search);
+CREATE INDEX thread_search_gin ON threads USING gin (search);`
+)
+
+// CheckSearchConfig makes sure the search columns are generated with the text search configuration that
+// queries are parsed with, otherwise the stems they store would not match those of the queries.
+// A schema without the search columns passes.
+func (m *Migrator) CheckSearchConfig(ctx context.Context, config string) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn, _ map[int]time.Time) error {
+		_, stale, err := m.staleSearchTables(ctx, conn, config)
+		if err != nil || len(stale) == 0 {
+			return err
+		}
+		return fmt.Errorf("the search columns of %s are not built with the text search configuration %s, "+
+			"apply the migrations to rebuild them", strings.Join(stale, ", "), config)
+	})
+}
+
+// RebuildSearch regenerates the search columns with the given text search configuration unless they
+// are built with it already. Every row is rewritten, which takes a while on a large database.
+func (m *Migrator) RebuildSearch(ctx context.Context, config string) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn, _ map[int]time.Time) error {
+		resolved, stale, err := m.staleSearchTables(ctx, conn, config)
+		if err != nil || len(stale) == 0 {
+			return err
+		}
+		m.log.Infof("rebuilding the search columns with the text search configuration %s", resolved)
+
+		literal := "'" + strings.ReplaceAll(resolved, "'", "''") + "'::regconfig"
+		return conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, fmt.Sprintf(queryRebuildSearchColumns, literal))
+			return err
+		})
+	})
+}
+
+// staleSearchTables resolves config and lists the tables whose search column is generated with another one.
+func (m *Migrator) staleSearchTables(ctx context.Context, conn *pgxpool.Conn, config string) (resolved string, stale []string, err error) {
+	if err := conn.QueryRow(ctx, queryResolveSearchConfig, config).Scan(&resolved); err != nil {
+		return "", nil, fmt.Errorf("text search configuration %s: %w", config, err)
+	}
+
+	rows, err := conn.Query(ctx, queryGetSearchConfigs)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var built *string
+		if err := rows.Scan(&table, &built); err != nil {
+			return "", nil, err
+		}
+		if built == nil || *built != resolved {
+			stale = append(stale, table)
+		}
+	}
+	return resolved, stale, rows.Err()
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigratorSearchConfig(t *testing.T) {
+	_, migrator := migrateTestDatabase(t)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		if err := migrator.RebuildSearch(ctx, "english"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if err := migrator.RebuildSearch(ctx, "simple"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.CheckSearchConfig(ctx, "simple"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.CheckSearchConfig(ctx, "english"); err == nil {
+		t.Fatal("expected columns built with simple to fail the check for english")
+	}
+	if err := migrator.CheckSearchConfig(ctx, "no_such_config"); err == nil {
+		t.Fatal("expected an unknown configuration to fail the check")
+	}
+}
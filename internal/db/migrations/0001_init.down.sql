@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS votes, forum_users, posts, threads, forums, users CASCADE;
+
+DROP FUNCTION IF EXISTS set_threads_votes();
+DROP FUNCTION IF EXISTS update_threads_votes();
+DROP FUNCTION IF EXISTS update_post_path();
+DROP FUNCTION IF EXISTS count_forum_threads();
+DROP FUNCTION IF EXISTS count_forum_posts();
+DROP FUNCTION IF EXISTS update_forum_user();
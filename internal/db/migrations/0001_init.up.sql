@@ -65,6 +65,7 @@ CREATE OR REPLACE FUNCTION set_threads_votes() RETURNS TRIGGER AS $$
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS insert_votes ON votes;
 CREATE TRIGGER insert_votes AFTER INSERT ON votes FOR EACH ROW EXECUTE PROCEDURE set_threads_votes();
 
 
@@ -75,6 +76,7 @@ CREATE OR REPLACE FUNCTION update_threads_votes() RETURNS TRIGGER AS $$
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_votes ON votes;
 CREATE TRIGGER update_votes AFTER UPDATE ON votes FOR EACH ROW EXECUTE PROCEDURE update_threads_votes();
 
 
@@ -85,6 +87,7 @@ CREATE OR REPLACE FUNCTION update_post_path() RETURNS TRIGGER AS $$
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_path ON posts;
 CREATE TRIGGER update_path BEFORE INSERT ON posts FOR EACH ROW EXECUTE PROCEDURE update_post_path();
 
 
@@ -95,6 +98,7 @@ CREATE OR REPLACE FUNCTION count_forum_threads() RETURNS TRIGGER AS $$
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_count_threads ON threads;
 CREATE TRIGGER update_count_threads AFTER INSERT ON threads FOR EACH ROW EXECUTE PROCEDURE count_forum_threads();
 
 
@@ -105,6 +109,7 @@ CREATE OR REPLACE FUNCTION count_forum_posts() RETURNS TRIGGER AS $$
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_count_posts ON posts;
 CREATE TRIGGER update_count_posts AFTER INSERT ON posts FOR EACH ROW EXECUTE PROCEDURE count_forum_posts();
 
 
@@ -126,7 +131,9 @@ DECLARE
   END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_forum_users_on_post ON posts;
 CREATE TRIGGER update_forum_users_on_post AFTER INSERT ON posts FOR EACH ROW EXECUTE PROCEDURE update_forum_user();
+DROP TRIGGER IF EXISTS update_forum_users_on_thread ON threads;
 CREATE TRIGGER update_forum_users_on_thread AFTER INSERT ON threads FOR EACH ROW EXECUTE PROCEDURE update_forum_user();
 
 -- Indexes
@@ -148,5 +155,5 @@ CREATE INDEX IF NOT EXISTS forum_users_forum_hash ON forum_users (forum, nicknam
 CREATE UNIQUE INDEX IF NOT EXISTS votes_less ON votes (nickname, thread); -- VoteExists
 CREATE UNIQUE INDEX IF NOT EXISTS votes_more ON votes (nickname, thread, voice); -- UpdateVote
 
--- Vacuum for better performance
-VACUUM ANALYZE;
\ No newline at end of file
+-- Statistics for better plans, VACUUM is not allowed inside the migration transaction
+ANALYZE;
\ No newline at end of file
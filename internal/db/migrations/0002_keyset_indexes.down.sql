@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS post_thread_parent_id;
+DROP INDEX IF EXISTS post_thread_created_id;
+DROP INDEX IF EXISTS thread_forum_created_id;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS thread_forum_created_id ON threads (forum, created, id); -- GetForumThreadsPage
+CREATE INDEX IF NOT EXISTS post_thread_created_id ON posts (thread, created, id); -- GetPostsFlatPage
+CREATE INDEX IF NOT EXISTS post_thread_parent_id ON posts (thread, parent, id); -- GetPostsParentTreePage, root posts
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS thread_search_gin;
+DROP INDEX IF EXISTS post_search_gin;
+
+ALTER TABLE threads DROP COLUMN IF EXISTS search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
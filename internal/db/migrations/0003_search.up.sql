@@ -0,0 +1,9 @@
+-- The columns are rebuilt with service.search.language after the migrations, see Migrator.RebuildSearch.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', message)) STORED;
+
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', message), 'B')) STORED;
+
+CREATE INDEX IF NOT EXISTS post_search_gin ON posts USING gin (search); -- Search
+CREATE INDEX IF NOT EXISTS thread_search_gin ON threads USING gin (search); -- Search
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_uncount_posts ON posts;
+DROP FUNCTION IF EXISTS uncount_forum_posts();
+
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_at;
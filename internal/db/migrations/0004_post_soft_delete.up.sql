@@ -0,0 +1,21 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+
+-- Deleted posts stay in the tree but no longer count towards forums.posts.
+CREATE OR REPLACE FUNCTION uncount_forum_posts() RETURNS TRIGGER AS $$
+  BEGIN
+    IF TG_OP = 'UPDATE' THEN
+      IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        UPDATE forums SET posts = forums.posts - 1 WHERE slug = NEW.forum;
+      END IF;
+      RETURN NEW;
+    END IF;
+
+    IF OLD.deleted_at IS NULL THEN
+      UPDATE forums SET posts = forums.posts - 1 WHERE slug = OLD.forum;
+    END IF;
+    RETURN OLD;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_uncount_posts ON posts;
+CREATE TRIGGER update_uncount_posts AFTER UPDATE OF deleted_at OR DELETE ON posts FOR EACH ROW EXECUTE PROCEDURE uncount_forum_posts();
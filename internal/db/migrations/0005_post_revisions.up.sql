@@ -0,0 +1,11 @@
+-- Every edit of a post keeps the message it replaced. Revisions are numbered per post in id order.
+CREATE UNLOGGED TABLE IF NOT EXISTS post_revisions (
+  id bigserial NOT NULL PRIMARY KEY,
+  post bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  editor citext COLLATE "ucs_basic" NOT NULL REFERENCES users (nickname),
+  reason text NOT NULL DEFAULT '',
+  message text NOT NULL,
+  created timestamp with time zone DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS post_revisions_post_id ON post_revisions (post, id); -- GetPostRevisions
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS thread_forum_pinned_created_id_desc;
+DROP INDEX IF EXISTS thread_forum_pinned_created_id;
+CREATE INDEX IF NOT EXISTS thread_forum_created_id ON threads (forum, created, id);
+
+DROP TRIGGER IF EXISTS update_recount_threads ON threads;
+DROP FUNCTION IF EXISTS recount_forum_threads();
+
+ALTER TABLE threads DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE threads DROP COLUMN IF EXISTS pinned;
+ALTER TABLE threads DROP COLUMN IF EXISTS locked;
@@ -0,0 +1,23 @@
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS locked boolean NOT NULL DEFAULT FALSE;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS pinned boolean NOT NULL DEFAULT FALSE;
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+
+-- Deleted threads do not count towards forums.threads, restoring one counts it again.
+CREATE OR REPLACE FUNCTION recount_forum_threads() RETURNS TRIGGER AS $$
+  BEGIN
+    IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+      UPDATE forums SET threads = forums.threads - 1 WHERE slug = NEW.forum;
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+      UPDATE forums SET threads = forums.threads + 1 WHERE slug = NEW.forum;
+    END IF;
+    RETURN NEW;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_recount_threads ON threads;
+CREATE TRIGGER update_recount_threads AFTER UPDATE OF deleted_at ON threads FOR EACH ROW EXECUTE PROCEDURE recount_forum_threads();
+
+-- Pinned threads come first in both directions, so each direction needs its own index.
+DROP INDEX IF EXISTS thread_forum_created_id;
+CREATE INDEX IF NOT EXISTS thread_forum_pinned_created_id ON threads (forum, pinned DESC, created, id) WHERE deleted_at IS NULL; -- GetForumThreadsPage
+CREATE INDEX IF NOT EXISTS thread_forum_pinned_created_id_desc ON threads (forum, pinned, created, id) WHERE deleted_at IS NULL; -- GetForumThreadsPage, desc
@@ -0,0 +1,8 @@
+ALTER TABLE forum_users DROP CONSTRAINT IF EXISTS forum_users_forum_fkey,
+  ADD CONSTRAINT forum_users_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug);
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_forum_fkey,
+  ADD CONSTRAINT posts_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug);
+ALTER TABLE threads DROP CONSTRAINT IF EXISTS threads_forum_fkey,
+  ADD CONSTRAINT threads_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug);
+
+ALTER TABLE forums DROP COLUMN IF EXISTS archived_at;
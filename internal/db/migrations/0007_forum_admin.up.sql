@@ -0,0 +1,9 @@
+ALTER TABLE forums ADD COLUMN IF NOT EXISTS archived_at timestamp with time zone;
+
+-- Renaming a forum renames it everywhere its slug is copied to.
+ALTER TABLE threads DROP CONSTRAINT IF EXISTS threads_forum_fkey,
+  ADD CONSTRAINT threads_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug) ON UPDATE CASCADE;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_forum_fkey,
+  ADD CONSTRAINT posts_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug) ON UPDATE CASCADE;
+ALTER TABLE forum_users DROP CONSTRAINT IF EXISTS forum_users_forum_fkey,
+  ADD CONSTRAINT forum_users_forum_fkey FOREIGN KEY (forum) REFERENCES forums (slug) ON UPDATE CASCADE;
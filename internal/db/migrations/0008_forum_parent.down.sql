@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS forum_parent;
+
+ALTER TABLE forums DROP COLUMN IF EXISTS parent;
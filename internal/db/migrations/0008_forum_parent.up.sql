@@ -0,0 +1,4 @@
+-- Sub-forums outlive a purged parent as top-level forums.
+ALTER TABLE forums ADD COLUMN IF NOT EXISTS parent citext REFERENCES forums (slug) ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS forum_parent ON forums (parent); -- GetForumChildren
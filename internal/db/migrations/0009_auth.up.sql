@@ -0,0 +1,12 @@
+-- Users without a password can not log in.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash text;
+
+-- Session tokens are only honoured while their session exists, logging out deletes it.
+CREATE UNLOGGED TABLE IF NOT EXISTS sessions (
+  id text NOT NULL PRIMARY KEY,
+  nickname citext COLLATE "ucs_basic" NOT NULL REFERENCES users (nickname) ON DELETE CASCADE,
+  created timestamp with time zone NOT NULL DEFAULT now(),
+  expires timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS session_nickname ON sessions (nickname); -- CreateSession
@@ -0,0 +1,12 @@
+-- Users without a global role are members.
+CREATE UNLOGGED TABLE IF NOT EXISTS user_roles (
+  nickname citext COLLATE "ucs_basic" NOT NULL PRIMARY KEY REFERENCES users (nickname) ON DELETE CASCADE,
+  role text NOT NULL CHECK (role IN ('admin', 'banned'))
+);
+
+-- The owner of a forum moderates it without being listed here.
+CREATE UNLOGGED TABLE IF NOT EXISTS forum_moderators (
+  forum citext NOT NULL REFERENCES forums (slug) ON UPDATE CASCADE ON DELETE CASCADE,
+  nickname citext COLLATE "ucs_basic" NOT NULL REFERENCES users (nickname) ON DELETE CASCADE,
+  PRIMARY KEY (forum, nickname)
+);
@@ -0,0 +1,17 @@
+-- Only the SHA-256 of a key is kept, the key itself is shown once when it is created.
+-- Forums are kept by slug without references, so that purging a forum leaves the keys limited to it
+-- with nothing rather than unlimited; renames are carried over by UpdateForum.
+CREATE UNLOGGED TABLE IF NOT EXISTS api_keys (
+  id bigserial NOT NULL PRIMARY KEY,
+  nickname citext COLLATE "ucs_basic" NOT NULL REFERENCES users (nickname) ON DELETE CASCADE,
+  name text NOT NULL DEFAULT '',
+  prefix text NOT NULL,
+  hash text NOT NULL UNIQUE,
+  scopes text[] NOT NULL,
+  forums citext[] NOT NULL DEFAULT '{}',
+  created timestamp with time zone NOT NULL DEFAULT now(),
+  last_used timestamp with time zone,
+  revoked_at timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS api_key_nickname ON api_keys (nickname); -- GetAPIKeys
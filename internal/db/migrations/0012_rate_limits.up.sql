@@ -0,0 +1,8 @@
+-- Token buckets of the rate limiter, when they are shared by all instances. allowed tells whether
+-- the last request got a token.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+  key text NOT NULL PRIMARY KEY,
+  tokens double precision NOT NULL,
+  updated timestamp with time zone NOT NULL,
+  allowed boolean NOT NULL
+);
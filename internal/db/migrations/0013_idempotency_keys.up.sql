@@ -0,0 +1,13 @@
+-- Responses to requests sent with an Idempotency-Key header. status is NULL while the first request
+-- is in flight, its reservation expires after a short lease in case the instance serving it goes away.
+CREATE UNLOGGED TABLE IF NOT EXISTS idempotency_keys (
+  key text NOT NULL PRIMARY KEY,
+  fingerprint text NOT NULL,
+  status integer,
+  content_type text NOT NULL DEFAULT '',
+  body bytea,
+  created timestamp with time zone NOT NULL DEFAULT now(),
+  expires timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires ON idempotency_keys (expires); -- DeleteExpiredIdempotencyKeys
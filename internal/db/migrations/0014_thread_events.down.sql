@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS notify_update_votes ON threads;
+DROP TRIGGER IF EXISTS notify_update_post ON posts;
+DROP TRIGGER IF EXISTS notify_insert_post ON posts;
+DROP FUNCTION IF EXISTS notify_thread_votes();
+DROP FUNCTION IF EXISTS notify_post_event();
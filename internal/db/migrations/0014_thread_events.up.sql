@@ -0,0 +1,34 @@
+-- Changes to threads are announced on the thread_events channel, the API instances listening on it
+-- push them to the clients watching the thread. Notifications are sent on commit and only carry ids,
+-- listeners read the rows themselves.
+CREATE OR REPLACE FUNCTION notify_post_event() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('thread_events', json_build_object(
+      'thread', NEW.thread,
+      'kind', CASE WHEN TG_OP = 'INSERT' THEN 'post' ELSE 'edit' END,
+      'post', NEW.id
+    )::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_insert_post ON posts;
+CREATE TRIGGER notify_insert_post AFTER INSERT ON posts FOR EACH ROW EXECUTE PROCEDURE notify_post_event();
+
+DROP TRIGGER IF EXISTS notify_update_post ON posts;
+CREATE TRIGGER notify_update_post AFTER UPDATE OF message, deleted_at ON posts FOR EACH ROW
+  WHEN (OLD.message IS DISTINCT FROM NEW.message OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+  EXECUTE PROCEDURE notify_post_event();
+
+-- Votes reach threads.votes through the triggers on votes, so the total is announced from there.
+CREATE OR REPLACE FUNCTION notify_thread_votes() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('thread_events', json_build_object('thread', NEW.id, 'kind', 'votes', 'votes', NEW.votes)::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_update_votes ON threads;
+CREATE TRIGGER notify_update_votes AFTER UPDATE OF votes ON threads FOR EACH ROW
+  WHEN (OLD.votes IS DISTINCT FROM NEW.votes)
+  EXECUTE PROCEDURE notify_thread_votes();
@@ -0,0 +1,22 @@
+DROP TRIGGER IF EXISTS notify_update_user ON users;
+DROP TRIGGER IF EXISTS notify_insert_thread ON threads;
+DROP FUNCTION IF EXISTS notify_user_event();
+DROP FUNCTION IF EXISTS notify_thread_event();
+
+CREATE OR REPLACE FUNCTION notify_post_event() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('thread_events', json_build_object(
+      'thread', NEW.thread,
+      'kind', CASE WHEN TG_OP = 'INSERT' THEN 'post' ELSE 'edit' END,
+      'post', NEW.id
+    )::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_thread_votes() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('thread_events', json_build_object('thread', NEW.id, 'kind', 'votes', 'votes', NEW.votes)::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
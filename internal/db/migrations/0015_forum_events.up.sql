@@ -0,0 +1,42 @@
+-- The events of threads move to the forum_events channel, which also announces new threads and
+-- profile changes for the subscriptions of the gateway.
+CREATE OR REPLACE FUNCTION notify_post_event() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('forum_events', json_build_object(
+      'thread', NEW.thread,
+      'kind', CASE WHEN TG_OP = 'INSERT' THEN 'post' ELSE 'edit' END,
+      'post', NEW.id
+    )::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_thread_votes() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('forum_events', json_build_object('thread', NEW.id, 'kind', 'votes', 'votes', NEW.votes)::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_thread_event() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('forum_events', json_build_object('thread', NEW.id, 'kind', 'thread')::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_insert_thread ON threads;
+CREATE TRIGGER notify_insert_thread AFTER INSERT ON threads FOR EACH ROW EXECUTE PROCEDURE notify_thread_event();
+
+-- Only the public profile counts, password changes go unannounced.
+CREATE OR REPLACE FUNCTION notify_user_event() RETURNS TRIGGER AS $$
+  BEGIN
+    PERFORM pg_notify('forum_events', json_build_object('nickname', NEW.nickname, 'kind', 'user')::text);
+    RETURN NULL;
+  END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_update_user ON users;
+CREATE TRIGGER notify_update_user AFTER UPDATE OF fullname, about, email ON users FOR EACH ROW
+  WHEN ((OLD.fullname, OLD.about, OLD.email) IS DISTINCT FROM (NEW.fullname, NEW.about, NEW.email))
+  EXECUTE PROCEDURE notify_user_event();
@@ -7,25 +7,59 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/model/core"
 	"github.com/senago/technopark-dbms/internal/model/dto"
 )
 
+// DeletedPostMessage is shown in place of the message of a soft-deleted post.
+const DeletedPostMessage = "[deleted]"
+
 const (
+	postColumns      = "id, parent, author, message, is_edited, forum, thread, created, deleted_at, path"
+	querySelectPosts = "SELECT " + postColumns + " FROM posts"
+
 	queryCheckPostParent = "SELECT thread FROM posts WHERE id = $1;"
+	queryGetPostsThreads = "SELECT id, thread FROM posts WHERE id = ANY($1);"
 
-	queryGetPost       = "SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts WHERE id = $1;"
+	queryGetPost       = querySelectPosts + " WHERE id = $1;"
 	queryGetPostAuthor = "SELECT a.nickname, a.fullname, a.about, a.email FROM posts JOIN users a ON a.nickname = posts.author WHERE posts.id = $1;"
-	queryGetPostThread = "SELECT th.id, th.title, th.author, th.forum, th.message, th.votes, th.slug, th.created FROM posts JOIN threads th ON th.id = posts.thread WHERE posts.id = $1;"
-	queryGetPostForum  = "SELECT f.title, f.user, f.slug, f.posts, f.threads FROM posts JOIN forums f ON f.slug = posts.forum WHERE posts.id = $1;"
+	queryGetPostThread = "SELECT " + threadColumns + " FROM threads WHERE id = (SELECT thread FROM posts WHERE id = $1);"
+	queryGetPostForum  = "SELECT " + forumColumns + " FROM forums WHERE slug = (SELECT forum FROM posts WHERE id = $1);"
+
+	queryGetPostsFlatPage     = querySelectPosts + " WHERE thread = $1 AND (created, id) > ($2, $3) ORDER BY created, id LIMIT $4;"
+	queryGetPostsFlatPageDesc = querySelectPosts + " WHERE thread = $1 AND (created, id) < ($2, $3) ORDER BY created DESC, id DESC LIMIT $4;"
+
+	queryGetPostsTreePage     = querySelectPosts + " WHERE thread = $1 AND path > $2 ORDER BY path LIMIT $3;"
+	queryGetPostsTreePageDesc = querySelectPosts + " WHERE thread = $1 AND path < $2 ORDER BY path DESC LIMIT $3;"
+
+	queryGetPostsParentTreePage = querySelectPosts + `
+		WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 AND id > $2 ORDER BY id LIMIT $3)
+		ORDER BY path;`
+	queryGetPostsParentTreePageDesc = querySelectPosts + `
+		WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 AND id < $2 ORDER BY id DESC LIMIT $3)
+		ORDER BY path[1] DESC, path;`
+
+	queryDeletePost     = "UPDATE posts SET deleted_at = COALESCE(deleted_at, now()) WHERE id = $1 RETURNING " + postColumns + ";"
+	queryDeletePostTree = "DELETE FROM posts p USING posts root WHERE root.id = $1 AND p.thread = root.thread AND p.path[1:array_length(root.path, 1)] = root.path;"
+
+	queryMovePostTree = `UPDATE posts p SET thread = $2, parent = CASE WHEN p.id = root.id THEN 0 ELSE p.parent END, path = p.path[array_length(root.path, 1):]
+		FROM posts root WHERE root.id = $1 AND p.thread = root.thread AND p.path[1:array_length(root.path, 1)] = root.path;`
 
-	queryUpdatePost = "UPDATE posts SET message = $2, is_edited = true WHERE id = $1 RETURNING id, parent, author, message, is_edited, forum, thread, created;"
+	// queryUpdatePost edits a post and records the replaced message as a revision in one statement.
+	// The row lock makes concurrent edits of a post read each other's messages rather than the same one.
+	queryUpdatePost = `WITH previous AS (SELECT id AS previous_id, message AS previous_message FROM posts WHERE id = $1 FOR UPDATE),
+		updated AS (UPDATE posts SET message = $2, is_edited = true FROM previous WHERE id = previous_id RETURNING ` + postColumns + `, previous_message),
+		revision AS (INSERT INTO post_revisions (post, editor, reason, message) SELECT id, $3, $4, previous_message FROM updated)
+		SELECT ` + postColumns + ` FROM updated;`
+
+	queryGetPostRevisions = "SELECT row_number() OVER (ORDER BY id), post, editor, reason, message, created FROM post_revisions WHERE post = $1 ORDER BY id;"
 )
 
 type PostsRepository interface {
 	CreatePosts(ctx context.Context, forum string, thread int64, posts []*dto.PostData) ([]*core.Post, error)
 	CheckParentPost(ctx context.Context, parent int) (int, error)
+	GetPostsThreads(ctx context.Context, ids []int64) (map[int64]int64, error)
 
 	GetPostsFlat(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error)
 	GetPostsTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error)
@@ -33,11 +67,29 @@ type PostsRepository interface {
 	GetPostDetails(ctx context.Context, id int64, related string) (*dto.PostDetails, error)
 	GetPostByID(ctx context.Context, id int64) (*core.Post, error)
 
-	UpdatePost(ctx context.Context, id int64, message string) (*core.Post, error)
+	// The page methods continue a listing strictly after the given row, which need not exist anymore; tree pages
+	// continue after after.Path, parent_tree pages are counted in root posts and after.ID is the last root of the previous page.
+	GetPostsFlatPage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error)
+	GetPostsTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error)
+	GetPostsParentTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error)
+
+	// UpdatePost replaces the message of a post, keeping the previous one as a revision by editor.
+	UpdatePost(ctx context.Context, id int64, message, editor, reason string) (*core.Post, error)
+	// GetPostRevisions lists the revisions of a post, oldest first.
+	GetPostRevisions(ctx context.Context, id int64) ([]*core.PostRevision, error)
+
+	// DeletePost soft-deletes a post: the row keeps its place in the tree, but its message is no longer shown.
+	// Deleting a deleted post changes nothing.
+	DeletePost(ctx context.Context, id int64) (*core.Post, error)
+	// MovePostTree moves a post along with all of its replies into another thread, where the post becomes a root post.
+	// It returns the number of moved posts.
+	MovePostTree(ctx context.Context, id int64, thread int64) (int64, error)
+	// DeletePostTree removes a post along with all of its replies and returns the number of removed posts.
+	DeletePostTree(ctx context.Context, id int64) (int64, error)
 }
 
 type postsRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *postsRepositoryImpl) CreatePosts(ctx context.Context, forum string, thread int64, posts []*dto.PostData) ([]*core.Post, error) {
@@ -79,135 +131,120 @@ func (repo *postsRepositoryImpl) CheckParentPost(ctx context.Context, parent int
 	return threadID, wrapErr(err)
 }
 
-func (repo *postsRepositoryImpl) GetPostsFlat(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
-	query := "SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts WHERE thread = $1 "
-
-	if since != -1 {
-		if desc {
-			query += "AND id < $2 "
-		} else {
-			query += "AND id > $2 "
-		}
-	}
-
-	if desc {
-		query += "ORDER BY created DESC, id DESC "
-	} else {
-		query += "ORDER BY created ASC, id ASC "
-	}
-
-	query += fmt.Sprintf("LIMIT %d ", limit)
-
-	var rows pgx.Rows
-	var err error
-	if since == -1 {
-		rows, err = repo.dbConn.Query(ctx, query, id)
-	} else {
-		rows, err = repo.dbConn.Query(ctx, query, id, since)
-	}
+// GetPostsThreads maps each of the given post ids to the thread it belongs to.
+// Ids of posts that do not exist are absent from the result.
+func (repo *postsRepositoryImpl) GetPostsThreads(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetPostsThreads, ids)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	posts := make([]*core.Post, 0, rows.CommandTag().RowsAffected())
+	threads := make(map[int64]int64, len(ids))
 	for rows.Next() {
-		post := &core.Post{}
-		if err := rows.Scan(&post.ID, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created); err != nil {
+		var id, thread int64
+		if err := rows.Scan(&id, &thread); err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		threads[id] = thread
+	}
+
+	return threads, rows.Err()
+}
+
+func (repo *postsRepositoryImpl) GetPostsFlat(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	q := newSelectQuery(querySelectPosts).where("thread = ?", id)
+	if since != -1 {
+		if desc {
+			q.where("id < ?", since)
+		} else {
+			q.where("id > ?", since)
+		}
 	}
+	query, args := q.orderBy(desc, "created", "id").limit(limit).build()
 
-	return posts, err
+	return repo.queryPosts(ctx, query, args...)
 }
 
 func (repo *postsRepositoryImpl) GetPostsTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
-	query := "SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts WHERE thread = $1 "
+	q := newSelectQuery(querySelectPosts).where("thread = ?", id)
+	if since != -1 {
+		if desc {
+			q.where("path < (SELECT path FROM posts WHERE id = ?)", since)
+		} else {
+			q.where("path > (SELECT path FROM posts WHERE id = ?)", since)
+		}
+	}
+	q.orderBy(desc, "path", "id")
+	if limit > 0 {
+		q.limit(limit)
+	}
+	query, args := q.build()
+
+	return repo.queryPosts(ctx, query, args...)
+}
 
+func (repo *postsRepositoryImpl) GetPostsParentTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
+	roots := newSelectQuery("SELECT id FROM posts").where("thread = ?", id).where("parent = 0")
 	if since != -1 {
 		if desc {
-			query += "and path < "
+			roots.where("path[1] < (SELECT path[1] FROM posts WHERE id = ?)", since)
 		} else {
-			query += "and path > "
+			roots.where("path[1] > (SELECT path[1] FROM posts WHERE id = ?)", since)
 		}
-		query += fmt.Sprintf("(SELECT path FROM posts WHERE id = %d) ", since)
 	}
+	roots.orderBy(desc, "id").limit(limit)
 
+	q := newSelectQuery(querySelectPosts).whereIn("path[1]", roots)
 	if desc {
-		query += "ORDER BY path desc "
-	} else {
-		query += "ORDER BY path asc, id "
+		q.orderBy(desc, "path[1]")
 	}
+	query, args := q.orderBy(false, "path", "id").build()
 
-	query += fmt.Sprintf("LIMIT NULLIF(%d, 0) ", limit)
+	return repo.queryPosts(ctx, query, args...)
+}
 
-	rows, err := repo.dbConn.Query(ctx, query, id)
-	if err != nil {
-		return nil, err
+func (repo *postsRepositoryImpl) GetPostsFlatPage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	query := queryGetPostsFlatPage
+	if desc {
+		query = queryGetPostsFlatPageDesc
 	}
-	defer rows.Close()
+	return repo.queryPosts(ctx, query, thread, after.Created, after.ID, limit)
+}
 
-	posts := make([]*core.Post, 0, rows.CommandTag().RowsAffected())
-	for rows.Next() {
-		post := &core.Post{}
-		if err := rows.Scan(&post.ID, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created); err != nil {
-			return nil, err
-		}
-		posts = append(posts, post)
+func (repo *postsRepositoryImpl) GetPostsTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	query := queryGetPostsTreePage
+	if desc {
+		query = queryGetPostsTreePageDesc
 	}
-
-	return posts, nil
+	return repo.queryPosts(ctx, query, thread, after.Path, limit)
 }
 
-func (repo *postsRepositoryImpl) GetPostsParentTree(ctx context.Context, id int, since int64, desc bool, limit int64) ([]*core.Post, error) {
-	var rows pgx.Rows
-	var err error
-	if since == -1 {
-		if desc {
-			rows, err = repo.dbConn.Query(ctx,
-				` SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts
-					WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 ORDER BY id DESC LIMIT $2)
-					ORDER BY path[1] DESC, path ASC, id ASC;`,
-				id, limit)
-		} else {
-			rows, err = repo.dbConn.Query(ctx,
-				`	SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts
-					WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 ORDER BY id ASC LIMIT $2)
-					ORDER BY path ASC, id ASC;`,
-				id, limit)
-		}
-	} else {
-		if desc {
-			rows, err = repo.dbConn.Query(ctx,
-				` SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts
-					WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 AND path[1] < (SELECT path[1] FROM posts WHERE id = $2)
-					ORDER BY id DESC LIMIT $3) ORDER BY path[1] DESC, path ASC, id ASC;`,
-				id, since, limit)
-		} else {
-			rows, err = repo.dbConn.Query(ctx,
-				` SELECT id, parent, author, message, is_edited, forum, thread, created FROM posts
-					WHERE path[1] IN (SELECT id FROM posts WHERE thread = $1 AND parent = 0 AND path[1] >
-					(SELECT path[1] FROM posts WHERE id = $2) ORDER BY id ASC LIMIT $3) 
-					ORDER BY path ASC, id ASC;`,
-				id, since, limit)
-		}
+func (repo *postsRepositoryImpl) GetPostsParentTreePage(ctx context.Context, thread int64, limit int64, after *Keyset, desc bool) ([]*core.Post, error) {
+	query := queryGetPostsParentTreePage
+	if desc {
+		query = queryGetPostsParentTreePageDesc
 	}
+	return repo.queryPosts(ctx, query, thread, after.ID, limit)
+}
+
+func (repo *postsRepositoryImpl) queryPosts(ctx context.Context, query string, args ...any) ([]*core.Post, error) {
+	rows, err := repo.dbConn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	posts := make([]*core.Post, 0, rows.CommandTag().RowsAffected())
+	posts := []*core.Post{}
 	for rows.Next() {
-		post := &core.Post{}
-		if err := rows.Scan(&post.ID, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created); err != nil {
+		post, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
 		posts = append(posts, post)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
 }
 
 func (repo *postsRepositoryImpl) GetPostDetails(ctx context.Context, id int64, related string) (*dto.PostDetails, error) {
@@ -223,17 +260,14 @@ func (repo *postsRepositoryImpl) GetPostDetails(ctx context.Context, id int64, r
 
 			postDetails.Author = author
 		case "thread":
-			thread := &core.Thread{}
-			err := repo.dbConn.QueryRow(ctx, queryGetPostThread, id).
-				Scan(&thread.ID, &thread.Title, &thread.Author, &thread.Forum, &thread.Message, &thread.Votes, &thread.Slug, &thread.Created)
+			thread, err := scanThread(repo.dbConn.QueryRow(ctx, queryGetPostThread, id))
 			if err != nil {
 				return nil, wrapErr(err)
 			}
 
 			postDetails.Thread = thread
 		case "forum":
-			forum := &core.Forum{}
-			err := repo.dbConn.QueryRow(ctx, queryGetPostForum, id).Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
+			forum, err := scanForum(repo.dbConn.QueryRow(ctx, queryGetPostForum, id))
 			if err != nil {
 				return nil, wrapErr(err)
 			}
@@ -245,23 +279,87 @@ func (repo *postsRepositoryImpl) GetPostDetails(ctx context.Context, id int64, r
 }
 
 func (repo *postsRepositoryImpl) GetPostByID(ctx context.Context, id int64) (*core.Post, error) {
-	post := &core.Post{}
-	err := repo.dbConn.QueryRow(ctx, queryGetPost, id).
-		Scan(&post.ID, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created)
-	return post, wrapErr(err)
+	post, err := scanPost(repo.dbConn.QueryRow(ctx, queryGetPost, id))
+	if err != nil {
+		return &core.Post{}, wrapErr(err)
+	}
+	return post, nil
 }
 
-func (repo *postsRepositoryImpl) UpdatePost(ctx context.Context, id int64, message string) (*core.Post, error) {
-	post := &core.Post{}
-	err := repo.dbConn.QueryRow(ctx, queryUpdatePost, id, message).
-		Scan(&post.ID, &post.Parent, &post.Author, &post.Message,
-			&post.IsEdited, &post.Forum, &post.Thread, &post.Created)
+func (repo *postsRepositoryImpl) UpdatePost(ctx context.Context, id int64, message, editor, reason string) (*core.Post, error) {
+	post, err := scanPost(repo.dbConn.QueryRow(ctx, queryUpdatePost, id, message, editor, reason))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return post, nil
+}
+
+func (repo *postsRepositoryImpl) GetPostRevisions(ctx context.Context, id int64) ([]*core.PostRevision, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetPostRevisions, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*core.PostRevision{}
+	for rows.Next() {
+		r := &core.PostRevision{}
+		if err := rows.Scan(&r.Number, &r.Post, &r.Editor, &r.Reason, &r.Message, &r.Created); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (repo *postsRepositoryImpl) DeletePost(ctx context.Context, id int64) (*core.Post, error) {
+	post, err := scanPost(repo.dbConn.QueryRow(ctx, queryDeletePost, id))
 	if err != nil {
 		return nil, wrapErr(err)
 	}
 	return post, nil
 }
 
-func NewPostsRepository(dbConn *customtypes.DBConn) *postsRepositoryImpl {
+func (repo *postsRepositoryImpl) MovePostTree(ctx context.Context, id int64, thread int64) (int64, error) {
+	tag, err := repo.dbConn.Exec(ctx, queryMovePostTree, id, thread)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, constants.ErrDBNotFound
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (repo *postsRepositoryImpl) DeletePostTree(ctx context.Context, id int64) (int64, error) {
+	tag, err := repo.dbConn.Exec(ctx, queryDeletePostTree, id)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, constants.ErrDBNotFound
+	}
+	return tag.RowsAffected(), nil
+}
+
+// scanPost reads a row of postColumns.
+func scanPost(row pgx.Row) (*core.Post, error) {
+	post := &core.Post{}
+	if err := row.Scan(&post.ID, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created, &post.DeletedAt, &post.Path); err != nil {
+		return nil, err
+	}
+	tombstone(post)
+	return post, nil
+}
+
+// tombstone hides the message of a deleted post behind DeletedPostMessage.
+func tombstone(post *core.Post) {
+	if post.DeletedAt != nil {
+		post.Message = DeletedPostMessage
+	}
+}
+
+func NewPostsRepository(dbConn querier) *postsRepositoryImpl {
 	return &postsRepositoryImpl{dbConn: dbConn}
 }
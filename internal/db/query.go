@@ -0,0 +1,105 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// selectQuery composes a SELECT statement out of SQL fragments written in this package and values supplied by callers.
+// Fragments mark every value with a ? placeholder, which build numbers positionally, so values never become part of
+// the statement text and can not change its structure. Fragments themselves must never be derived from input.
+type selectQuery struct {
+	sql      strings.Builder
+	args     []any
+	hasWhere bool
+	hasOrder bool
+}
+
+// newSelectQuery starts a query with base, which may hold placeholders for args.
+func newSelectQuery(base string, args ...any) *selectQuery {
+	q := &selectQuery{args: args}
+	q.sql.WriteString(base)
+	return q
+}
+
+// unionAll joins the queries with UNION ALL, for use as a fragment of another query.
+func unionAll(parts ...*selectQuery) (string, []any) {
+	texts := make([]string, 0, len(parts))
+	args := []any{}
+	for _, part := range parts {
+		texts = append(texts, part.sql.String())
+		args = append(args, part.args...)
+	}
+	return strings.Join(texts, " UNION ALL "), args
+}
+
+// where adds a condition, joined to the previous ones with AND.
+func (q *selectQuery) where(cond string, args ...any) *selectQuery {
+	if q.hasWhere {
+		q.sql.WriteString(" AND ")
+	} else {
+		q.sql.WriteString(" WHERE ")
+		q.hasWhere = true
+	}
+	q.sql.WriteString(cond)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// whereIn adds a condition that expr belongs to the result of the subquery.
+func (q *selectQuery) whereIn(expr string, sub *selectQuery) *selectQuery {
+	return q.where(expr+" IN ("+sub.sql.String()+")", sub.args...)
+}
+
+// orderBy appends sort expressions, each in the given direction unless it specifies its own.
+func (q *selectQuery) orderBy(desc bool, exprs ...string) *selectQuery {
+	for _, expr := range exprs {
+		if q.hasOrder {
+			q.sql.WriteString(", ")
+		} else {
+			q.sql.WriteString(" ORDER BY ")
+			q.hasOrder = true
+		}
+		q.sql.WriteString(expr)
+		if !strings.HasSuffix(expr, " ASC") && !strings.HasSuffix(expr, " DESC") {
+			q.sql.WriteString(sortDirection(desc))
+		}
+	}
+	return q
+}
+
+func (q *selectQuery) limit(limit int64) *selectQuery {
+	q.sql.WriteString(" LIMIT ?")
+	q.args = append(q.args, limit)
+	return q
+}
+
+// build returns the statement with its placeholders numbered, along with the values to bind to them.
+func (q *selectQuery) build() (string, []any) {
+	text := q.sql.String()
+
+	sql := strings.Builder{}
+	sql.Grow(len(text) + len(q.args))
+	n := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '?' {
+			sql.WriteByte(text[i])
+			continue
+		}
+		n++
+		sql.WriteByte('$')
+		sql.WriteString(strconv.Itoa(n))
+	}
+	if n != len(q.args) {
+		panic("db: " + strconv.Itoa(n) + " placeholders for " + strconv.Itoa(len(q.args)) + " arguments in: " + text)
+	}
+
+	return sql.String(), q.args
+}
+
+func sortDirection(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
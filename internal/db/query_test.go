@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var errRecorded = errors.New("recorded")
+
+// recordingQuerier records the statements it is given instead of running them.
+type recordingQuerier struct {
+	sql  string
+	args []any
+}
+
+func (q *recordingQuerier) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q.sql, q.args = sql, args
+	return pgconn.CommandTag{}, errRecorded
+}
+
+func (q *recordingQuerier) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.sql, q.args = sql, args
+	return nil, errRecorded
+}
+
+func (q *recordingQuerier) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	q.sql, q.args = sql, args
+	return recordedRow{}
+}
+
+type recordedRow struct{}
+
+func (recordedRow) Scan(...any) error {
+	return errRecorded
+}
+
+var placeholder = regexp.MustCompile(`\$[0-9]+`)
+
+// record returns the statement that call sends to the database.
+func record(t *testing.T, call func(querier) error) (string, []any) {
+	t.Helper()
+	q := &recordingQuerier{}
+	if err := call(q); !errors.Is(err, errRecorded) {
+		t.Fatalf("expected the statement to reach the database, got %v", err)
+	}
+	if n := len(placeholder.FindAllString(q.sql, -1)); n != len(q.args) {
+		t.Fatalf("%d placeholders for %d arguments in: %s", n, len(q.args), q.sql)
+	}
+	return q.sql, q.args
+}
+
+// checkStructure compares the statement built from hostile input with the one built from benign input of the
+// same shape, the values may only ever show up among the arguments.
+func checkStructure(t *testing.T, hostile, benign func(querier) error, values ...string) {
+	t.Helper()
+	got, args := record(t, hostile)
+	want, _ := record(t, benign)
+	if got != want {
+		t.Fatalf("the input changed the statement:\n got: %s\nwant: %s", got, want)
+	}
+	for _, value := range values {
+		if value != "" && !containsArg(args, value) {
+			t.Fatalf("%q is not among the arguments %v", value, args)
+		}
+	}
+}
+
+func containsArg(args []any, value string) bool {
+	for _, arg := range args {
+		if arg == value {
+			return true
+		}
+	}
+	return false
+}
+
+var hostileStrings = []string{
+	"",
+	"alice",
+	"'; DROP TABLE users; --",
+	"?",
+	"$1",
+	"a' OR '1'='1",
+	") UNION SELECT password FROM users --",
+	"\x00",
+}
+
+func FuzzGetForumUsers(f *testing.F) {
+	for _, s := range hostileStrings {
+		f.Add("forum", s, int64(100), false)
+		f.Add(s, s, int64(-1), true)
+	}
+	f.Fuzz(func(t *testing.T, slug, since string, limit int64, desc bool) {
+		benignSince := ""
+		if since != "" {
+			benignSince = "since"
+		}
+		checkStructure(t,
+			func(q querier) error {
+				_, err := NewForumRepository(q).GetForumUsers(context.Background(), slug, limit, since, desc)
+				return err
+			},
+			func(q querier) error {
+				_, err := NewForumRepository(q).GetForumUsers(context.Background(), "forum", 1, benignSince, desc)
+				return err
+			},
+			slug, since,
+		)
+	})
+}
+
+func FuzzGetForumThreads(f *testing.F) {
+	for _, s := range hostileStrings {
+		f.Add("forum", s, int64(100), false)
+		f.Add(s, s, int64(0), true)
+	}
+	f.Fuzz(func(t *testing.T, slug, since string, limit int64, desc bool) {
+		benignSince, benignLimit := "", int64(0)
+		if since != "" {
+			benignSince = "2022-01-01T00:00:00Z"
+		}
+		if limit > 0 {
+			benignLimit = 1
+		}
+		checkStructure(t,
+			func(q querier) error {
+				_, err := NewForumRepository(q).GetForumThreads(context.Background(), slug, limit, since, desc)
+				return err
+			},
+			func(q querier) error {
+				_, err := NewForumRepository(q).GetForumThreads(context.Background(), "forum", benignLimit, benignSince, desc)
+				return err
+			},
+			slug, since,
+		)
+	})
+}
+
+func FuzzGetPosts(f *testing.F) {
+	f.Add(1, int64(-1), int64(100), false)
+	f.Add(-1, int64(0), int64(0), true)
+	f.Add(1<<31, int64(1)<<62, int64(-1), true)
+	f.Fuzz(func(t *testing.T, thread int, since, limit int64, desc bool) {
+		benignSince, benignLimit := int64(-1), int64(0)
+		if since != -1 {
+			benignSince = 1
+		}
+		if limit > 0 {
+			benignLimit = 1
+		}
+
+		type getPosts func(repo *postsRepositoryImpl, thread int, since int64, desc bool, limit int64) error
+		sorts := map[string]getPosts{
+			"flat": func(repo *postsRepositoryImpl, thread int, since int64, desc bool, limit int64) error {
+				_, err := repo.GetPostsFlat(context.Background(), thread, since, desc, limit)
+				return err
+			},
+			"tree": func(repo *postsRepositoryImpl, thread int, since int64, desc bool, limit int64) error {
+				_, err := repo.GetPostsTree(context.Background(), thread, since, desc, limit)
+				return err
+			},
+			"parent_tree": func(repo *postsRepositoryImpl, thread int, since int64, desc bool, limit int64) error {
+				_, err := repo.GetPostsParentTree(context.Background(), thread, since, desc, limit)
+				return err
+			},
+		}
+		for name, get := range sorts {
+			t.Run(name, func(t *testing.T) {
+				// GetPostsFlat and GetPostsParentTree always limit, GetPostsTree only when asked to.
+				benign := benignLimit
+				if name != "tree" {
+					benign = 1
+				}
+				checkStructure(t,
+					func(q querier) error { return get(NewPostsRepository(q), thread, since, desc, limit) },
+					func(q querier) error { return get(NewPostsRepository(q), 1, benignSince, desc, benign) },
+				)
+			})
+		}
+	})
+}
+
+// FuzzSelectQueryBuild checks that build numbers the placeholders of any combination of fragments without
+// reaching its panic, and that values never end up in the statement.
+func FuzzSelectQueryBuild(f *testing.F) {
+	for _, s := range hostileStrings {
+		f.Add(s, int64(10), true, true)
+	}
+	f.Fuzz(func(t *testing.T, value string, limit int64, desc, nested bool) {
+		q := newSelectQuery("SELECT id FROM posts").where("thread = ?", value)
+		if nested {
+			sub := newSelectQuery("SELECT id FROM posts").where("author = ?", value).limit(limit)
+			q.whereIn("parent", sub)
+		}
+		query, args := q.orderBy(desc, "created", "id DESC").limit(limit).build()
+
+		if n := len(placeholder.FindAllString(query, -1)); n != len(args) {
+			t.Fatalf("%d placeholders for %d arguments in: %s", n, len(args), query)
+		}
+		if strings.Contains(query, "?") {
+			t.Fatalf("unnumbered placeholder left in: %s", query)
+		}
+		if !containsArg(args, value) {
+			t.Fatalf("%q is not among the arguments %v", value, args)
+		}
+	})
+}
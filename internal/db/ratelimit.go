@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+)
+
+const (
+	// rateLimitRefill is the number of tokens in a bucket before one is taken: $2 is the rate and $3 the burst.
+	// The clock of the database is used, which all instances share.
+	rateLimitRefill = "LEAST($3::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated)::float8 * $2::float8)"
+
+	queryTakeRateLimitToken = `INSERT INTO rate_limits AS b (key, tokens, updated, allowed) VALUES ($1, $3::float8 - 1, now(), true)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN ` + rateLimitRefill + ` >= 1 THEN ` + rateLimitRefill + ` - 1 ELSE ` + rateLimitRefill + ` END,
+			allowed = ` + rateLimitRefill + ` >= 1,
+			updated = now()
+		RETURNING allowed, tokens;`
+
+	queryDeleteIdleRateLimits = "DELETE FROM rate_limits WHERE updated < now() - make_interval(secs => $1);"
+)
+
+// RateLimitRepository is the ratelimit.Store that shares buckets between the instances of the service.
+type RateLimitRepository interface {
+	ratelimit.Sweeper
+}
+
+type rateLimitRepositoryImpl struct {
+	dbConn querier
+}
+
+func (repo *rateLimitRepositoryImpl) Take(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	var allowed bool
+	var tokens float64
+	if err := repo.dbConn.QueryRow(ctx, queryTakeRateLimitToken, key, limit.Rate, limit.Burst).Scan(&allowed, &tokens); err != nil {
+		return false, 0, err
+	}
+	if allowed {
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - tokens) / limit.Rate * float64(time.Second)), nil
+}
+
+func (repo *rateLimitRepositoryImpl) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	tag, err := repo.dbConn.Exec(ctx, queryDeleteIdleRateLimits, idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func NewRateLimitRepository(dbConn querier) *rateLimitRepositoryImpl {
+	return &rateLimitRepositoryImpl{dbConn: dbConn}
+}
@@ -1,6 +1,9 @@
 package db
 
 import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 )
 
@@ -11,18 +14,58 @@ type Repository struct {
 	PostsRepository       PostsRepository
 	VotesRepository       VotesRepository
 	ServiceRepository     ServiceRepository
+	SearchRepository      SearchRepository
+	SessionRepository     SessionRepository
+	RoleRepository        RoleRepository
+	APIKeyRepository      APIKeyRepository
+	RateLimitRepository   RateLimitRepository
+	IdempotencyRepository IdempotencyRepository
+	EventsRepository      EventsRepository
+
+	// runTx is provided by the backend the repositories were built for, see WithTxOptions.
+	runTx func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error
 }
 
 func NewRepository(dbConn *customtypes.DBConn) (*Repository, error) {
-	repository := &Repository{}
+	repository := &Repository{runTx: pgTxRunner(dbConn)}
 
-	repository.UserRepository = NewUserRepository(dbConn)
-	repository.ForumRepository = NewForumRepository(dbConn)
-	repository.ForumThreadRepository = NewForumThreadRepository(dbConn)
-	repository.PostsRepository = NewPostsRepository(dbConn)
-	repository.VotesRepository = NewVotesRepository(dbConn)
-	repository.VotesRepository = NewVotesRepository(dbConn)
-	repository.ServiceRepository = NewServiceRepository(dbConn)
+	conn := &tracingQuerier{querier: &cancelingQuerier{dbConn: dbConn}}
+	repository.UserRepository = NewUserRepository(conn)
+	repository.ForumRepository = NewForumRepository(conn)
+	repository.ForumThreadRepository = NewForumThreadRepository(conn)
+	repository.PostsRepository = NewPostsRepository(conn)
+	repository.VotesRepository = NewVotesRepository(conn)
+	repository.ServiceRepository = NewServiceRepository(conn)
+	repository.SearchRepository = NewSearchRepository(conn)
+	repository.SessionRepository = NewSessionRepository(conn)
+	repository.RoleRepository = NewRoleRepository(conn)
+	repository.APIKeyRepository = NewAPIKeyRepository(conn)
+	repository.RateLimitRepository = NewRateLimitRepository(conn)
+	repository.IdempotencyRepository = NewIdempotencyRepository(conn)
+	repository.EventsRepository = NewEventsRepository(dbConn)
 
 	return repository, nil
 }
+
+// newTxRepository builds the repositories of a transaction, events are listened to outside of it on dbConn.
+func newTxRepository(tx pgx.Tx, dbConn *customtypes.DBConn) *Repository {
+	repository := &Repository{}
+	repository.runTx = joinTx(repository)
+	conn := &tracingQuerier{querier: tx}
+
+	repository.UserRepository = NewUserRepository(conn)
+	repository.ForumRepository = NewForumRepository(conn)
+	repository.ForumThreadRepository = NewForumThreadRepository(conn)
+	repository.PostsRepository = NewPostsRepository(conn)
+	repository.VotesRepository = NewVotesRepository(conn)
+	repository.ServiceRepository = NewServiceRepository(conn)
+	repository.SearchRepository = NewSearchRepository(conn)
+	repository.SessionRepository = NewSessionRepository(conn)
+	repository.RoleRepository = NewRoleRepository(conn)
+	repository.APIKeyRepository = NewAPIKeyRepository(conn)
+	repository.RateLimitRepository = NewRateLimitRepository(conn)
+	repository.IdempotencyRepository = NewIdempotencyRepository(conn)
+	repository.EventsRepository = NewEventsRepository(dbConn)
+
+	return repository
+}
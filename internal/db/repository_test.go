@@ -0,0 +1,467 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	"github.com/senago/technopark-dbms/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// testDatabaseEnvVar names a database the contract tests may wipe. Without it they only run against the
+// in-memory backend, with it the same cases show that the in-memory backend matches Postgres.
+const testDatabaseEnvVar = "TEST_DATABASE_URL"
+
+// runContract runs test against an empty repository of every backend that is available.
+func runContract(t *testing.T, test func(t *testing.T, repo *Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		repo, err := NewMemoryRepository()
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, repo)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dbPool, _ := migrateTestDatabase(t)
+		repo, err := NewRepository(dbPool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.ServiceRepository.Delete(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		test(t, repo)
+	})
+}
+
+// migrateTestDatabase connects to the test database and applies the migrations, or skips the test without one.
+func migrateTestDatabase(t *testing.T) (*pgxpool.Pool, *Migrator) {
+	t.Helper()
+	url := os.Getenv(testDatabaseEnvVar)
+	if url == "" {
+		t.Skip(testDatabaseEnvVar + " is not set")
+	}
+	ctx := context.Background()
+	dbPool, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dbPool.Close)
+
+	migrator, err := NewMigrator(zap.NewNop().Sugar(), dbPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return dbPool, migrator
+}
+
+// seed creates the users, a forum and a thread most cases need.
+func seed(t *testing.T, repo *Repository) *core.Thread {
+	t.Helper()
+	ctx := context.Background()
+	for _, nickname := range []string{"Alice", "bob", "Carol"} {
+		user := &core.User{Nickname: nickname, Fullname: nickname, Email: nickname + "@example.com"}
+		if err := repo.UserRepository.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.ForumRepository.CreateForum(ctx, &core.Forum{Title: "Forum", User: "alice", Slug: "Frm"}); err != nil {
+		t.Fatal(err)
+	}
+	thread, err := repo.ForumThreadRepository.CreateForumThread(ctx, &core.Thread{
+		Title: "Thread", Author: "carol", Forum: "frm", Message: "first", Slug: "Th1", Created: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
+
+func createPosts(t *testing.T, repo *Repository, thread *core.Thread, posts ...*dto.PostData) []*core.Post {
+	t.Helper()
+	created, err := repo.PostsRepository.CreatePosts(context.Background(), thread.Forum, thread.ID, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func postIDs(posts []*core.Post) []int64 {
+	ids := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+func TestRepositoryCitext(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+
+		user, err := repo.UserRepository.GetUserByNickname(ctx, "ALICE")
+		if err != nil || user.Nickname != "Alice" {
+			t.Fatalf("looking up ALICE: %v, %v", user, err)
+		}
+		if user, err := repo.UserRepository.GetUserByEmail(ctx, "BOB@EXAMPLE.COM"); err != nil || user.Nickname != "bob" {
+			t.Fatalf("looking up BOB@EXAMPLE.COM: %v, %v", user, err)
+		}
+		err = repo.UserRepository.CreateUser(ctx, &core.User{Nickname: "aLiCe", Email: "other@example.com"})
+		if !isPgError(err, pgUniqueViolation) {
+			t.Fatalf("expected a unique violation for aLiCe, got %v", err)
+		}
+
+		if forum, err := repo.ForumRepository.GetForumBySlug(ctx, "FRM"); err != nil || forum.Slug != "Frm" {
+			t.Fatalf("looking up FRM: %v, %v", forum, err)
+		}
+		if found, err := repo.ForumThreadRepository.GetForumThreadBySlug(ctx, "th1"); err != nil || found.ID != thread.ID {
+			t.Fatalf("looking up th1: %v, %v", found, err)
+		}
+		if _, err := repo.UserRepository.GetUserByNickname(ctx, "nobody"); !errors.Is(err, constants.ErrDBNotFound) {
+			t.Fatalf("expected ErrDBNotFound for nobody, got %v", err)
+		}
+	})
+}
+
+func TestRepositoryPostPaths(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+
+		roots := createPosts(t, repo, thread, &dto.PostData{Author: "alice", Message: "a"}, &dto.PostData{Author: "bob", Message: "b"})
+		reply := createPosts(t, repo, thread, &dto.PostData{Parent: roots[0].ID, Author: "bob", Message: "a.1"})[0]
+		nested := createPosts(t, repo, thread, &dto.PostData{Parent: reply.ID, Author: "carol", Message: "a.1.1"})[0]
+		late := createPosts(t, repo, thread, &dto.PostData{Parent: roots[0].ID, Author: "carol", Message: "a.2"})[0]
+
+		tree, err := repo.PostsRepository.GetPostsTree(ctx, int(thread.ID), -1, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int64{roots[0].ID, reply.ID, nested.ID, late.ID, roots[1].ID}
+		if got := postIDs(tree); !equalIDs(got, want) {
+			t.Fatalf("tree order %v, want %v", got, want)
+		}
+
+		tree, err = repo.PostsRepository.GetPostsTree(ctx, int(thread.ID), nested.ID, true, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(tree), []int64{reply.ID, roots[0].ID}; !equalIDs(got, want) {
+			t.Fatalf("descending tree since %d: %v, want %v", nested.ID, got, want)
+		}
+
+		parentTree, err := repo.PostsRepository.GetPostsParentTree(ctx, int(thread.ID), -1, true, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(parentTree), []int64{roots[1].ID}; !equalIDs(got, want) {
+			t.Fatalf("descending parent tree: %v, want %v", got, want)
+		}
+		parentTree, err = repo.PostsRepository.GetPostsParentTree(ctx, int(thread.ID), roots[1].ID, true, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(parentTree), []int64{roots[0].ID, reply.ID, nested.ID, late.ID}; !equalIDs(got, want) {
+			t.Fatalf("descending parent tree since %d: %v, want %v", roots[1].ID, got, want)
+		}
+	})
+}
+
+func TestRepositoryForumCounters(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+		if _, err := repo.ForumThreadRepository.CreateForumThread(ctx, &core.Thread{Title: "Second", Author: "bob", Forum: "FRM", Message: "second", Created: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		createPosts(t, repo, thread, &dto.PostData{Author: "alice", Message: "a"}, &dto.PostData{Author: "bob", Message: "b"})
+		createPosts(t, repo, thread, &dto.PostData{Author: "alice", Message: "c"})
+
+		forum, err := repo.ForumRepository.GetForumBySlug(ctx, "frm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forum.Threads != 2 || forum.Posts != 3 {
+			t.Fatalf("forum counts %d threads and %d posts, want 2 and 3", forum.Threads, forum.Posts)
+		}
+	})
+}
+
+func TestRepositoryForumUsers(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+		createPosts(t, repo, thread, &dto.PostData{Author: "BOB", Message: "b"}, &dto.PostData{Author: "bob", Message: "b again"})
+
+		users, err := repo.ForumRepository.GetForumUsers(ctx, "frm", 10, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The forum's creator is not one of its users until they post, thread and post authors are, once each.
+		got := []string{}
+		for _, user := range users {
+			got = append(got, user.Nickname)
+		}
+		if len(got) != 2 || got[0] != "bob" || got[1] != "Carol" {
+			t.Fatalf("forum users %v, want [bob Carol]", got)
+		}
+
+		users, err = repo.ForumRepository.GetForumUsers(ctx, "frm", 10, "CAROL", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].Nickname != "bob" {
+			t.Fatalf("forum users before CAROL descending: %v, want [bob]", users)
+		}
+	})
+}
+
+func TestRepositoryVotes(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+
+		for _, vote := range []*core.Vote{{Nickname: "alice", ThreadID: thread.ID, Voice: 1}, {Nickname: "bob", ThreadID: thread.ID, Voice: 1}} {
+			if err := repo.VotesRepository.CreateVote(ctx, vote); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := repo.VotesRepository.CreateVote(ctx, &core.Vote{Nickname: "ALICE", ThreadID: thread.ID, Voice: -1})
+		if !isPgError(err, pgUniqueViolation) {
+			t.Fatalf("expected a unique violation for a second vote, got %v", err)
+		}
+		if exists, err := repo.VotesRepository.VoteExists(ctx, "BOB", thread.ID); err != nil || !exists {
+			t.Fatalf("vote of BOB: %v, %v", exists, err)
+		}
+
+		if changed, err := repo.VotesRepository.UpdateVote(ctx, thread.ID, "Alice", -1); err != nil || !changed {
+			t.Fatalf("changing the vote of Alice: %v, %v", changed, err)
+		}
+		if changed, err := repo.VotesRepository.UpdateVote(ctx, thread.ID, "alice", -1); err != nil || changed {
+			t.Fatalf("repeating the vote of alice: %v, %v", changed, err)
+		}
+
+		updated, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, thread.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Votes != 0 {
+			t.Fatalf("thread votes %d, want 0", updated.Votes)
+		}
+
+		for _, step := range []struct {
+			vote  *core.Vote
+			votes int64
+		}{
+			{&core.Vote{Nickname: "Carol", ThreadID: thread.ID, Voice: 1}, 1},
+			{&core.Vote{Nickname: "Carol", ThreadID: thread.ID, Voice: 1}, 1},
+			{&core.Vote{Nickname: "Carol", ThreadID: thread.ID, Voice: -1}, -1},
+			{&core.Vote{Nickname: "bob", ThreadID: thread.ID, Voice: -1}, -3},
+		} {
+			if err := repo.VotesRepository.SetVote(ctx, step.vote); err != nil {
+				t.Fatal(err)
+			}
+			updated, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, thread.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Votes != step.votes {
+				t.Fatalf("thread votes %d after %s voted %d, want %d", updated.Votes, step.vote.Nickname, step.vote.Voice, step.votes)
+			}
+		}
+	})
+}
+
+func TestRepositoryRollback(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+		createPosts(t, repo, thread, &dto.PostData{Author: "alice", Message: "kept"})
+
+		errAbort := errors.New("abort")
+		err := repo.WithTx(ctx, func(tx *Repository) error {
+			if err := tx.UserRepository.CreateUser(ctx, &core.User{Nickname: "dave", Email: "dave@example.com"}); err != nil {
+				return err
+			}
+			if _, err := tx.PostsRepository.CreatePosts(ctx, thread.Forum, thread.ID, []*dto.PostData{{Author: "dave", Message: "lost"}}); err != nil {
+				return err
+			}
+			if err := tx.VotesRepository.CreateVote(ctx, &core.Vote{Nickname: "dave", ThreadID: thread.ID, Voice: 1}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("expected the transaction to fail with errAbort, got %v", err)
+		}
+
+		if _, err := repo.UserRepository.GetUserByNickname(ctx, "dave"); !errors.Is(err, constants.ErrDBNotFound) {
+			t.Fatalf("expected dave to be rolled back, got %v", err)
+		}
+		forum, err := repo.ForumRepository.GetForumBySlug(ctx, "frm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forum.Posts != 1 {
+			t.Fatalf("forum counts %d posts after the rollback, want 1", forum.Posts)
+		}
+		users, err := repo.ForumRepository.GetForumUsers(ctx, "frm", 10, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 {
+			t.Fatalf("forum has %d users after the rollback, want 2", len(users))
+		}
+		rolledBack, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, thread.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rolledBack.Votes != 0 {
+			t.Fatalf("thread votes %d after the rollback, want 0", rolledBack.Votes)
+		}
+
+		// Ids are handed out again after a rollback in memory and skipped by Postgres sequences, either way
+		// the next post goes to the end of the thread.
+		posts := createPosts(t, repo, thread, &dto.PostData{Author: "bob", Message: "after"})
+		flat, err := repo.PostsRepository.GetPostsFlat(ctx, int(thread.ID), -1, false, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flat) != 2 || flat[1].ID != posts[0].ID {
+			t.Fatalf("posts after the rollback %v, want the kept post and %d", postIDs(flat), posts[0].ID)
+		}
+	})
+}
+
+func TestRepositoryMergeThread(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		target := seed(t, repo)
+		source, err := repo.ForumThreadRepository.CreateForumThread(ctx, &core.Thread{Title: "Source", Author: "bob", Forum: "frm", Message: "source", Created: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := createPosts(t, repo, target, &dto.PostData{Author: "alice", Message: "target"})[0]
+		root := createPosts(t, repo, source, &dto.PostData{Author: "bob", Message: "source root"})[0]
+		reply := createPosts(t, repo, source, &dto.PostData{Parent: root.ID, Author: "carol", Message: "source reply"})[0]
+
+		if err := repo.ForumThreadRepository.MergeForumThread(ctx, source.ID, target.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tree, err := repo.PostsRepository.GetPostsTree(ctx, int(target.ID), -1, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(tree), []int64{kept.ID, root.ID, reply.ID}; !equalIDs(got, want) {
+			t.Fatalf("merged tree %v, want %v", got, want)
+		}
+		if tree[1].Parent != 0 || tree[1].Thread != target.ID {
+			t.Fatalf("merged root post %+v, want a root of thread %d", tree[1], target.ID)
+		}
+
+		merged, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, source.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged.DeletedAt == nil {
+			t.Fatal("the merged thread was not deleted")
+		}
+		forum, err := repo.ForumRepository.GetForumBySlug(ctx, "frm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forum.Threads != 1 || forum.Posts != 3 {
+			t.Fatalf("forum counts %d threads and %d posts after the merge, want 1 and 3", forum.Threads, forum.Posts)
+		}
+	})
+}
+
+func TestRepositoryTreePageAfterRemovedPost(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		thread := seed(t, repo)
+		roots := createPosts(t, repo, thread, &dto.PostData{Author: "alice", Message: "a"}, &dto.PostData{Author: "bob", Message: "b"})
+		reply := createPosts(t, repo, thread, &dto.PostData{Parent: roots[0].ID, Author: "bob", Message: "a.1"})[0]
+
+		page, err := repo.PostsRepository.GetPostsTree(ctx, int(thread.ID), -1, false, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(page), []int64{roots[0].ID, reply.ID}; !equalIDs(got, want) {
+			t.Fatalf("first page %v, want %v", got, want)
+		}
+		last := page[len(page)-1]
+		if !equalIDs(last.Path, []int64{roots[0].ID, reply.ID}) {
+			t.Fatalf("path of %d is %v, want %v", last.ID, last.Path, []int64{roots[0].ID, reply.ID})
+		}
+
+		if _, err := repo.PostsRepository.DeletePostTree(ctx, roots[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		next, err := repo.PostsRepository.GetPostsTreePage(ctx, thread.ID, 2, &Keyset{ID: last.ID, Path: last.Path}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := postIDs(next), []int64{roots[1].ID}; !equalIDs(got, want) {
+			t.Fatalf("page after the removed post %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRepositoryClearForgetsRequests(t *testing.T) {
+	runContract(t, func(t *testing.T, repo *Repository) {
+		ctx := context.Background()
+		record := &core.IdempotencyRecord{Key: "ip:127.0.0.1:k", Fingerprint: "f", Expires: time.Now().Add(time.Minute)}
+		if _, err := repo.IdempotencyRepository.ReserveIdempotencyKey(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.IdempotencyRepository.CompleteIdempotencyKey(ctx, record.Key, 201, "application/json", []byte("{}"), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		limit := ratelimit.Limit{Rate: 0.001, Burst: 1}
+		if allowed, _, err := repo.RateLimitRepository.Take(ctx, "ip:127.0.0.1", limit); err != nil || !allowed {
+			t.Fatalf("first take: %t, %v", allowed, err)
+		}
+
+		if err := repo.ServiceRepository.Delete(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if existing, err := repo.IdempotencyRepository.ReserveIdempotencyKey(ctx, record); err != nil || existing != nil {
+			t.Fatalf("the key outlived the clear: %+v, %v", existing, err)
+		}
+		if allowed, _, err := repo.RateLimitRepository.Take(ctx, "ip:127.0.0.1", limit); err != nil || !allowed {
+			t.Fatalf("the bucket outlived the clear: %t, %v", allowed, err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	queryGetUserRole    = "SELECT role FROM user_roles WHERE nickname = $1;"
+	querySetUserRole    = "INSERT INTO user_roles (nickname, role) VALUES ($1, $2) ON CONFLICT (nickname) DO UPDATE SET role = EXCLUDED.role;"
+	queryDeleteUserRole = "DELETE FROM user_roles WHERE nickname = $1;"
+
+	queryIsForumModerator = `SELECT EXISTS (SELECT 1 FROM forums WHERE slug = $1 AND "user" = $2)
+		OR EXISTS (SELECT 1 FROM forum_moderators WHERE forum = $1 AND nickname = $2);`
+	queryGetForumModerators = `SELECT u.nickname, u.fullname, u.about, u.email FROM forum_moderators m JOIN users u ON u.nickname = m.nickname
+		WHERE m.forum = $1 ORDER BY u.nickname;`
+	queryAddForumModerator    = "INSERT INTO forum_moderators (forum, nickname) VALUES ($1, $2) ON CONFLICT DO NOTHING;"
+	queryRemoveForumModerator = "DELETE FROM forum_moderators WHERE forum = $1 AND nickname = $2;"
+)
+
+type RoleRepository interface {
+	// GetUserRole returns the global role of a user, core.RoleMember unless it is an admin or banned.
+	GetUserRole(ctx context.Context, nickname string) (string, error)
+	SetUserRole(ctx context.Context, nickname string, role string) error
+
+	// IsForumModerator reports whether the user owns or is listed as a moderator of the forum.
+	IsForumModerator(ctx context.Context, forum string, nickname string) (bool, error)
+	// GetForumModerators lists the moderators of a forum by nickname, the owner is not among them unless added.
+	GetForumModerators(ctx context.Context, forum string) ([]*core.User, error)
+	AddForumModerator(ctx context.Context, forum string, nickname string) error
+	RemoveForumModerator(ctx context.Context, forum string, nickname string) error
+}
+
+type roleRepositoryImpl struct {
+	dbConn querier
+}
+
+func (repo *roleRepositoryImpl) GetUserRole(ctx context.Context, nickname string) (string, error) {
+	var role string
+	if err := repo.dbConn.QueryRow(ctx, queryGetUserRole, nickname).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return core.RoleMember, nil
+		}
+		return "", err
+	}
+	return role, nil
+}
+
+func (repo *roleRepositoryImpl) SetUserRole(ctx context.Context, nickname string, role string) error {
+	if role == core.RoleMember {
+		_, err := repo.dbConn.Exec(ctx, queryDeleteUserRole, nickname)
+		return err
+	}
+	_, err := repo.dbConn.Exec(ctx, querySetUserRole, nickname, role)
+	return err
+}
+
+func (repo *roleRepositoryImpl) IsForumModerator(ctx context.Context, forum string, nickname string) (bool, error) {
+	var moderator bool
+	err := repo.dbConn.QueryRow(ctx, queryIsForumModerator, forum, nickname).Scan(&moderator)
+	return moderator, err
+}
+
+func (repo *roleRepositoryImpl) GetForumModerators(ctx context.Context, forum string) ([]*core.User, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetForumModerators, forum)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*core.User{}
+	for rows.Next() {
+		u := &core.User{}
+		if err := rows.Scan(&u.Nickname, &u.Fullname, &u.About, &u.Email); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (repo *roleRepositoryImpl) AddForumModerator(ctx context.Context, forum string, nickname string) error {
+	_, err := repo.dbConn.Exec(ctx, queryAddForumModerator, forum, nickname)
+	return err
+}
+
+func (repo *roleRepositoryImpl) RemoveForumModerator(ctx context.Context, forum string, nickname string) error {
+	_, err := repo.dbConn.Exec(ctx, queryRemoveForumModerator, forum, nickname)
+	return err
+}
+
+func NewRoleRepository(dbConn querier) *roleRepositoryImpl {
+	return &roleRepositoryImpl{dbConn: dbConn}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	SearchTypePost   = "post"
+	SearchTypeThread = "thread"
+)
+
+// SearchFilter narrows a full-text search. Query uses the websearch_to_tsquery syntax,
+// Language names the text search configuration it is parsed with, the one the search columns are built with
+// (see Migrator.CheckSearchConfig), and empty fields do not filter.
+type SearchFilter struct {
+	Query    string
+	Language string
+	Type     string
+	Forum    string
+	Author   string
+}
+
+type SearchRepository interface {
+	// Search lists matches by descending rank, then type and id. A page continues after the given row,
+	// or starts from the best match if after is nil; desc false walks the listing backwards.
+	Search(ctx context.Context, filter *SearchFilter, limit int64, after *Keyset, desc bool) ([]*core.SearchResult, error)
+}
+
+type searchRepositoryImpl struct {
+	dbConn querier
+}
+
+func (repo *searchRepositoryImpl) Search(ctx context.Context, filter *SearchFilter, limit int64, after *Keyset, desc bool) ([]*core.SearchResult, error) {
+	parts := []*selectQuery{}
+	if filter.Type != SearchTypeThread {
+		parts = append(parts, searchIn(filter,
+			"SELECT 'post' AS type, id, thread, forum, author, '' AS title, message AS body, created, ts_rank(search, tsq) AS rank "+
+				"FROM posts, websearch_to_tsquery(?::regconfig, ?) tsq").
+			where("deleted_at IS NULL").
+			where("NOT EXISTS (SELECT 1 FROM threads th WHERE th.id = posts.thread AND th.deleted_at IS NOT NULL)"))
+	}
+	if filter.Type != SearchTypePost {
+		parts = append(parts, searchIn(filter,
+			"SELECT 'thread' AS type, id, id AS thread, forum, author, title, message AS body, created, ts_rank(search, tsq) AS rank "+
+				"FROM threads, websearch_to_tsquery(?::regconfig, ?) tsq").where("deleted_at IS NULL"))
+	}
+	union, unionArgs := unionAll(parts...)
+
+	// Snippets are highlighted in the outer query, so that only the rows of the page pay for ts_headline.
+	q := newSelectQuery("SELECT type, id, thread, forum, author, title, ts_headline(?::regconfig, body, websearch_to_tsquery(?::regconfig, ?)), rank, created "+
+		"FROM ("+union+") hits", append([]any{filter.Language, filter.Language, filter.Query}, unionArgs...)...)
+	if after != nil {
+		if desc {
+			q.where("(rank, type, id) < (?::real, ?, ?)", after.Rank, after.Kind, after.ID)
+		} else {
+			q.where("(rank, type, id) > (?::real, ?, ?)", after.Rank, after.Kind, after.ID)
+		}
+	}
+	query, args := q.orderBy(desc, "rank", "type", "id").limit(limit).build()
+
+	rows, err := repo.dbConn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*core.SearchResult{}
+	for rows.Next() {
+		r := &core.SearchResult{}
+		if err := rows.Scan(&r.Type, &r.ID, &r.Thread, &r.Forum, &r.Author, &r.Title, &r.Snippet, &r.Rank, &r.Created); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+func searchIn(filter *SearchFilter, base string) *selectQuery {
+	q := newSelectQuery(base, filter.Language, filter.Query).where("search @@ tsq")
+	if filter.Forum != "" {
+		q.where("forum = ?", filter.Forum)
+	}
+	if filter.Author != "" {
+		q.where("author = ?", filter.Author)
+	}
+	return q
+}
+
+func NewSearchRepository(dbConn querier) *searchRepositoryImpl {
+	return &searchRepositoryImpl{dbConn: dbConn}
+}
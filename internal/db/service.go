@@ -3,13 +3,12 @@ package db
 import (
 	"context"
 
-	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/model/core"
 )
 
 const (
-	queryDeleteAllTables           = "TRUNCATE TABLE users, forums, threads, posts, forum_users, votes CASCADE;"
-	queryCountForumPostThreadUsers = "SELECT (SELECT count(*) FROM users) AS user, (SELECT count(*) FROM forums) AS forum, (SELECT count(*) FROM threads) AS thread, (SELECT count(*) FROM posts) AS post;"
+	queryDeleteAllTables           = "TRUNCATE TABLE users, forums, threads, posts, forum_users, votes, idempotency_keys, rate_limits CASCADE;"
+	queryCountForumPostThreadUsers = "SELECT (SELECT count(*) FROM users) AS user, (SELECT count(*) FROM forums) AS forum, (SELECT count(*) FROM threads WHERE deleted_at IS NULL) AS thread, (SELECT count(*) FROM posts WHERE deleted_at IS NULL) AS post;"
 )
 
 type ServiceRepository interface {
@@ -18,7 +17,7 @@ type ServiceRepository interface {
 }
 
 type serviceRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *serviceRepositoryImpl) Status(ctx context.Context) (*core.ServiceInfo, error) {
@@ -32,6 +31,6 @@ func (repo *serviceRepositoryImpl) Delete(ctx context.Context) error {
 	return err
 }
 
-func NewServiceRepository(dbConn *customtypes.DBConn) *serviceRepositoryImpl {
+func NewServiceRepository(dbConn querier) *serviceRepositoryImpl {
 	return &serviceRepositoryImpl{dbConn: dbConn}
 }
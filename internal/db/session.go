@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+const (
+	queryCreateSession       = "INSERT INTO sessions (id, nickname, created, expires) VALUES ($1, $2, $3, $4);"
+	queryDeleteExpiredOfUser = "DELETE FROM sessions WHERE nickname = $1 AND expires <= now();"
+
+	queryGetSession    = "SELECT id, nickname, created, expires FROM sessions WHERE id = $1 AND expires > now();"
+	queryDeleteSession = "DELETE FROM sessions WHERE id = $1;"
+)
+
+type SessionRepository interface {
+	// CreateSession starts a session, dropping the expired ones of the same user.
+	CreateSession(ctx context.Context, session *core.Session) error
+	// GetSession finds a session that has not expired.
+	GetSession(ctx context.Context, id string) (*core.Session, error)
+	DeleteSession(ctx context.Context, id string) error
+}
+
+type sessionRepositoryImpl struct {
+	dbConn querier
+}
+
+func (repo *sessionRepositoryImpl) CreateSession(ctx context.Context, session *core.Session) error {
+	if _, err := repo.dbConn.Exec(ctx, queryDeleteExpiredOfUser, session.Nickname); err != nil {
+		return err
+	}
+	_, err := repo.dbConn.Exec(ctx, queryCreateSession, session.ID, session.Nickname, session.Created, session.Expires)
+	return err
+}
+
+func (repo *sessionRepositoryImpl) GetSession(ctx context.Context, id string) (*core.Session, error) {
+	s := &core.Session{}
+	if err := repo.dbConn.QueryRow(ctx, queryGetSession, id).Scan(&s.ID, &s.Nickname, &s.Created, &s.Expires); err != nil {
+		return nil, wrapErr(err)
+	}
+	return s, nil
+}
+
+func (repo *sessionRepositoryImpl) DeleteSession(ctx context.Context, id string) error {
+	tag, err := repo.dbConn.Exec(ctx, queryDeleteSession, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return constants.ErrDBNotFound
+	}
+	return nil
+}
+
+func NewSessionRepository(dbConn querier) *sessionRepositoryImpl {
+	return &sessionRepositoryImpl{dbConn: dbConn}
+}
@@ -3,19 +3,50 @@ package db
 import (
 	"context"
 
-	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/jackc/pgx/v5"
+	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/model/core"
 )
 
 const (
-	queryCreateForumThread = "INSERT INTO threads (title, author, forum, message, slug, created) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, title, author, forum, message, votes, slug, created;"
+	threadColumns = "id, title, author, forum, message, votes, slug, created, locked, pinned, deleted_at"
 
-	querGetForumThreadByID    = "SELECT id, title, author, forum, message, votes, slug, created FROM threads WHERE id = $1;"
-	queryGetForumThreadBySlug = "SELECT id, title, author, forum, message, votes, slug, created FROM threads WHERE slug = $1;"
+	queryCreateForumThread = "INSERT INTO threads (title, author, forum, message, slug, created) VALUES ($1, $2, $3, $4, $5, $6) RETURNING " + threadColumns + ";"
 
-	queryUpdateForumThreadByID = "UPDATE threads SET title = $2, message = $3 WHERE id = $1 RETURNING id, title, author, forum, message, votes, slug, created;"
+	querGetForumThreadByID    = "SELECT " + threadColumns + " FROM threads WHERE id = $1;"
+	queryGetForumThreadBySlug = "SELECT " + threadColumns + " FROM threads WHERE slug = $1;"
+
+	queryUpdateForumThreadByID = "UPDATE threads SET title = $2, message = $3 WHERE id = $1 RETURNING " + threadColumns + ";"
+
+	queryModerateForumThread = `UPDATE threads SET locked = COALESCE($2, locked), pinned = COALESCE($3, pinned),
+		deleted_at = CASE WHEN $4::boolean IS NULL THEN deleted_at WHEN $4 THEN COALESCE(deleted_at, now()) END
+		WHERE id = $1 RETURNING ` + threadColumns + ";"
+
+	queryLockForumThreads = "SELECT id FROM threads WHERE id = ANY($1) ORDER BY id FOR UPDATE;"
+
+	queryMoveForumThread      = "UPDATE threads SET forum = $2 WHERE id = $1 RETURNING " + threadColumns + ";"
+	queryMoveForumThreadPosts = "WITH moved AS (UPDATE posts SET forum = $2 WHERE thread = $1 RETURNING deleted_at) SELECT count(*) FILTER (WHERE deleted_at IS NULL) FROM moved;"
+	queryMoveForumCounters    = `UPDATE forums SET posts = posts + CASE WHEN slug = $2 THEN $3::bigint ELSE -$3::bigint END, threads = threads + CASE WHEN slug = $2 THEN $4::bigint ELSE -$4::bigint END
+		WHERE slug = $1 OR slug = $2;`
+	queryMoveForumUsers = `INSERT INTO forum_users (nickname, fullname, about, email, forum)
+		SELECT u.nickname, u.fullname, u.about, u.email, $2::citext FROM users u
+		WHERE u.nickname IN (SELECT author FROM posts WHERE thread = $1 UNION SELECT author FROM threads WHERE id = $1)
+		ON CONFLICT DO NOTHING;`
+
+	queryMergeForumThreadPosts  = "UPDATE posts SET thread = $2 WHERE thread = $1;"
+	queryMergeForumThreadDelete = "UPDATE threads SET deleted_at = COALESCE(deleted_at, now()) WHERE id = $1;"
 )
 
+// ThreadModeration changes the moderation state of a thread, nil fields are left as they are.
+type ThreadModeration struct {
+	// Locked threads accept neither posts nor votes.
+	Locked *bool
+	// Pinned threads are listed before the others of their forum.
+	Pinned *bool
+	// Deleted threads are hidden and not counted in forums.threads.
+	Deleted *bool
+}
+
 type ForumThreadRepository interface {
 	CreateForumThread(ctx context.Context, thread *core.Thread) (*core.Thread, error)
 
@@ -23,37 +54,119 @@ type ForumThreadRepository interface {
 	GetForumThreadBySlug(ctx context.Context, slug string) (*core.Thread, error)
 
 	UpdateForumThreadByID(ctx context.Context, id int64, title string, message string) (*core.Thread, error)
+	ModerateForumThread(ctx context.Context, id int64, moderation *ThreadModeration) (*core.Thread, error)
+
+	// The statements of the following methods depend on each other, so they have to be run in a transaction.
+
+	// LockForumThreads keeps the threads from being moved or merged concurrently until the transaction ends.
+	LockForumThreads(ctx context.Context, ids ...int64) error
+	// MoveForumThread moves a thread with its posts from one forum to another, recounting both forums and
+	// adding the authors of the thread to the users of the new forum.
+	MoveForumThread(ctx context.Context, thread *core.Thread, forum string) (*core.Thread, error)
+	// MergeForumThread moves the posts of a thread into another one of the same forum and deletes it.
+	// Post ids are unique across threads, so the posts keep their paths and root posts stay roots.
+	MergeForumThread(ctx context.Context, from int64, into int64) error
 }
 
 type forumThreadRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *forumThreadRepositoryImpl) CreateForumThread(ctx context.Context, thread *core.Thread) (*core.Thread, error) {
-	t := &core.Thread{}
-	err := repo.dbConn.QueryRow(ctx, queryCreateForumThread, thread.Title, thread.Author, thread.Forum, thread.Message, thread.Slug, thread.Created).
-		Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created)
-	return t, err
+	t, err := scanThread(repo.dbConn.QueryRow(ctx, queryCreateForumThread, thread.Title, thread.Author, thread.Forum, thread.Message, thread.Slug, thread.Created))
+	if err != nil {
+		return &core.Thread{}, err
+	}
+	return t, nil
 }
 
 func (repo *forumThreadRepositoryImpl) GetForumThreadByID(ctx context.Context, id int64) (*core.Thread, error) {
-	t := &core.Thread{}
-	err := repo.dbConn.QueryRow(ctx, querGetForumThreadByID, id).Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created)
-	return t, wrapErr(err)
+	t, err := scanThread(repo.dbConn.QueryRow(ctx, querGetForumThreadByID, id))
+	if err != nil {
+		return &core.Thread{}, wrapErr(err)
+	}
+	return t, nil
 }
 
 func (repo *forumThreadRepositoryImpl) GetForumThreadBySlug(ctx context.Context, slug string) (*core.Thread, error) {
-	t := &core.Thread{}
-	err := repo.dbConn.QueryRow(ctx, queryGetForumThreadBySlug, slug).Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created)
-	return t, wrapErr(err)
+	t, err := scanThread(repo.dbConn.QueryRow(ctx, queryGetForumThreadBySlug, slug))
+	if err != nil {
+		return &core.Thread{}, wrapErr(err)
+	}
+	return t, nil
 }
 
 func (repo *forumThreadRepositoryImpl) UpdateForumThreadByID(ctx context.Context, id int64, title string, message string) (*core.Thread, error) {
+	t, err := scanThread(repo.dbConn.QueryRow(ctx, queryUpdateForumThreadByID, id, title, message))
+	if err != nil {
+		return &core.Thread{}, wrapErr(err)
+	}
+	return t, nil
+}
+
+func (repo *forumThreadRepositoryImpl) ModerateForumThread(ctx context.Context, id int64, moderation *ThreadModeration) (*core.Thread, error) {
+	t, err := scanThread(repo.dbConn.QueryRow(ctx, queryModerateForumThread, id, moderation.Locked, moderation.Pinned, moderation.Deleted))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return t, nil
+}
+
+func (repo *forumThreadRepositoryImpl) LockForumThreads(ctx context.Context, ids ...int64) error {
+	_, err := repo.dbConn.Exec(ctx, queryLockForumThreads, ids)
+	return err
+}
+
+func (repo *forumThreadRepositoryImpl) MoveForumThread(ctx context.Context, thread *core.Thread, forum string) (*core.Thread, error) {
+	moved, err := scanThread(repo.dbConn.QueryRow(ctx, queryMoveForumThread, thread.ID, forum))
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	var posts int64
+	if err := repo.dbConn.QueryRow(ctx, queryMoveForumThreadPosts, thread.ID, forum).Scan(&posts); err != nil {
+		return nil, err
+	}
+
+	threads := 1
+	if thread.DeletedAt != nil {
+		threads = 0
+	}
+	if _, err := repo.dbConn.Exec(ctx, queryMoveForumCounters, thread.Forum, forum, posts, threads); err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.dbConn.Exec(ctx, queryMoveForumUsers, thread.ID, forum); err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+func (repo *forumThreadRepositoryImpl) MergeForumThread(ctx context.Context, from int64, into int64) error {
+	if _, err := repo.dbConn.Exec(ctx, queryMergeForumThreadPosts, from, into); err != nil {
+		return err
+	}
+
+	deleted, err := repo.dbConn.Exec(ctx, queryMergeForumThreadDelete, from)
+	if err != nil {
+		return err
+	}
+	if deleted.RowsAffected() == 0 {
+		return constants.ErrDBNotFound
+	}
+	return nil
+}
+
+// scanThread reads a row of threadColumns.
+func scanThread(row pgx.Row) (*core.Thread, error) {
 	t := &core.Thread{}
-	err := repo.dbConn.QueryRow(ctx, queryUpdateForumThreadByID, id, title, message).Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created)
-	return t, wrapErr(err)
+	if err := row.Scan(&t.ID, &t.Title, &t.Author, &t.Forum, &t.Message, &t.Votes, &t.Slug, &t.Created, &t.Locked, &t.Pinned, &t.DeletedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-func NewForumThreadRepository(dbConn *customtypes.DBConn) *forumThreadRepositoryImpl {
+func NewForumThreadRepository(dbConn querier) *forumThreadRepositoryImpl {
 	return &forumThreadRepositoryImpl{dbConn: dbConn}
 }
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/senago/technopark-dbms/internal/db")
+
+// tracingQuerier records a client span for every statement. The pgx version in use has no tracer hook
+// of its own, so statements are traced at the querier every repository goes through instead.
+type tracingQuerier struct {
+	querier
+}
+
+func (q *tracingQuerier) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	ctx, span := startStatementSpan(ctx, sql)
+	defer span.End()
+
+	tag, err := q.querier.Exec(ctx, sql, arguments...)
+	endSpan(span, err)
+	return tag, err
+}
+
+func (q *tracingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	ctx, span := startStatementSpan(ctx, sql)
+
+	rows, err := q.querier.Query(ctx, sql, args...)
+	if err != nil {
+		endSpan(span, err)
+		span.End()
+		return nil, err
+	}
+	return &tracingRows{Rows: rows, span: span}, nil
+}
+
+func (q *tracingQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	ctx, span := startStatementSpan(ctx, sql)
+	return &tracingRow{Row: q.querier.QueryRow(ctx, sql, args...), span: span}
+}
+
+func startStatementSpan(ctx context.Context, sql string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemPostgreSQL,
+		semconv.DBStatementKey.String(sql),
+	))
+}
+
+// endSpan marks the span as failed unless the operation merely found nothing.
+func endSpan(span trace.Span, err error) {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		span.SetAttributes(attribute.String("db.postgresql.sqlstate", pgErr.Code))
+	}
+}
+
+// tracingRows ends the span of its statement once the rows are closed, which is when the statement completes.
+type tracingRows struct {
+	pgx.Rows
+	span trace.Span
+	once sync.Once
+}
+
+func (rows *tracingRows) Close() {
+	rows.Rows.Close()
+	rows.once.Do(func() {
+		endSpan(rows.span, rows.Rows.Err())
+		rows.span.End()
+	})
+}
+
+type tracingRow struct {
+	pgx.Row
+	span trace.Span
+}
+
+func (row *tracingRow) Scan(dest ...any) error {
+	err := row.Row.Scan(dest...)
+	endSpan(row.span, err)
+	row.span.End()
+	return err
+}
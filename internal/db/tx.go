@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+
+	// Retries wait for a random time of up to txRetryBackoff, doubled with every attempt up to txRetryMaxBackoff,
+	// so that transactions that aborted each other do not collide again right away.
+	txRetryBackoff    = 5 * time.Millisecond
+	txRetryMaxBackoff = 200 * time.Millisecond
+)
+
+// TxOptions configures a transaction started by Repository.WithTxOptions.
+type TxOptions struct {
+	IsoLevel pgx.TxIsoLevel
+	// MaxRetries is the number of times the whole transaction is replayed
+	// after a serialization failure or a deadlock.
+	MaxRetries int
+}
+
+var DefaultTxOptions = TxOptions{IsoLevel: pgx.ReadCommitted, MaxRetries: 3}
+
+// WithTx runs fn with DefaultTxOptions, see WithTxOptions.
+func (r *Repository) WithTx(ctx context.Context, fn func(*Repository) error) error {
+	return r.WithTxOptions(ctx, DefaultTxOptions, fn)
+}
+
+// WithTxOptions runs fn with repositories bound to a single transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise. Serialization failures and deadlocks restart the whole
+// transaction, so fn must not have side effects outside of the given repository.
+// Called on a repository that is already bound to a transaction, fn simply joins it.
+func (r *Repository) WithTxOptions(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+	return r.runTx(ctx, opts, fn)
+}
+
+func pgTxRunner(dbConn *customtypes.DBConn) func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+	return func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+		var err error
+		for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+			txCtx, span := tracer.Start(ctx, "db.transaction", trace.WithAttributes(
+				attribute.String("db.postgresql.isolation_level", string(opts.IsoLevel)),
+				attribute.Int("db.transaction.attempt", attempt),
+			))
+			err = dbConn.AcquireFunc(txCtx, func(conn *pgxpool.Conn) error {
+				defer watchCancel(txCtx, conn)()
+
+				return conn.BeginTxFunc(txCtx, pgx.TxOptions{IsoLevel: opts.IsoLevel}, func(tx pgx.Tx) error {
+					return fn(newTxRepository(tx, dbConn))
+				})
+			})
+			endSpan(span, err)
+			span.End()
+			if !isRetryableTxErr(err) || ctx.Err() != nil || attempt == opts.MaxRetries {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(txRetryDelay(attempt)):
+			}
+		}
+
+		return err
+	}
+}
+
+// txRetryDelay picks how long to wait before retrying a transaction after the given attempt failed.
+func txRetryDelay(attempt int) time.Duration {
+	backoff := txRetryMaxBackoff
+	if attempt < 6 {
+		if b := txRetryBackoff << attempt; b < backoff {
+			backoff = b
+		}
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// joinTx makes transactions started on an already transaction-bound repository run in the outer one.
+func joinTx(r *Repository) func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+	return func(ctx context.Context, opts TxOptions, fn func(*Repository) error) error {
+		return fn(r)
+	}
+}
+
+func isRetryableTxErr(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+}
@@ -3,7 +3,7 @@ package db
 import (
 	"context"
 
-	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/model/core"
 )
 
@@ -13,6 +13,10 @@ const (
 	queryGetUserByEmail            = "SELECT nickname, fullname, about, email FROM users where email = $1;"
 	queryGetUserByNickname         = "SELECT nickname, fullname, about, email FROM users where nickname = $1;"
 	queryGetUsersByEmailOrNickname = "SELECT nickname, fullname, about, email FROM users WHERE email = $1 OR nickname = $2;"
+	queryGetUsersByNicknames       = "SELECT nickname, fullname, about, email FROM users WHERE nickname = ANY($1::citext[]);"
+
+	querySetUserPassword     = "UPDATE users SET password_hash = $2 WHERE nickname = $1;"
+	queryGetUserPasswordHash = "SELECT nickname, COALESCE(password_hash, '') FROM users WHERE nickname = $1;"
 
 	queryUpdateUser = "UPDATE users SET fullname = COALESCE(NULLIF(TRIM($1), ''), fullname), about = COALESCE(NULLIF(TRIM($2), ''), about), email = COALESCE(NULLIF(TRIM($3), ''), email) WHERE nickname = $4 RETURNING fullname, about, email;"
 )
@@ -23,12 +27,17 @@ type UserRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*core.User, error)
 	GetUserByNickname(ctx context.Context, nickname string) (*core.User, error)
 	GetUsersByEmailOrNickname(ctx context.Context, email, nickname string) ([]*core.User, error)
+	GetUsersByNicknames(ctx context.Context, nicknames []string) ([]*core.User, error)
 
 	UpdateUser(ctx context.Context, user *core.User) (*core.User, error)
+
+	SetUserPassword(ctx context.Context, nickname string, hash string) error
+	// GetUserPasswordHash returns the stored nickname of a user with the hash of its password, empty when it has none.
+	GetUserPasswordHash(ctx context.Context, nickname string) (string, string, error)
 }
 
 type userRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *userRepositoryImpl) CreateUser(ctx context.Context, user *core.User) error {
@@ -67,6 +76,25 @@ func (repo *userRepositoryImpl) GetUsersByEmailOrNickname(ctx context.Context, e
 	return users, nil
 }
 
+func (repo *userRepositoryImpl) GetUsersByNicknames(ctx context.Context, nicknames []string) ([]*core.User, error) {
+	rows, err := repo.dbConn.Query(ctx, queryGetUsersByNicknames, nicknames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*core.User, 0, len(nicknames))
+	for rows.Next() {
+		u := &core.User{}
+		if err := rows.Scan(&u.Nickname, &u.Fullname, &u.About, &u.Email); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
 func (repo *userRepositoryImpl) UpdateUser(ctx context.Context, user *core.User) (*core.User, error) {
 	updatedUser := &core.User{Nickname: user.Nickname}
 	if err := repo.dbConn.QueryRow(ctx, queryUpdateUser, user.Fullname, user.About, user.Email, user.Nickname).Scan(&updatedUser.Fullname, &updatedUser.About, &updatedUser.Email); err != nil {
@@ -75,6 +103,23 @@ func (repo *userRepositoryImpl) UpdateUser(ctx context.Context, user *core.User)
 	return updatedUser, nil
 }
 
-func NewUserRepository(dbConn *customtypes.DBConn) *userRepositoryImpl {
+func (repo *userRepositoryImpl) SetUserPassword(ctx context.Context, nickname string, hash string) error {
+	tag, err := repo.dbConn.Exec(ctx, querySetUserPassword, nickname, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return constants.ErrDBNotFound
+	}
+	return nil
+}
+
+func (repo *userRepositoryImpl) GetUserPasswordHash(ctx context.Context, nickname string) (string, string, error) {
+	var storedNickname, hash string
+	err := repo.dbConn.QueryRow(ctx, queryGetUserPasswordHash, nickname).Scan(&storedNickname, &hash)
+	return storedNickname, hash, wrapErr(err)
+}
+
+func NewUserRepository(dbConn querier) *userRepositoryImpl {
 	return &userRepositoryImpl{dbConn: dbConn}
 }
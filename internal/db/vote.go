@@ -5,7 +5,6 @@ import (
 	"errors"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/model/core"
 )
 
@@ -13,16 +12,23 @@ const (
 	queryCreateVote = "INSERT INTO votes (nickname, thread, voice) VALUES ($1, $2, $3);"
 	queryVoteExists = "SELECT voice from votes where nickname = $1 and thread = $2;"
 	queryUpdateVote = "UPDATE votes SET voice = $3 WHERE thread = $1 and nickname = $2 and voice != $3;"
+
+	// querySetVote leaves an unchanged vote alone, so that the update trigger does not touch the thread for nothing.
+	querySetVote = `INSERT INTO votes (nickname, thread, voice) VALUES ($1, $2, $3)
+		ON CONFLICT (nickname, thread) DO UPDATE SET voice = EXCLUDED.voice WHERE votes.voice != EXCLUDED.voice;`
 )
 
 type VotesRepository interface {
 	CreateVote(ctx context.Context, vote *core.Vote) error
 	VoteExists(ctx context.Context, nickname string, threadID int64) (bool, error)
 	UpdateVote(ctx context.Context, threadID int64, nickname string, voice int64) (bool, error)
+	// SetVote casts the vote or changes the voice of the one the user already cast, in a single statement
+	// that concurrent votes do not have to be isolated from.
+	SetVote(ctx context.Context, vote *core.Vote) error
 }
 
 type votesRepositoryImpl struct {
-	dbConn *customtypes.DBConn
+	dbConn querier
 }
 
 func (repo *votesRepositoryImpl) CreateVote(ctx context.Context, vote *core.Vote) error {
@@ -50,6 +56,11 @@ func (repo *votesRepositoryImpl) UpdateVote(ctx context.Context, threadID int64,
 	return res.RowsAffected() == 1, nil
 }
 
-func NewVotesRepository(dbConn *customtypes.DBConn) *votesRepositoryImpl {
+func (repo *votesRepositoryImpl) SetVote(ctx context.Context, vote *core.Vote) error {
+	_, err := repo.dbConn.Exec(ctx, querySetVote, vote.Nickname, vote.ThreadID, vote.Voice)
+	return err
+}
+
+func NewVotesRepository(dbConn querier) *votesRepositoryImpl {
 	return &votesRepositoryImpl{dbConn: dbConn}
 }
@@ -0,0 +1,223 @@
+// Package diff compares texts line by line.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// contextLines is the number of unchanged lines shown around changes, as in diff -u.
+	contextLines = 3
+	// MaxLines bounds the lines of each text, the time a comparison takes grows with their number times that of the changes.
+	MaxLines = 10000
+)
+
+// ErrTooLong is returned for texts of more than MaxLines lines.
+var ErrTooLong = errors.New("diff: text has too many lines")
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	line string
+	// from and to count the lines of each text preceding the operation.
+	from, to int
+}
+
+// Unified returns the changes turning from into to in the unified format, with fromName and toName
+// in the file headers. Equal texts give an empty string.
+func Unified(fromName, toName, from, to string) (string, error) {
+	a, b := splitLines(from), splitLines(to)
+	if len(a) > MaxLines || len(b) > MaxLines {
+		return "", ErrTooLong
+	}
+	ops := editScript(a, b)
+
+	out := strings.Builder{}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		start, end := i-contextLines, i
+		if start < 0 {
+			start = 0
+		}
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				if end += contextLines; end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+
+	return out.String(), nil
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	fromLen, toLen := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			fromLen++
+		}
+		if o.kind != opDelete {
+			toLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].from, fromLen), hunkRange(ops[0].to, toLen))
+	for _, o := range ops {
+		out.WriteByte(byte(o.kind))
+		out.WriteString(o.line)
+		out.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the lines of a hunk in one of the texts, an empty range is given by the line before it.
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// editScript finds a shortest edit script with the linear space variant of the Myers algorithm, which takes
+// O((N+M)D) time and O(N+M) memory.
+func editScript(a, b []string) []op {
+	reach := (len(a)+len(b)+1)/2 + 1
+	s := &scripter{a: a, b: b, ops: make([]op, 0, len(a)+len(b)), offset: reach, forward: make([]int, 2*reach+1), backward: make([]int, 2*reach+1)}
+	s.compare(0, len(a), 0, len(b))
+	return s.ops
+}
+
+// scripter holds the state of editScript, forward and backward are the furthest reaching paths
+// by diagonal, shared between the steps of the recursion.
+type scripter struct {
+	a, b              []string
+	ops               []op
+	offset            int
+	forward, backward []int
+}
+
+// compare appends the edit script turning a[aLo:aHi] into b[bLo:bHi].
+func (s *scripter) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && s.a[aLo] == s.b[bLo] {
+		s.ops = append(s.ops, op{kind: opEqual, line: s.a[aLo], from: aLo, to: bLo})
+		aLo, bLo = aLo+1, bLo+1
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && s.a[aHi-suffix-1] == s.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			s.ops = append(s.ops, op{kind: opInsert, line: s.b[y], from: aLo, to: y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			s.ops = append(s.ops, op{kind: opDelete, line: s.a[x], from: x, to: bLo})
+		}
+	default:
+		// Both texts are left with lines that differ at either end, so the edit distance is at least 2
+		// and the halves on either side of the middle snake are each closer to equal than the whole.
+		x, y, u, v := s.middleSnake(aLo, aHi, bLo, bHi)
+		s.compare(aLo, x, bLo, y)
+		for ; x < u; x, y = x+1, y+1 {
+			s.ops = append(s.ops, op{kind: opEqual, line: s.a[x], from: x, to: y})
+		}
+		s.compare(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		s.ops = append(s.ops, op{kind: opEqual, line: s.a[aHi+i], from: aHi + i, to: bHi + i})
+	}
+}
+
+// middleSnake finds the snake, from (x, y) to (u, v), in the middle of a shortest path from (aLo, bLo) to
+// (aHi, bHi) by searching from both ends until the paths overlap. The backward search works on the reversed
+// texts, where diagonal k of the forward search is diagonal delta-k.
+func (s *scripter) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	forward, backward, offset := s.forward, s.backward, s.offset
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			fx := 0
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				fx = forward[offset+k+1]
+			} else {
+				fx = forward[offset+k-1] + 1
+			}
+			fy := fx - k
+			startX, startY := fx, fy
+			for fx < n && fy < m && s.a[aLo+fx] == s.b[bLo+fy] {
+				fx, fy = fx+1, fy+1
+			}
+			forward[offset+k] = fx
+			if rk := delta - k; odd && rk >= -(d-1) && rk <= d-1 && fx+backward[offset+rk] >= n {
+				return aLo + startX, bLo + startY, aLo + fx, bLo + fy
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			bx := 0
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				bx = backward[offset+k+1]
+			} else {
+				bx = backward[offset+k-1] + 1
+			}
+			by := bx - k
+			startX, startY := bx, by
+			for bx < n && by < m && s.a[aHi-bx-1] == s.b[bHi-by-1] {
+				bx, by = bx+1, by+1
+			}
+			backward[offset+k] = bx
+			if fk := delta - k; !odd && fk >= -d && fk <= d && bx+forward[offset+fk] >= n {
+				return aHi - bx, bHi - by, aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	panic("diff: the searches for the middle snake did not meet")
+}
@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lcsLength is the length of a longest common subsequence, by dynamic programming.
+func lcsLength(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func checkScript(t *testing.T, a, b []string) {
+	t.Helper()
+	ops := editScript(a, b)
+
+	from, to, equal := []string{}, []string{}, 0
+	for _, o := range ops {
+		if o.from != len(from) || o.to != len(to) {
+			t.Fatalf("%c%s at %d,%d, want %d,%d", o.kind, o.line, o.from, o.to, len(from), len(to))
+		}
+		if o.kind != opInsert {
+			from = append(from, o.line)
+		}
+		if o.kind != opDelete {
+			to = append(to, o.line)
+		}
+		if o.kind == opEqual {
+			equal++
+		}
+	}
+	if strings.Join(from, "\n") != strings.Join(a, "\n") || strings.Join(to, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("the script turns %q into %q, want %q into %q", from, to, a, b)
+	}
+	if want := lcsLength(a, b); equal != want {
+		t.Fatalf("the script keeps %d lines of %q and %q, want %d", equal, a, b, want)
+	}
+}
+
+func TestEditScriptIsShortest(t *testing.T) {
+	checkScript(t, nil, nil)
+	checkScript(t, []string{"a"}, nil)
+	checkScript(t, nil, []string{"a"})
+	checkScript(t, strings.Split("abcabba", ""), strings.Split("cbabac", ""))
+
+	random := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, random.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		checkScript(t, text(), text())
+	}
+}
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		from, to, want string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			"--- old\n+++ new\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+	for _, c := range cases {
+		got, err := Unified("old", "new", c.from, c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("Unified(%q, %q) =\n%s\nwant\n%s", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestUnifiedTooLong(t *testing.T) {
+	long := strings.Repeat("x\n", MaxLines+1)
+	if _, err := Unified("old", "new", long, "x\n"); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+	if _, err := Unified("old", "new", strings.Repeat("x\n", MaxLines), strings.Repeat("y\n", MaxLines)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+const namespace = "technopark_dbms"
+
+// unmatchedRoute labels requests that did not match any registered route, keeping the label set bounded.
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the collectors of the service, registered in a registry of their own.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+}
+
+// Middleware counts and times requests by method, route pattern and status code.
+// Errors are rendered by the app's error handler here, so that their status code is known.
+func (m *Metrics) Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		self := ctx.Route()
+
+		if err := ctx.Next(); err != nil {
+			if err := ctx.App().Config().ErrorHandler(ctx, err); err != nil {
+				_ = ctx.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		route := ctx.Route().Path
+		if ctx.Route() == self {
+			route = unmatchedRoute
+		}
+		// Label values outlive the request, while fiber's strings point into reused buffers.
+		method := utils.CopyString(ctx.Method())
+
+		m.requests.WithLabelValues(method, route, strconv.Itoa(ctx.Response().StatusCode())).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() fiber.Handler {
+	handler := fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return func(ctx *fiber.Ctx) error {
+		handler(ctx.Context())
+		return nil
+	}
+}
+
+// ObserveQuery is a db.QueryObserver. Not found results are expected outcomes and do not count as errors.
+func (m *Metrics) ObserveQuery(repository, method string, duration time.Duration, err error) {
+	m.queryDuration.WithLabelValues(repository, method).Observe(duration.Seconds())
+	if err != nil && !errors.Is(err, constants.ErrDBNotFound) {
+		m.queryErrors.WithLabelValues(repository, method).Inc()
+	}
+}
+
+// RegisterPool exposes the statistics of the connection pool.
+func (m *Metrics) RegisterPool(pool *customtypes.DBConn) {
+	m.registry.MustRegister(&poolCollector{pool: pool})
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "Number of handled HTTP requests.",
+		}, []string{"method", "route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Latency of handled HTTP requests.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "db", Name: "query_duration_seconds",
+			Help:    "Latency of repository method calls.",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"repository", "method"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "db", Name: "query_errors_total",
+			Help: "Number of repository method calls that failed.",
+		}, []string{"repository", "method"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.requestDuration, m.queryDuration, m.queryErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+)
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_pool_acquired_conns", "Number of connections currently acquired from the pool.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc(namespace+"_pool_idle_conns", "Number of idle connections in the pool.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc(namespace+"_pool_total_conns", "Number of connections in the pool, including those being constructed.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc(namespace+"_pool_max_conns", "Maximum size of the pool.", nil, nil)
+
+	poolAcquires         = prometheus.NewDesc(namespace+"_pool_acquires_total", "Number of successful acquires from the pool.", nil, nil)
+	poolEmptyAcquires    = prometheus.NewDesc(namespace+"_pool_empty_acquires_total", "Number of acquires that had to wait for a connection.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(namespace+"_pool_canceled_acquires_total", "Number of acquires cancelled by their context.", nil, nil)
+	poolAcquireDuration  = prometheus.NewDesc(namespace+"_pool_acquire_duration_seconds_total", "Total time spent in successful acquires.", nil, nil)
+)
+
+// poolCollector reads pgxpool statistics at scrape time.
+type poolCollector struct {
+	pool *customtypes.DBConn
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns,
+		poolAcquires, poolEmptyAcquires, poolCanceledAcquires, poolAcquireDuration,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
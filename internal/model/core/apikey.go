@@ -0,0 +1,26 @@
+package core
+
+import "time"
+
+// Scopes an API key is granted, keys can not manage keys or the profile of their user.
+const (
+	ScopeRead     = "read"
+	ScopePost     = "post"
+	ScopeVote     = "vote"
+	ScopeModerate = "moderate"
+)
+
+type APIKey struct {
+	ID       int64  `json:"id"`
+	Nickname string `json:"nickname"`
+	Name     string `json:"name,omitempty"`
+	// Prefix is the start of the key, enough to tell keys apart.
+	Prefix string   `json:"prefix"`
+	Hash   string   `json:"-"`
+	Scopes []string `json:"scopes"`
+	// Forums limits the key to the given forums, it is good for all of them when empty.
+	Forums    []string   `json:"forums,omitempty"`
+	Created   time.Time  `json:"created"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
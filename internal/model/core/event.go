@@ -0,0 +1,21 @@
+package core
+
+// Kinds of events.
+const (
+	EventPost   = "post"
+	EventEdit   = "edit"
+	EventVotes  = "votes"
+	EventThread = "thread"
+	EventUser   = "user"
+)
+
+// Event announces a change to the forums. Post and edit events carry the id of the created or edited post,
+// which covers deletions too, votes events the new vote total of the thread, thread events the id of the
+// created thread and user events the nickname of the user whose profile changed.
+type Event struct {
+	Kind     string `json:"kind"`
+	Thread   int64  `json:"thread,omitempty"`
+	Post     int64  `json:"post,omitempty"`
+	Votes    int64  `json:"votes,omitempty"`
+	Nickname string `json:"nickname,omitempty"`
+}
@@ -1,9 +1,15 @@
 package core
 
+import "time"
+
 type Forum struct {
 	Title   string `json:"title"`
 	User    string `json:"user"`
 	Slug    string `json:"slug"`
 	Posts   int64  `json:"posts"`
 	Threads int64  `json:"threads"`
+	// Parent is the slug of the forum this one is a sub-forum of, empty for top-level forums.
+	Parent string `json:"parent,omitempty"`
+
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
 }
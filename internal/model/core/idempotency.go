@@ -0,0 +1,16 @@
+package core
+
+import "time"
+
+// IdempotencyRecord is the response to the first request made with an idempotency key, which is replayed to retries.
+type IdempotencyRecord struct {
+	Key string
+	// Fingerprint identifies the request, a key may not be reused for a different one.
+	Fingerprint string
+	// Status is zero while the first request is in flight.
+	Status      int
+	ContentType string
+	Body        []byte
+	Created     time.Time
+	Expires     time.Time
+}
@@ -11,4 +11,18 @@ type Post struct {
 	Forum    string    `json:"forum"`
 	Thread   int64     `json:"thread"`
 	Created  time.Time `json:"created"`
+
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Path lists the ids of the post's ancestors from its root post, then its own. Only tree cursors use it.
+	Path []int64 `json:"-"`
+}
+
+// PostRevision records an edit of a post: Message is the text the edit replaced.
+type PostRevision struct {
+	Number  int64     `json:"number"`
+	Post    int64     `json:"post"`
+	Editor  string    `json:"editor"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message"`
+	Created time.Time `json:"created"`
 }
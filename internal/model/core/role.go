@@ -0,0 +1,9 @@
+package core
+
+// Roles of users. Admins and banned users are so everywhere, moderators only in the forums they moderate.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleBanned    = "banned"
+)
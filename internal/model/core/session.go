@@ -0,0 +1,10 @@
+package core
+
+import "time"
+
+type Session struct {
+	ID       string    `json:"id"`
+	Nickname string    `json:"nickname"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
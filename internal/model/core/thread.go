@@ -11,4 +11,8 @@ type Thread struct {
 	Votes   int64     `json:"votes"`
 	Slug    string    `json:"slug"`
 	Created time.Time `json:"created"`
+
+	Locked    bool       `json:"locked,omitempty"`
+	Pinned    bool       `json:"pinned,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+type LoginRequest struct {
+	Nickname string `json:"nickname"`
+	Password string `json:"password"`
+}
+
+// Session is handed out on login, its token is sent back as "Authorization: Bearer <token>".
+type Session struct {
+	Token    string    `json:"token"`
+	Nickname string    `json:"nickname"`
+	Expires  time.Time `json:"expires"`
+}
+
+// CreateAPIKeyRequest asks for a key of the user granted the scopes, in the forums when any are given.
+type CreateAPIKeyRequest struct {
+	Nickname string   `path:"nickname"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Forums   []string `json:"forums"`
+}
+
+// CreatedAPIKey carries the key itself, which is only ever shown in response to its creation.
+type CreatedAPIKey struct {
+	*core.APIKey
+	Key string `json:"key"`
+}
+
+type GetAPIKeysRequest struct {
+	Nickname string `path:"nickname"`
+}
+
+type RevokeAPIKeyRequest struct {
+	Nickname string `path:"nickname"`
+	ID       int64  `path:"id"`
+}
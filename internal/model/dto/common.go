@@ -1,10 +1,34 @@
 package dto
 
+import "time"
+
 type Response struct {
 	Data interface{}
 	Code int
+
+	// Next and Prev are set by paginated listings when there may be more rows in that direction.
+	Next *Cursor
+	Prev *Cursor
 }
 
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
+
+// Cursor is a position in a keyset-paginated listing: the sort key of a row and its id as a tiebreaker.
+// Clients only ever see it signed and encoded, see controllers.CursorCodec.
+type Cursor struct {
+	// Scope identifies the listing, so that a cursor can not be replayed against another one.
+	Scope string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	// Back continues the listing towards its beginning, starting before the row.
+	Back bool `json:"b,omitempty"`
+
+	Created  time.Time `json:"c,omitempty"`
+	Nickname string    `json:"n,omitempty"`
+	ID       int64     `json:"i,omitempty"`
+	Rank     float32   `json:"r,omitempty"`
+	Kind     string    `json:"k,omitempty"`
+	Pinned   bool      `json:"p,omitempty"`
+	Path     []int64   `json:"t,omitempty"`
+}
@@ -0,0 +1,61 @@
+package dto
+
+type WatchThreadRequest struct {
+	SlugOrID string `path:"slug_or_id"`
+	// LastEventID is the id of the last post the client has seen, -1 when it has not seen any.
+	// The posts created after it are sent before the live events.
+	LastEventID int64 `header:"Last-Event-ID"`
+}
+
+// ThreadEvent is sent to the clients watching a thread. Kind is post, edit or votes,
+// Data is a *core.Post for post and edit events and a *ThreadVotes for votes events.
+type ThreadEvent struct {
+	// ID is the id of the post of post events, the one to resume after. Other events have none.
+	ID   int64
+	Kind string
+	Data interface{}
+}
+
+type ThreadVotes struct {
+	Thread int64 `json:"thread"`
+	Votes  int64 `json:"votes"`
+}
+
+// Operations of gateway clients.
+const (
+	GatewaySubscribe   = "subscribe"
+	GatewayUnsubscribe = "unsubscribe"
+	GatewayPing        = "ping"
+)
+
+// Types of gateway messages that are not events.
+const (
+	GatewaySubscribed = "subscribed"
+	GatewayPong       = "pong"
+	GatewayError      = "error"
+)
+
+// Types of gateway events, the Data of their messages is given after each.
+const (
+	EventThreadCreated = "thread_created" // *core.Thread
+	EventPostCreated   = "post_created"   // *core.Post
+	EventPostEdited    = "post_edited"    // *core.Post
+	EventVoteChanged   = "vote_changed"   // *ThreadVotes
+	EventUserUpdated   = "user_updated"   // *core.User
+)
+
+// GatewayRequest is a message of a gateway client. Topics are forum:<slug>, thread:<id> and user:<nickname>,
+// a user topic covers the profile of the user along with the threads and posts they write.
+type GatewayRequest struct {
+	Op     string   `json:"op"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// GatewayMessage is sent to gateway clients: an event, the topics subscribed to after a subscribe
+// or an unsubscribe, a pong or an error.
+type GatewayMessage struct {
+	Type    string      `json:"type"`
+	Topics  []string    `json:"topics,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
@@ -1,25 +1,67 @@
 package dto
 
+import "github.com/senago/technopark-dbms/internal/model/core"
+
 type CreateForumRequest struct {
-	Title string `json:"title"`
-	User  string `json:"user"`
-	Slug  string `json:"slug"`
+	Title  string `json:"title"`
+	User   string `json:"user"`
+	Slug   string `json:"slug"`
+	Parent string `json:"parent"`
 }
 
 type GetForumBySlugRequest struct {
 	Slug string `path:"slug"`
 }
 
+type GetForumChildrenRequest struct {
+	Slug string `path:"slug"`
+}
+
+// ForumTree is a forum with its sub-forums, its totals include the counters of all of its descendants.
+type ForumTree struct {
+	*core.Forum
+	TotalPosts   int64        `json:"totalPosts"`
+	TotalThreads int64        `json:"totalThreads"`
+	Children     []*ForumTree `json:"children,omitempty"`
+}
+
 type GetForumThreadsRequest struct {
-	Slug  string `path:"slug"`
-	Limit int64  `query:"limit"`
-	Since string `query:"since"`
-	Desc  bool   `query:"desc"`
+	Slug   string  `path:"slug"`
+	Limit  int64   `query:"limit"`
+	Since  string  `query:"since"`
+	Desc   bool    `query:"desc"`
+	Cursor *Cursor `query:"cursor"`
 }
 
 type GetForumUsersRequest struct {
-	Slug  string `path:"slug"`
-	Limit int64  `query:"limit"`
-	Since string `query:"since"`
-	Desc  bool   `query:"desc"`
+	Slug   string  `path:"slug"`
+	Limit  int64   `query:"limit"`
+	Since  string  `query:"since"`
+	Desc   bool    `query:"desc"`
+	Cursor *Cursor `query:"cursor"`
+}
+
+// UpdateForumRequest leaves empty fields as they are, a new slug renames the forum.
+type UpdateForumRequest struct {
+	Title string `json:"title"`
+	User  string `json:"user"`
+	Slug  string `json:"slug"`
+}
+
+const (
+	// ForumDeleteArchive keeps the forum readable but rejects any new or changed content.
+	ForumDeleteArchive = "archive"
+	// ForumDeletePurge removes the forum with everything posted in it.
+	ForumDeletePurge = "purge"
+)
+
+type DeleteForumRequest struct {
+	Slug string `path:"slug"`
+	// Mode is either ForumDeleteArchive, the default, or ForumDeletePurge.
+	Mode string `query:"mode"`
+}
+
+type PurgedForum struct {
+	Threads int64 `json:"threads"`
+	Posts   int64 `json:"posts"`
 }
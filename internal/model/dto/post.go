@@ -15,6 +15,15 @@ type PostDetails struct {
 	Forum  *core.Forum  `json:"forum,omitempty"`
 }
 
+type GetPostsRequest struct {
+	SlugOrID string  `path:"slug_or_id"`
+	Sort     string  `query:"sort"`
+	Since    int64   `query:"since"`
+	Desc     bool    `query:"desc"`
+	Limit    int64   `query:"limit"`
+	Cursor   *Cursor `query:"cursor"`
+}
+
 type GetPostDetailsRequest struct {
 	ID      int64  `path:"id"`
 	Related string `query:"related"`
@@ -23,4 +32,39 @@ type GetPostDetailsRequest struct {
 type UpdatePostRequest struct {
 	ID      int64  `path:"id"`
 	Message string `json:"message"`
+	// Reason optionally explains the edit, it is kept with the revision.
+	Reason string `json:"reason"`
+}
+
+type GetPostRevisionsRequest struct {
+	ID int64 `path:"id"`
+}
+
+type GetPostRevisionDiffRequest struct {
+	ID     int64 `path:"id"`
+	Number int64 `path:"n"`
+}
+
+type PostRevisionDiff struct {
+	Post     int64  `json:"post"`
+	Revision int64  `json:"revision"`
+	Diff     string `json:"diff"`
+}
+
+type DeletePostRequest struct {
+	ID int64 `path:"id"`
+	// Hard removes the post and its replies instead of leaving a tombstone.
+	Hard bool `query:"hard"`
+}
+
+type DeletedPosts struct {
+	Deleted int64 `json:"deleted"`
+}
+
+type SplitPostRequest struct {
+	ID    int64  `path:"id"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+	// Message of the new thread, the message of the post when empty.
+	Message string `json:"message"`
 }
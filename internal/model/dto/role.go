@@ -0,0 +1,22 @@
+package dto
+
+type SetUserRoleRequest struct {
+	Nickname string `path:"nickname"`
+	Role     string `json:"role"`
+}
+
+type UserRole struct {
+	Nickname string `json:"nickname"`
+	Role     string `json:"role"`
+}
+
+type GetForumModeratorsRequest struct {
+	Slug string `path:"slug"`
+}
+
+// UpdateForumModeratorsRequest adds and removes moderators of a forum by nickname, removals going last.
+type UpdateForumModeratorsRequest struct {
+	Slug   string   `path:"slug"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
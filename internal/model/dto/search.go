@@ -0,0 +1,10 @@
+package dto
+
+type SearchRequest struct {
+	Query  string  `query:"q"`
+	Forum  string  `query:"forum"`
+	Author string  `query:"author"`
+	Type   string  `query:"type"`
+	Limit  int64   `query:"limit"`
+	Cursor *Cursor `query:"cursor"`
+}
@@ -20,3 +20,19 @@ type UpdateForumThreadRequest struct {
 	Title   string `json:"title"`
 	Message string `json:"message"`
 }
+
+// ModerateThreadRequest changes the moderation state of a thread, omitted fields are left as they are.
+type ModerateThreadRequest struct {
+	Locked  *bool `json:"locked"`
+	Pinned  *bool `json:"pinned"`
+	Deleted *bool `json:"deleted"`
+}
+
+type MoveThreadRequest struct {
+	Forum string `json:"forum"`
+}
+
+type MergeThreadRequest struct {
+	// Into is the slug or id of the thread that receives the posts.
+	Into string `json:"into"`
+}
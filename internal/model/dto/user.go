@@ -7,6 +7,8 @@ type CreateUserRequest struct {
 	Fullname string `json:"fullname"`
 	About    string `json:"about"`
 	Email    string `json:"email"`
+	// Password lets the user log in, users created without one can not.
+	Password string `json:"password"`
 }
 
 type GetUserProfileRequest struct {
@@ -20,4 +22,6 @@ type UpdateUserProfileRequest struct {
 	Fullname string `json:"fullname"`
 	About    string `json:"about"`
 	Email    string `json:"email"`
+	// Password replaces the password of the user when not empty.
+	Password string `json:"password"`
 }
@@ -0,0 +1,109 @@
+// Package ratelimit limits the rate of requests with token buckets, one per route group and identity,
+// kept by a pluggable store.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limit lets Burst requests through at once and Rate requests per second after that.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return fmt.Errorf("invalid rate limit: rate %v, burst %d", l.Rate, l.Burst)
+	}
+	return nil
+}
+
+// Store keeps the buckets of the limiter.
+type Store interface {
+	// Take takes a token from the bucket with the given key, which starts out full. Without a token left
+	// the request is not allowed, retryAfter tells when the next token will be there.
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Sweeper is a Store that keeps buckets until it is told to forget those that have refilled, see Limiter.Janitor.
+type Sweeper interface {
+	Store
+	// Sweep forgets the buckets nobody has taken a token from for longer than idle.
+	Sweep(ctx context.Context, idle time.Duration) (deleted int64, err error)
+}
+
+// Bucket is a token bucket, refilled on the go as tokens are taken.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket for the time passed since it was last updated and takes a token from it.
+func (b *Bucket) Take(limit Limit, now time.Time) (bool, time.Duration) {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(limit.Burst)
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens += elapsed.Seconds() * limit.Rate
+		if b.Tokens > float64(limit.Burst) {
+			b.Tokens = float64(limit.Burst)
+		}
+	}
+	b.Updated = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.Tokens) / limit.Rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled since it was last updated, so that it can be forgotten.
+func (b *Bucket) full(limit Limit, now time.Time) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+// sweepInterval is how often MemoryStore forgets the buckets that have refilled.
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	Bucket
+	limit Limit
+}
+
+// MemoryStore keeps buckets in the process, so every instance limits requests on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) >= sweepInterval {
+		for k, b := range s.buckets {
+			if b.full(b.limit, now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{limit: limit}
+		s.buckets[key] = b
+	}
+	allowed, retryAfter := b.Take(limit, now)
+	return allowed, retryAfter, nil
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}, swept: time.Now()}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+)
+
+// Limiter limits requests per route group and principal (see auth.Principal). Limits are looked up by group,
+// a "<group>_<kind>" entry takes precedence for principals of that kind, e.g. post_ip for anonymous posting.
+// Groups without an entry are not limited, nor are requests made with the admin token.
+type Limiter struct {
+	log    *customtypes.Logger
+	store  Store
+	groups map[string]Limit
+}
+
+// limited reports whether there is a limit for any identity in the group.
+func (l *Limiter) limited(group string) bool {
+	for _, kind := range []string{"", "_" + auth.PrincipalUser, "_" + auth.PrincipalKey, "_" + auth.PrincipalIP} {
+		if _, ok := l.groups[group+kind]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// refillTime is how long the slowest bucket takes to refill, a bucket left alone for longer is as good as a new one.
+func (l *Limiter) refillTime() time.Duration {
+	longest := time.Duration(0)
+	for _, limit := range l.groups {
+		if refill := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)); refill > longest {
+			longest = refill
+		}
+	}
+	return longest
+}
+
+func (l *Limiter) lookup(group, kind string) (Limit, bool) {
+	if limit, ok := l.groups[group+"_"+kind]; ok {
+		return limit, true
+	}
+	limit, ok := l.groups[group]
+	return limit, ok
+}
+
+// Middleware limits the requests of a route group, rejecting those over the limit with 429 Too Many Requests
+// and a Retry-After header. It has to run after the identity of the request is established.
+func (l *Limiter) Middleware(group string) fiber.Handler {
+	if !l.limited(group) {
+		return func(ctx *fiber.Ctx) error { return ctx.Next() }
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		userCtx := ctx.UserContext()
+		if auth.IsAdmin(userCtx) {
+			return ctx.Next()
+		}
+
+		kind, id := auth.Principal(userCtx, ctx.IP())
+		limit, ok := l.lookup(group, kind)
+		if !ok {
+			return ctx.Next()
+		}
+
+		allowed, retryAfter, err := l.store.Take(userCtx, group+":"+kind+":"+id, limit)
+		if err != nil {
+			// Limits protect the service, which is better off serving the request than failing it.
+			l.log.Warnw("rate limit store failed, letting the request through", "group", group, "error", err)
+			return ctx.Next()
+		}
+		if !allowed {
+			ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return constants.NewCodedError("Too many requests", http.StatusTooManyRequests)
+		}
+		return ctx.Next()
+	}
+}
+
+// Janitor makes a Sweeper store forget the buckets that have refilled every sweepInterval until ctx is done.
+// Other stores forget them on their own.
+func (l *Limiter) Janitor(ctx context.Context) {
+	sweeper, ok := l.store.(Sweeper)
+	if !ok || len(l.groups) == 0 {
+		return
+	}
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if deleted, err := sweeper.Sweep(ctx, l.refillTime()); err != nil {
+				l.log.Warnw("failed to delete refilled rate limit buckets", "error", err)
+			} else if deleted > 0 {
+				l.log.Debugw("deleted refilled rate limit buckets", "count", deleted)
+			}
+		}
+	}
+}
+
+// New returns a Limiter keeping buckets in store and applying limits by group, see Limiter.
+func New(log *customtypes.Logger, store Store, limits map[string]Limit) (*Limiter, error) {
+	for group, limit := range limits {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", group, err)
+		}
+	}
+	return &Limiter{log: log, store: store, groups: limits}, nil
+}
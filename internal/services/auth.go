@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is the number of bytes bcrypt looks at, longer passwords would be silently truncated.
+const maxPasswordLength = 72
+
+type AuthService interface {
+	Login(ctx context.Context, request *dto.LoginRequest) (*dto.Response, error)
+	Logout(ctx context.Context) (*dto.Response, error)
+	// Authenticate returns the identity established by a session token, which has to belong to a live session,
+	// or by an API key that has not been revoked.
+	Authenticate(ctx context.Context, token string) (*auth.Identity, error)
+
+	CreateAPIKey(ctx context.Context, request *dto.CreateAPIKeyRequest) (*dto.Response, error)
+	GetAPIKeys(ctx context.Context, request *dto.GetAPIKeysRequest) (*dto.Response, error)
+	RevokeAPIKey(ctx context.Context, request *dto.RevokeAPIKeyRequest) (*dto.Response, error)
+}
+
+type authServiceImpl struct {
+	log    *customtypes.Logger
+	db     *db.Repository
+	tokens *auth.Tokens
+	authz  *authorizer
+}
+
+func (svc *authServiceImpl) Login(ctx context.Context, request *dto.LoginRequest) (*dto.Response, error) {
+	nickname, hash, err := svc.db.UserRepository.GetUserPasswordHash(ctx, request.Nickname)
+	if err != nil && !errors.Is(err, constants.ErrDBNotFound) {
+		return nil, err
+	}
+	// Unknown users and users without a password fail just like a wrong password.
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(request.Password)) != nil {
+		return nil, constants.NewCodedError("Invalid nickname or password", http.StatusUnauthorized)
+	}
+
+	token, claims, err := svc.tokens.Issue(nickname)
+	if err != nil {
+		return nil, err
+	}
+	session := &core.Session{ID: claims.ID, Nickname: nickname, Created: time.Unix(claims.IssuedAt, 0), Expires: time.Unix(claims.ExpiresAt, 0)}
+	if err := svc.db.SessionRepository.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: &dto.Session{Token: token, Nickname: nickname, Expires: session.Expires}, Code: http.StatusOK}, nil
+}
+
+func (svc *authServiceImpl) Logout(ctx context.Context) (*dto.Response, error) {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if identity.Key != 0 {
+		return nil, constants.NewCodedError("API keys are revoked rather than logged out", http.StatusBadRequest)
+	}
+
+	if err := svc.db.SessionRepository.DeleteSession(ctx, identity.Session); err != nil && !errors.Is(err, constants.ErrDBNotFound) {
+		return nil, err
+	}
+
+	return &dto.Response{Code: http.StatusNoContent}, nil
+}
+
+func (svc *authServiceImpl) Authenticate(ctx context.Context, token string) (*auth.Identity, error) {
+	if auth.IsAPIKey(token) {
+		return svc.authenticateKey(ctx, token)
+	}
+
+	claims, err := svc.tokens.Verify(token)
+	if err != nil {
+		return nil, errInvalidSession
+	}
+
+	session, err := svc.db.SessionRepository.GetSession(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, errInvalidSession
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(session.Nickname, claims.Subject) {
+		return nil, errInvalidSession
+	}
+
+	return &auth.Identity{Nickname: session.Nickname, Session: session.ID}, nil
+}
+
+func (svc *authServiceImpl) authenticateKey(ctx context.Context, token string) (*auth.Identity, error) {
+	key, err := svc.db.APIKeyRepository.GetAPIKeyByHash(ctx, auth.HashAPIKey(token))
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, errInvalidKey
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, errInvalidKey
+	}
+	if err := svc.db.APIKeyRepository.TouchAPIKey(ctx, key.ID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &auth.Identity{Nickname: key.Nickname, Key: key.ID, Scopes: key.Scopes, Forums: key.Forums}, nil
+}
+
+func (svc *authServiceImpl) CreateAPIKey(ctx context.Context, request *dto.CreateAPIKeyRequest) (*dto.Response, error) {
+	if err := svc.authz.checkKeyOwner(ctx, request.Nickname); err != nil {
+		return nil, err
+	}
+
+	if len(request.Scopes) == 0 {
+		return nil, constants.NewCodedError("At least one scope is required", http.StatusBadRequest)
+	}
+	for _, scope := range request.Scopes {
+		switch scope {
+		case core.ScopeRead, core.ScopePost, core.ScopeVote, core.ScopeModerate:
+		default:
+			return nil, constants.NewCodedError(fmt.Sprintf("Unknown scope: %s", scope), http.StatusBadRequest)
+		}
+	}
+
+	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.Nickname)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Nickname), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	for i, slug := range request.Forums {
+		forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, slug)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", slug), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		request.Forums[i] = forum.Slug
+	}
+
+	token, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	key := &core.APIKey{
+		Nickname: user.Nickname,
+		Name:     request.Name,
+		Prefix:   prefix,
+		Hash:     auth.HashAPIKey(token),
+		Scopes:   request.Scopes,
+		Forums:   request.Forums,
+	}
+	if err := svc.db.APIKeyRepository.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: &dto.CreatedAPIKey{APIKey: key, Key: token}, Code: http.StatusCreated}, nil
+}
+
+func (svc *authServiceImpl) GetAPIKeys(ctx context.Context, request *dto.GetAPIKeysRequest) (*dto.Response, error) {
+	if err := svc.authz.checkKeyOwner(ctx, request.Nickname); err != nil {
+		return nil, err
+	}
+
+	keys, err := svc.db.APIKeyRepository.GetAPIKeys(ctx, request.Nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: keys, Code: http.StatusOK}, nil
+}
+
+func (svc *authServiceImpl) RevokeAPIKey(ctx context.Context, request *dto.RevokeAPIKeyRequest) (*dto.Response, error) {
+	if err := svc.authz.checkKeyOwner(ctx, request.Nickname); err != nil {
+		return nil, err
+	}
+
+	key, err := svc.db.APIKeyRepository.RevokeAPIKey(ctx, request.Nickname, request.ID)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find API key %d of user %s", request.ID, request.Nickname), http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	return &dto.Response{Data: key, Code: http.StatusOK}, nil
+}
+
+// hashPassword returns the bcrypt hash a password is stored as.
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", constants.NewCodedError("Password is too long", http.StatusBadRequest)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func NewAuthService(log *customtypes.Logger, db *db.Repository, tokens *auth.Tokens, enforceAuth bool) AuthService {
+	return &authServiceImpl{log: log, db: db, tokens: tokens, authz: newAuthorizer(db, enforceAuth)}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+var (
+	errUnauthenticated = constants.NewCodedError("Authentication required", http.StatusUnauthorized)
+	errInvalidSession  = constants.NewCodedError("Invalid or expired session token", http.StatusUnauthorized)
+	errInvalidKey      = constants.NewCodedError("Invalid or revoked API key", http.StatusUnauthorized)
+)
+
+// authorizer is consulted by the services before they act for the caller of a request. Requests made
+// with the admin token may do anything, otherwise the caller is the authenticated user, whose global role
+// and moderated forums decide what it may do beyond acting under its own nickname.
+type authorizer struct {
+	db *db.Repository
+	// enforce requires requests acting as a user to be made by that user. Without it the API stays open
+	// and only privileged operations look at the caller.
+	enforce bool
+}
+
+// checkActor makes sure that a request acting as the user with the given nickname is made by that user, who is not banned.
+func (a *authorizer) checkActor(ctx context.Context, nickname string) error {
+	if !a.enforce || auth.IsAdmin(ctx) {
+		return nil
+	}
+
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return errUnauthenticated
+	}
+	if !strings.EqualFold(identity.Nickname, nickname) {
+		return constants.NewCodedError(fmt.Sprintf("Can't act on behalf of user: %s", nickname), http.StatusForbidden)
+	}
+
+	role, err := a.db.RoleRepository.GetUserRole(ctx, identity.Nickname)
+	if err != nil {
+		return err
+	}
+	if role == core.RoleBanned {
+		return constants.NewCodedError(fmt.Sprintf("User %s is banned", identity.Nickname), http.StatusForbidden)
+	}
+	return nil
+}
+
+// checkAuthorOrModerator lets authors act on what they wrote and moderators of its forum on anything in it.
+func (a *authorizer) checkAuthorOrModerator(ctx context.Context, author, forum, action string) error {
+	if !a.enforce || auth.IsAdmin(ctx) {
+		return nil
+	}
+
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return errUnauthenticated
+	}
+	if strings.EqualFold(identity.Nickname, author) {
+		if err := a.checkScope(ctx, core.ScopePost, forum); err != nil {
+			return err
+		}
+		return a.checkActor(ctx, author)
+	}
+	return a.checkModerator(ctx, action, forum)
+}
+
+// checkModerator lets admins and those moderating every one of the forums perform an action.
+func (a *authorizer) checkModerator(ctx context.Context, action string, forums ...string) error {
+	if auth.IsAdmin(ctx) {
+		return nil
+	}
+
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return constants.NewCodedError(fmt.Sprintf("Only moderators can %s", action), http.StatusForbidden)
+	}
+	for _, forum := range forums {
+		if err := a.checkScope(ctx, core.ScopeModerate, forum); err != nil {
+			return err
+		}
+	}
+	role, err := a.db.RoleRepository.GetUserRole(ctx, identity.Nickname)
+	if err != nil || role == core.RoleAdmin {
+		return err
+	}
+	if role != core.RoleBanned {
+		moderator := true
+		for _, forum := range forums {
+			if moderator, err = a.db.RoleRepository.IsForumModerator(ctx, forum, identity.Nickname); err != nil {
+				return err
+			} else if !moderator {
+				break
+			}
+		}
+		if moderator {
+			return nil
+		}
+	}
+	return constants.NewCodedError(fmt.Sprintf("Only moderators can %s", action), http.StatusForbidden)
+}
+
+// checkOwner lets admins and the owner of the forum perform an action.
+func (a *authorizer) checkOwner(ctx context.Context, forum *core.Forum, action string) error {
+	if err := a.checkAdmin(ctx, action); err == nil {
+		return nil
+	}
+
+	identity, ok := auth.FromContext(ctx)
+	if ok && strings.EqualFold(identity.Nickname, forum.User) {
+		if err := a.checkScope(ctx, core.ScopeModerate, forum.Slug); err != nil {
+			return err
+		}
+		role, err := a.db.RoleRepository.GetUserRole(ctx, identity.Nickname)
+		if err != nil || role != core.RoleBanned {
+			return err
+		}
+	}
+	return constants.NewCodedError(fmt.Sprintf("Only forum owners can %s", action), http.StatusForbidden)
+}
+
+// checkAdmin lets only admins perform an action, with a session or a key that may moderate every forum.
+func (a *authorizer) checkAdmin(ctx context.Context, action string) error {
+	if auth.IsAdmin(ctx) {
+		return nil
+	}
+
+	if identity, ok := auth.FromContext(ctx); ok && identity.Permits(core.ScopeModerate, "") {
+		role, err := a.db.RoleRepository.GetUserRole(ctx, identity.Nickname)
+		if err != nil || role == core.RoleAdmin {
+			return err
+		}
+	}
+	return constants.NewCodedError(fmt.Sprintf("Only administrators can %s", action), http.StatusForbidden)
+}
+
+// checkScope makes sure a request made with an API key was granted the scope in the forum, or anywhere for an empty forum.
+func (a *authorizer) checkScope(ctx context.Context, scope, forum string) error {
+	identity, ok := auth.FromContext(ctx)
+	if !ok || identity.Permits(scope, forum) {
+		return nil
+	}
+	if forum != "" && identity.Grants(scope) {
+		return constants.NewCodedError(fmt.Sprintf("API key is not valid in forum %s", forum), http.StatusForbidden)
+	}
+	return constants.NewCodedError(fmt.Sprintf("API key lacks the %s scope", scope), http.StatusForbidden)
+}
+
+// checkSession rejects requests made with an API key, which can not change how their user is authenticated.
+func (a *authorizer) checkSession(ctx context.Context) error {
+	if identity, ok := auth.FromContext(ctx); ok && identity.Key != 0 {
+		return constants.NewCodedError("API keys can't manage keys or profiles", http.StatusForbidden)
+	}
+	return nil
+}
+
+// checkKeyOwner lets users manage their own API keys with a session and admins those of anyone,
+// whether auth is enforced or not.
+func (a *authorizer) checkKeyOwner(ctx context.Context, nickname string) error {
+	if err := a.checkSession(ctx); err != nil || auth.IsAdmin(ctx) {
+		return err
+	}
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return errUnauthenticated
+	}
+	if !strings.EqualFold(identity.Nickname, nickname) {
+		return a.checkAdmin(ctx, "manage API keys of others")
+	}
+
+	role, err := a.db.RoleRepository.GetUserRole(ctx, identity.Nickname)
+	if err != nil {
+		return err
+	}
+	if role == core.RoleBanned {
+		return constants.NewCodedError(fmt.Sprintf("User %s is banned", identity.Nickname), http.StatusForbidden)
+	}
+	return nil
+}
+
+func newAuthorizer(db *db.Repository, enforce bool) *authorizer {
+	return &authorizer{db: db, enforce: enforce}
+}
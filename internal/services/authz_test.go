@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+)
+
+func TestCheckAdminRequiresAKeyValidEverywhere(t *testing.T) {
+	ctx := context.Background()
+	repo, err := db.NewMemoryRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UserRepository.CreateUser(ctx, &core.User{Nickname: "root", Email: "root@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RoleRepository.SetUserRole(ctx, "root", core.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	authz := newAuthorizer(repo, true)
+
+	cases := []struct {
+		name     string
+		identity *auth.Identity
+		allowed  bool
+	}{
+		{"session", &auth.Identity{Nickname: "root", Session: "s"}, true},
+		{"unrestricted key", &auth.Identity{Nickname: "root", Key: 1, Scopes: []string{core.ScopeModerate}}, true},
+		{"forum-scoped key", &auth.Identity{Nickname: "root", Key: 2, Scopes: []string{core.ScopeModerate}, Forums: []string{"frm"}}, false},
+		{"key without moderate", &auth.Identity{Nickname: "root", Key: 3, Scopes: []string{core.ScopeRead, core.ScopePost}}, false},
+	}
+	for _, c := range cases {
+		err := authz.checkAdmin(auth.WithIdentity(ctx, c.identity), "clear the service")
+		if allowed := err == nil; allowed != c.allowed {
+			t.Errorf("%s: checkAdmin returned %v, want allowed %t", c.name, err, c.allowed)
+		}
+	}
+}
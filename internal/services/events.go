@@ -0,0 +1,502 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+const (
+	// eventWatcherBuffer is how far a watcher may fall behind before it is dropped. Thread streams
+	// reconnect with Last-Event-ID and catch up on the posts they missed, gateway clients subscribe again.
+	eventWatcherBuffer = 64
+	// eventsBuffer holds the events of the database while the rows of the previous ones are read.
+	eventsBuffer = 1024
+	// threadBacklogLimit caps the posts sent to a client resuming after Last-Event-ID,
+	// the rest is to be read from the posts of the thread.
+	threadBacklogLimit  = 1000
+	eventsListenBackoff = time.Second
+	// subscriptionTopicsLimit caps the topics a gateway client may be subscribed to at once.
+	subscriptionTopicsLimit = 100
+)
+
+// Reasons for the events of a subscription to end, see Subscription.Err.
+var (
+	ErrEventsFellBehind = errors.New("fell behind the events")
+	ErrEventsShutdown   = errors.New("the server is shutting down")
+)
+
+type EventsService interface {
+	// Run delivers the events of the database to watchers until ctx is done, then ends their streams.
+	Run(ctx context.Context)
+	// WatchThread streams the events of a thread. When the request has a LastEventID, the posts created after it come first.
+	WatchThread(ctx context.Context, request *dto.WatchThreadRequest) (*ThreadStream, error)
+	// Subscribe starts a subscription of the gateway, which gets no events until it is given topics.
+	Subscribe() *Subscription
+}
+
+// ThreadStream is a subscription to the events of a thread. Events is closed when the stream ends,
+// because of Close, a shutdown or the client falling behind.
+type ThreadStream struct {
+	Events <-chan *dto.ThreadEvent
+	stop   func()
+}
+
+func (s *ThreadStream) Close() {
+	s.stop()
+}
+
+// Subscription delivers the events of its topics to a gateway client. Events is closed when
+// the subscription ends, because of Close, a shutdown or the client falling behind.
+type Subscription struct {
+	Events <-chan *dto.GatewayMessage
+
+	svc     *eventsServiceImpl
+	watcher *eventWatcher
+	stop    func()
+}
+
+// Update subscribes to or unsubscribes from the topics of the request and returns the topics subscribed to.
+func (s *Subscription) Update(request *dto.GatewayRequest) ([]string, error) {
+	topics := make([]string, 0, len(request.Topics))
+	for _, topic := range request.Topics {
+		normalized, err := parseTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, normalized)
+	}
+
+	switch request.Op {
+	case dto.GatewaySubscribe:
+		return s.svc.follow(s.watcher, topics)
+	case dto.GatewayUnsubscribe:
+		return s.svc.unfollow(s.watcher, topics), nil
+	default:
+		return nil, constants.NewCodedError(fmt.Sprintf("Unknown operation: %s", request.Op), http.StatusBadRequest)
+	}
+}
+
+// Err tells why Events was closed: ErrEventsFellBehind, ErrEventsShutdown or nil after Close.
+func (s *Subscription) Err() error {
+	s.svc.mu.Lock()
+	defer s.svc.mu.Unlock()
+	return s.watcher.err
+}
+
+func (s *Subscription) Close() {
+	s.stop()
+}
+
+// forumEvent is an event of the database along with what it refers to, read once for all of its watchers.
+type forumEvent struct {
+	topics  []string
+	message *dto.GatewayMessage
+	// thread is what thread streams are sent, nil for events they do not show.
+	thread *dto.ThreadEvent
+}
+
+type eventWatcher struct {
+	events chan *forumEvent
+	topics map[string]struct{}
+	closed bool
+	err    error
+}
+
+type eventsServiceImpl struct {
+	log *customtypes.Logger
+	db  *db.Repository
+
+	mu       sync.Mutex
+	all      map[*eventWatcher]struct{}
+	watchers map[string]map[*eventWatcher]struct{} // by topic
+	// stopped is set once Run is over, watchers are not taken anymore.
+	stopped bool
+}
+
+func forumTopic(slug string) string {
+	return "forum:" + strings.ToLower(slug)
+}
+
+func threadTopic(id int64) string {
+	return "thread:" + strconv.FormatInt(id, 10)
+}
+
+func userTopic(nickname string) string {
+	return "user:" + strings.ToLower(nickname)
+}
+
+// parseTopic normalizes a topic given by a client, forum slugs and nicknames are case-insensitive.
+func parseTopic(topic string) (string, error) {
+	kind, name, _ := strings.Cut(topic, ":")
+	switch {
+	case name == "":
+	case kind == "forum":
+		return forumTopic(name), nil
+	case kind == "user":
+		return userTopic(name), nil
+	case kind == "thread":
+		if id, err := strconv.ParseInt(name, 10, 64); err == nil && id > 0 {
+			return threadTopic(id), nil
+		}
+	}
+	return "", constants.NewCodedError(fmt.Sprintf("Invalid topic: %s", topic), http.StatusBadRequest)
+}
+
+func (svc *eventsServiceImpl) Run(ctx context.Context) {
+	events := make(chan *core.Event, eventsBuffer)
+	go svc.deliver(ctx, events)
+
+	handle := func(event *core.Event) {
+		select {
+		case events <- event:
+		default:
+			svc.log.Warnf("events are coming faster than they are delivered, dropped a %s event", event.Kind)
+		}
+	}
+	for {
+		err := svc.db.EventsRepository.ListenEvents(ctx, handle)
+		if ctx.Err() != nil {
+			break
+		}
+		// Whatever happened while nobody was listening is lost, the watchers have to start over.
+		svc.log.Errorf("listening for events: %v", err)
+		svc.dropWatchers(ErrEventsFellBehind, false)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(eventsListenBackoff):
+		}
+	}
+	svc.dropWatchers(ErrEventsShutdown, true)
+}
+
+// deliver reads what the events refer to and hands them to their watchers.
+func (svc *eventsServiceImpl) deliver(ctx context.Context, events <-chan *core.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if !svc.watched() {
+				continue
+			}
+			resolved, err := svc.resolve(ctx, event)
+			if err != nil {
+				// A post removed along with its tree before it was read has nothing to show.
+				svc.log.Debugf("reading the rows of a %s event: %v", event.Kind, err)
+				continue
+			}
+			if resolved != nil {
+				svc.publish(resolved)
+			}
+		}
+	}
+}
+
+func (svc *eventsServiceImpl) resolve(ctx context.Context, event *core.Event) (*forumEvent, error) {
+	switch event.Kind {
+	case core.EventPost, core.EventEdit:
+		post, err := svc.db.PostsRepository.GetPostByID(ctx, event.Post)
+		if err != nil {
+			return nil, err
+		}
+		resolved := &forumEvent{
+			topics:  []string{forumTopic(post.Forum), threadTopic(post.Thread), userTopic(post.Author)},
+			message: &dto.GatewayMessage{Type: dto.EventPostEdited, Data: post},
+			thread:  &dto.ThreadEvent{Kind: event.Kind, Data: post},
+		}
+		if event.Kind == core.EventPost {
+			resolved.message.Type = dto.EventPostCreated
+			resolved.thread.ID = post.ID
+		}
+		return resolved, nil
+
+	case core.EventVotes:
+		thread, err := svc.db.ForumThreadRepository.GetForumThreadByID(ctx, event.Thread)
+		if err != nil {
+			return nil, err
+		}
+		// The total of the event is the one the change made, the thread may have been voted on again since.
+		votes := &dto.ThreadVotes{Thread: event.Thread, Votes: event.Votes}
+		return &forumEvent{
+			topics:  []string{forumTopic(thread.Forum), threadTopic(thread.ID)},
+			message: &dto.GatewayMessage{Type: dto.EventVoteChanged, Data: votes},
+			thread:  &dto.ThreadEvent{Kind: event.Kind, Data: votes},
+		}, nil
+
+	case core.EventThread:
+		thread, err := svc.db.ForumThreadRepository.GetForumThreadByID(ctx, event.Thread)
+		if err != nil {
+			return nil, err
+		}
+		return &forumEvent{
+			topics:  []string{forumTopic(thread.Forum), threadTopic(thread.ID), userTopic(thread.Author)},
+			message: &dto.GatewayMessage{Type: dto.EventThreadCreated, Data: thread},
+		}, nil
+
+	case core.EventUser:
+		user, err := svc.db.UserRepository.GetUserByNickname(ctx, event.Nickname)
+		if err != nil {
+			return nil, err
+		}
+		return &forumEvent{
+			topics:  []string{userTopic(user.Nickname)},
+			message: &dto.GatewayMessage{Type: dto.EventUserUpdated, Data: user},
+		}, nil
+	}
+	return nil, nil
+}
+
+func (svc *eventsServiceImpl) watched() bool {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return len(svc.watchers) > 0
+}
+
+// publish hands the event to its watchers once each, dropping those that have fallen behind.
+func (svc *eventsServiceImpl) publish(event *forumEvent) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	sent := map[*eventWatcher]struct{}{}
+	for _, topic := range event.topics {
+		for watcher := range svc.watchers[topic] {
+			if _, ok := sent[watcher]; ok {
+				continue
+			}
+			sent[watcher] = struct{}{}
+
+			select {
+			case watcher.events <- event:
+			default:
+				svc.drop(watcher, ErrEventsFellBehind)
+			}
+		}
+	}
+}
+
+// newWatcher returns a watcher without topics, one that is closed already once Run is over.
+func (svc *eventsServiceImpl) newWatcher() *eventWatcher {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	watcher := &eventWatcher{events: make(chan *forumEvent, eventWatcherBuffer), topics: map[string]struct{}{}}
+	if svc.stopped {
+		watcher.closed, watcher.err = true, ErrEventsShutdown
+		close(watcher.events)
+		return watcher
+	}
+	svc.all[watcher] = struct{}{}
+	return watcher
+}
+
+func (svc *eventsServiceImpl) follow(watcher *eventWatcher, topics []string) ([]string, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	if watcher.closed {
+		return watcher.topicList(), nil
+	}
+	added := map[string]struct{}{}
+	for _, topic := range topics {
+		if _, ok := watcher.topics[topic]; !ok {
+			added[topic] = struct{}{}
+		}
+	}
+	if len(watcher.topics)+len(added) > subscriptionTopicsLimit {
+		return nil, constants.NewCodedError(fmt.Sprintf("At most %d topics may be subscribed to", subscriptionTopicsLimit), http.StatusBadRequest)
+	}
+
+	for topic := range added {
+		watcher.topics[topic] = struct{}{}
+		if svc.watchers[topic] == nil {
+			svc.watchers[topic] = map[*eventWatcher]struct{}{}
+		}
+		svc.watchers[topic][watcher] = struct{}{}
+	}
+	return watcher.topicList(), nil
+}
+
+func (svc *eventsServiceImpl) unfollow(watcher *eventWatcher, topics []string) []string {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for _, topic := range topics {
+		svc.removeTopic(watcher, topic)
+	}
+	return watcher.topicList()
+}
+
+// removeTopic stops sending the events of the topic to the watcher, svc.mu must be held.
+func (svc *eventsServiceImpl) removeTopic(watcher *eventWatcher, topic string) {
+	delete(watcher.topics, topic)
+	watchers := svc.watchers[topic]
+	delete(watchers, watcher)
+	if len(watchers) == 0 {
+		delete(svc.watchers, topic)
+	}
+}
+
+// drop removes a watcher from all of its topics and closes its events for the reason given by err,
+// svc.mu must be held.
+func (svc *eventsServiceImpl) drop(watcher *eventWatcher, err error) {
+	if watcher.closed {
+		return
+	}
+	for topic := range watcher.topics {
+		svc.removeTopic(watcher, topic)
+	}
+	delete(svc.all, watcher)
+	watcher.closed, watcher.err = true, err
+	close(watcher.events)
+}
+
+// dropWatchers ends every stream, for good when stop is set.
+func (svc *eventsServiceImpl) dropWatchers(err error, stop bool) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for watcher := range svc.all {
+		svc.drop(watcher, err)
+	}
+	svc.stopped = svc.stopped || stop
+}
+
+func (svc *eventsServiceImpl) stopWatcher(watcher *eventWatcher) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.drop(watcher, nil)
+}
+
+// topicList returns the topics of the watcher in order, svc.mu must be held.
+func (watcher *eventWatcher) topicList() []string {
+	topics := make([]string, 0, len(watcher.topics))
+	for topic := range watcher.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (svc *eventsServiceImpl) WatchThread(ctx context.Context, request *dto.WatchThreadRequest) (*ThreadStream, error) {
+	thread, err := findThread(ctx, svc.db, request.SlugOrID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkThreadVisible(thread); err != nil {
+		return nil, err
+	}
+
+	// The watcher follows the thread before the backlog is read, so that no post falls in between.
+	watcher := svc.newWatcher()
+	if _, err := svc.follow(watcher, []string{threadTopic(thread.ID)}); err != nil {
+		svc.stopWatcher(watcher)
+		return nil, err
+	}
+
+	backlog := []*dto.ThreadEvent{}
+	replayed := map[int64]struct{}{}
+	if request.LastEventID >= 0 {
+		posts, err := svc.db.PostsRepository.GetPostsFlat(ctx, int(thread.ID), request.LastEventID, false, threadBacklogLimit)
+		if err != nil {
+			svc.stopWatcher(watcher)
+			return nil, err
+		}
+		for _, post := range posts {
+			backlog = append(backlog, &dto.ThreadEvent{ID: post.ID, Kind: core.EventPost, Data: post})
+			replayed[post.ID] = struct{}{}
+		}
+	}
+
+	events := make(chan *dto.ThreadEvent)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(events)
+		defer svc.stopWatcher(watcher)
+
+		for _, event := range backlog {
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+		for {
+			select {
+			case event, ok := <-watcher.events:
+				if !ok {
+					return
+				}
+				if event.thread == nil {
+					continue
+				}
+				// Posts of the backlog may be announced again by the events that arrived while it was read.
+				if _, ok := replayed[event.thread.ID]; ok {
+					continue
+				}
+				select {
+				case events <- event.thread:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return &ThreadStream{Events: events, stop: func() { once.Do(func() { close(done) }) }}, nil
+}
+
+func (svc *eventsServiceImpl) Subscribe() *Subscription {
+	watcher := svc.newWatcher()
+
+	events := make(chan *dto.GatewayMessage)
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case event, ok := <-watcher.events:
+				if !ok {
+					return
+				}
+				select {
+				case events <- event.message:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			svc.stopWatcher(watcher)
+		})
+	}
+	return &Subscription{Events: events, svc: svc, watcher: watcher, stop: stop}
+}
+
+func NewEventsService(log *customtypes.Logger, db *db.Repository) EventsService {
+	return &eventsServiceImpl{log: log, db: db, all: map[*eventWatcher]struct{}{}, watchers: map[string]map[*eventWatcher]struct{}{}}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/customtypes"
@@ -18,11 +19,16 @@ type ForumService interface {
 	GetForumBySlug(ctx context.Context, request *dto.GetForumBySlugRequest) (*dto.Response, error)
 	GetForumThreads(ctx context.Context, request *dto.GetForumThreadsRequest) (*dto.Response, error)
 	GetForumUsers(ctx context.Context, request *dto.GetForumUsersRequest) (*dto.Response, error)
+	GetForumChildren(ctx context.Context, request *dto.GetForumChildrenRequest) (*dto.Response, error)
+	GetForumTree(ctx context.Context) (*dto.Response, error)
+	UpdateForum(ctx context.Context, slug string, request *dto.UpdateForumRequest) (*dto.Response, error)
+	DeleteForum(ctx context.Context, request *dto.DeleteForumRequest) (*dto.Response, error)
 }
 
 type forumServiceImpl struct {
-	log *customtypes.Logger
-	db  *db.Repository
+	log   *customtypes.Logger
+	db    *db.Repository
+	authz *authorizer
 }
 
 func (svc *forumServiceImpl) CreateForum(ctx context.Context, request *dto.CreateForumRequest) (*dto.Response, error) {
@@ -37,12 +43,24 @@ func (svc *forumServiceImpl) CreateForum(ctx context.Context, request *dto.Creat
 	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.User)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", request.User)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.User), http.StatusNotFound)
 		}
+		return nil, err
 	}
 	request.User = user.Nickname
 
-	if err := svc.db.ForumRepository.CreateForum(ctx, &core.Forum{Title: request.Title, User: request.User, Slug: request.Slug}); err != nil {
+	if request.Parent != "" {
+		parent, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Parent)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find parent forum with slug: %s", request.Parent), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		request.Parent = parent.Slug
+	}
+
+	if err := svc.db.ForumRepository.CreateForum(ctx, &core.Forum{Title: request.Title, User: request.User, Slug: request.Slug, Parent: request.Parent}); err != nil {
 		return nil, err
 	}
 
@@ -58,8 +76,9 @@ func (svc *forumServiceImpl) GetForumBySlug(ctx context.Context, request *dto.Ge
 	forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Slug)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find forum with slug: %s", request.Slug)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
 		}
+		return nil, err
 	}
 	return &dto.Response{Data: forum, Code: http.StatusOK}, nil
 }
@@ -67,37 +86,244 @@ func (svc *forumServiceImpl) GetForumBySlug(ctx context.Context, request *dto.Ge
 func (svc *forumServiceImpl) GetForumThreads(ctx context.Context, request *dto.GetForumThreadsRequest) (*dto.Response, error) {
 	if forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Slug); err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find forum with slug: %s", request.Slug)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
 		}
+		return nil, err
 	} else {
 		request.Slug = forum.Slug
 	}
 
-	threads, err := svc.db.ForumRepository.GetForumThreads(ctx, request.Slug, request.Limit, request.Since, request.Desc)
+	scope := "threads:" + strings.ToLower(request.Slug)
+	if err := checkCursor(request.Cursor, scope); err != nil {
+		return nil, err
+	}
+
+	var threads []*core.Thread
+	var err error
+	if request.Cursor == nil {
+		threads, err = svc.db.ForumRepository.GetForumThreads(ctx, request.Slug, request.Limit, request.Since, request.Desc)
+	} else {
+		request.Desc = request.Cursor.Desc
+		after, _ := keysetOf(request.Cursor)
+		threads, err = svc.db.ForumRepository.GetForumThreadsPage(ctx, request.Slug, request.Limit, after, request.Cursor.Desc, request.Cursor.Back)
+		if request.Cursor.Back {
+			reverse(threads)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &dto.Response{Data: threads, Code: http.StatusOK}, nil
+	next, prev := pageCursors(threads, request.Limit, request.Cursor, scope, request.Desc, func(t *core.Thread) dto.Cursor {
+		return dto.Cursor{Pinned: t.Pinned, Created: t.Created, ID: t.ID}
+	})
+
+	return &dto.Response{Data: threads, Code: http.StatusOK, Next: next, Prev: prev}, nil
 }
 
 func (svc *forumServiceImpl) GetForumUsers(ctx context.Context, request *dto.GetForumUsersRequest) (*dto.Response, error) {
 	if forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Slug); err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find forum with slug: %s", request.Slug)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
+		}
+		return nil, err
+	} else {
+		request.Slug = forum.Slug
+	}
+
+	scope := "users:" + strings.ToLower(request.Slug)
+	if err := checkCursor(request.Cursor, scope); err != nil {
+		return nil, err
+	}
+
+	var users []*core.User
+	var err error
+	if request.Cursor == nil {
+		users, err = svc.db.ForumRepository.GetForumUsers(ctx, request.Slug, request.Limit, request.Since, request.Desc)
+	} else {
+		request.Desc = request.Cursor.Desc
+		after, desc := keysetOf(request.Cursor)
+		users, err = svc.db.ForumRepository.GetForumUsersPage(ctx, request.Slug, request.Limit, after, desc)
+		if request.Cursor.Back {
+			reverse(users)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next, prev := pageCursors(users, request.Limit, request.Cursor, scope, request.Desc, func(u *core.User) dto.Cursor {
+		return dto.Cursor{Nickname: u.Nickname}
+	})
+
+	return &dto.Response{Data: users, Code: http.StatusOK, Next: next, Prev: prev}, nil
+}
+
+func (svc *forumServiceImpl) GetForumChildren(ctx context.Context, request *dto.GetForumChildrenRequest) (*dto.Response, error) {
+	forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Slug)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	children, err := svc.db.ForumRepository.GetForumChildren(ctx, forum.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: children, Code: http.StatusOK}, nil
+}
+
+// GetForumTree lists the top-level forums with their sub-forums nested in them. The hierarchy is small
+// compared to the posts in it, so it is read at once and rolled up here rather than kept up to date by triggers.
+func (svc *forumServiceImpl) GetForumTree(ctx context.Context) (*dto.Response, error) {
+	forums, err := svc.db.ForumRepository.GetForums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*dto.ForumTree, len(forums))
+	for _, forum := range forums {
+		nodes[strings.ToLower(forum.Slug)] = &dto.ForumTree{Forum: forum}
+	}
+
+	roots := []*dto.ForumTree{}
+	for _, forum := range forums {
+		node := nodes[strings.ToLower(forum.Slug)]
+		if parent, ok := nodes[strings.ToLower(forum.Parent)]; ok && forum.Parent != "" {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for _, root := range roots {
+		rollUp(root)
+	}
+
+	return &dto.Response{Data: roots, Code: http.StatusOK}, nil
+}
+
+// rollUp sums the counters of a forum and its descendants into the totals of each of them.
+func rollUp(node *dto.ForumTree) {
+	node.TotalPosts, node.TotalThreads = node.Posts, node.Threads
+	for _, child := range node.Children {
+		rollUp(child)
+		node.TotalPosts += child.TotalPosts
+		node.TotalThreads += child.TotalThreads
+	}
+}
+
+func (svc *forumServiceImpl) UpdateForum(ctx context.Context, slug string, request *dto.UpdateForumRequest) (*dto.Response, error) {
+	forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", slug), http.StatusNotFound)
 		}
+		return nil, err
+	}
+
+	// Moderators look after the title, while handing the forum over or renaming it is up to admins.
+	if (request.User == "" || strings.EqualFold(request.User, forum.User)) && (request.Slug == "" || request.Slug == forum.Slug) {
+		err = svc.authz.checkModerator(ctx, "update forums", forum.Slug)
+	} else {
+		err = svc.authz.checkAdmin(ctx, "change the owner or slug of forums")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Title == "" {
+		request.Title = forum.Title
+	}
+
+	if request.User == "" {
+		request.User = forum.User
 	} else {
+		user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.User)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.User), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		request.User = user.Nickname
+	}
+
+	if request.Slug == "" {
 		request.Slug = forum.Slug
+	} else if !strings.EqualFold(request.Slug, forum.Slug) {
+		if existing, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Slug); err != nil {
+			if !errors.Is(err, constants.ErrDBNotFound) {
+				return nil, err
+			}
+		} else {
+			return &dto.Response{Data: existing, Code: http.StatusConflict}, nil
+		}
 	}
 
-	threads, err := svc.db.ForumRepository.GetForumUsers(ctx, request.Slug, request.Limit, request.Since, request.Desc)
+	forum, err = svc.db.ForumRepository.UpdateForum(ctx, forum.Slug, &core.Forum{Title: request.Title, User: request.User, Slug: request.Slug})
 	if err != nil {
 		return nil, err
 	}
 
-	return &dto.Response{Data: threads, Code: http.StatusOK}, nil
+	return &dto.Response{Data: forum, Code: http.StatusOK}, nil
+}
+
+func (svc *forumServiceImpl) DeleteForum(ctx context.Context, request *dto.DeleteForumRequest) (*dto.Response, error) {
+	switch request.Mode {
+	case "", dto.ForumDeleteArchive:
+		if err := svc.authz.checkModerator(ctx, "archive forums", request.Slug); err != nil {
+			return nil, err
+		}
+		forum, err := svc.db.ForumRepository.ArchiveForum(ctx, request.Slug)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		return &dto.Response{Data: forum, Code: http.StatusOK}, nil
+	case dto.ForumDeletePurge:
+		if err := svc.authz.checkAdmin(ctx, "purge forums"); err != nil {
+			return nil, err
+		}
+		purged := &dto.PurgedForum{}
+		err := svc.db.WithTx(ctx, func(repo *db.Repository) error {
+			var err error
+			purged.Threads, purged.Posts, err = repo.ForumRepository.PurgeForum(ctx, request.Slug)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Slug), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		return &dto.Response{Data: purged, Code: http.StatusOK}, nil
+	default:
+		return nil, constants.NewCodedError(fmt.Sprintf("Unknown delete mode: %s", request.Mode), http.StatusBadRequest)
+	}
+}
+
+// checkForumOpen rejects new or changed threads, posts and votes in archived forums.
+func checkForumOpen(forum *core.Forum) error {
+	if forum.ArchivedAt != nil {
+		return constants.NewCodedError(fmt.Sprintf("Forum %s is archived", forum.Slug), http.StatusForbidden)
+	}
+	return nil
+}
+
+// checkForumOpenBySlug is checkForumOpen for the forum a thread or post belongs to.
+func checkForumOpenBySlug(ctx context.Context, repo *db.Repository, slug string) error {
+	forum, err := repo.ForumRepository.GetForumBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	return checkForumOpen(forum)
 }
 
-func NewForumService(log *customtypes.Logger, db *db.Repository) ForumService {
-	return &forumServiceImpl{log: log, db: db}
+func NewForumService(log *customtypes.Logger, db *db.Repository, enforceAuth bool) ForumService {
+	return &forumServiceImpl{log: log, db: db, authz: newAuthorizer(db, enforceAuth)}
 }
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+var errInvalidCursor = constants.NewCodedError("Invalid cursor", http.StatusBadRequest)
+
+// checkCursor rejects cursors that were issued for another listing.
+func checkCursor(cursor *dto.Cursor, scope string) error {
+	if cursor != nil && cursor.Scope != scope {
+		return errInvalidCursor
+	}
+	return nil
+}
+
+// keysetOf returns the position the page following cursor starts after,
+// and the direction to query in so that the page's rows come first.
+func keysetOf(cursor *dto.Cursor) (*db.Keyset, bool) {
+	return &db.Keyset{Created: cursor.Created, Nickname: cursor.Nickname, ID: cursor.ID, Rank: cursor.Rank, Kind: cursor.Kind, Pinned: cursor.Pinned, Path: cursor.Path}, cursor.Desc != cursor.Back
+}
+
+// pageCursors computes the cursors around a page of rows, given in listing order.
+// Moving forward there is a next page when the page is full and a previous one when the page was reached by cursor;
+// moving back the rules are swapped.
+func pageCursors[T any](rows []T, limit int64, cursor *dto.Cursor, scope string, desc bool, key func(T) dto.Cursor) (next, prev *dto.Cursor) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	full := limit > 0 && int64(len(rows)) >= limit
+	back := cursor != nil && cursor.Back
+
+	if full || back {
+		c := key(rows[len(rows)-1])
+		c.Scope, c.Desc = scope, desc
+		next = &c
+	}
+	if (!back && cursor != nil) || (back && full) {
+		c := key(rows[0])
+		c.Scope, c.Desc, c.Back = scope, desc, true
+		prev = &c
+	}
+
+	return next, prev
+}
+
+func reverse[T any](rows []T) {
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/senago/technopark-dbms/internal/auth"
 	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/diff"
 	"github.com/senago/technopark-dbms/internal/model/core"
 	"github.com/senago/technopark-dbms/internal/model/dto"
 )
@@ -17,18 +21,29 @@ import (
 type PostsService interface {
 	CreatePosts(ctx context.Context, slugOrID string, posts []*dto.PostData) (*dto.Response, error)
 
-	GetPosts(ctx context.Context, slugOrID string, sort string, since int64, desc bool, limit int64) (*dto.Response, error)
+	GetPosts(ctx context.Context, request *dto.GetPostsRequest) (*dto.Response, error)
 	GetPostDetails(ctx context.Context, request *dto.GetPostDetailsRequest) (*dto.Response, error)
 
 	UpdatePost(ctx context.Context, request *dto.UpdatePostRequest) (*dto.Response, error)
+	GetPostRevisions(ctx context.Context, request *dto.GetPostRevisionsRequest) (*dto.Response, error)
+	GetPostRevisionDiff(ctx context.Context, request *dto.GetPostRevisionDiffRequest) (*dto.Response, error)
+	DeletePost(ctx context.Context, request *dto.DeletePostRequest) (*dto.Response, error)
+	SplitPost(ctx context.Context, request *dto.SplitPostRequest) (*dto.Response, error)
 }
 
 type postsServiceImpl struct {
-	log *customtypes.Logger
-	db  *db.Repository
+	log   *customtypes.Logger
+	db    *db.Repository
+	authz *authorizer
 }
 
 func (svc *postsServiceImpl) CreatePosts(ctx context.Context, slugOrID string, posts []*dto.PostData) (*dto.Response, error) {
+	for _, post := range posts {
+		if err := svc.authz.checkActor(ctx, post.Author); err != nil {
+			return nil, err
+		}
+	}
+
 	var id int
 	var err error
 	id, err = strconv.Atoi(slugOrID)
@@ -37,91 +52,209 @@ func (svc *postsServiceImpl) CreatePosts(ctx context.Context, slugOrID string, p
 	if err != nil {
 		if thread, err = svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID), http.StatusNotFound)
 			}
+			return nil, err
 		} else {
 			id = int(thread.ID)
 		}
 	} else {
 		if thread, err = svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id)); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by id: %d", id)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", id), http.StatusNotFound)
 			}
+			return nil, err
 		}
 	}
+	if err := checkThreadOpen(thread); err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkScope(ctx, core.ScopePost, thread.Forum); err != nil {
+		return nil, err
+	}
+	if err := checkForumOpenBySlug(ctx, svc.db, thread.Forum); err != nil {
+		return nil, err
+	}
 
 	if len(posts) == 0 {
 		return &dto.Response{Data: []struct{}{}, Code: http.StatusCreated}, nil
 	}
 
-	if posts[0].Parent != 0 {
-		parentThreadID, err := svc.db.PostsRepository.CheckParentPost(ctx, int(posts[0].Parent))
-		if err != nil {
-			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: "Parent post was created in another thread"}, Code: http.StatusConflict}, nil
-			}
+	var insertedPosts []*core.Post
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		if err := svc.validatePosts(ctx, repo, int64(id), posts); err != nil {
+			return err
 		}
 
-		if parentThreadID != id {
-			return &dto.Response{Data: dto.ErrorResponse{Message: "Parent post was created in another thread"}, Code: http.StatusConflict}, nil
-		}
+		var err error
+		insertedPosts, err = repo.PostsRepository.CreatePosts(ctx, thread.Forum, int64(id), posts)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := svc.db.UserRepository.GetUserByNickname(ctx, posts[0].Author); err != nil {
-		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", posts[0].Author)}, Code: http.StatusNotFound}, nil
+	return &dto.Response{Data: insertedPosts, Code: http.StatusCreated}, nil
+}
+
+// validatePosts checks that every post of the batch has an existing author and, if it has a parent,
+// that the parent belongs to the given thread. Authors are normalized to their stored nicknames.
+// The error for the first offending post is returned, or nil if the whole batch is valid.
+func (svc *postsServiceImpl) validatePosts(ctx context.Context, repo *db.Repository, threadID int64, posts []*dto.PostData) error {
+	nicknames := make([]string, 0, len(posts))
+	parents := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		nicknames = append(nicknames, post.Author)
+		if post.Parent != 0 {
+			parents = append(parents, post.Parent)
 		}
 	}
 
-	insertedPosts, err := svc.db.PostsRepository.CreatePosts(ctx, thread.Forum, int64(id), posts)
+	authors, err := repo.UserRepository.GetUsersByNicknames(ctx, nicknames)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	knownAuthors := make(map[string]string, len(authors))
+	for _, author := range authors {
+		knownAuthors[strings.ToLower(author.Nickname)] = author.Nickname
 	}
 
-	return &dto.Response{Data: insertedPosts, Code: http.StatusCreated}, nil
+	parentThreads := map[int64]int64{}
+	if len(parents) > 0 {
+		if parentThreads, err = repo.PostsRepository.GetPostsThreads(ctx, parents); err != nil {
+			return err
+		}
+	}
+
+	for _, post := range posts {
+		if post.Parent != 0 {
+			if parentThreadID, ok := parentThreads[post.Parent]; !ok || parentThreadID != threadID {
+				return constants.ErrParentPostConflict
+			}
+		}
+
+		nickname, ok := knownAuthors[strings.ToLower(post.Author)]
+		if !ok {
+			return constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", post.Author), http.StatusNotFound)
+		}
+		post.Author = nickname
+	}
+
+	return nil
 }
 
-func (svc *postsServiceImpl) GetPosts(ctx context.Context, slugOrID string, sort string, since int64, desc bool, limit int64) (*dto.Response, error) {
+func (svc *postsServiceImpl) GetPosts(ctx context.Context, request *dto.GetPostsRequest) (*dto.Response, error) {
+	slugOrID := request.SlugOrID
 	id, err := strconv.Atoi(slugOrID)
 	if err != nil {
 		if thread, err := svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID), http.StatusNotFound)
 			}
+			return nil, err
 		} else {
 			id = int(thread.ID)
 		}
 	}
 
-	if _, err := svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id)); err != nil {
+	thread, err := svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id))
+	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by id: %d", id)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", id), http.StatusNotFound)
 		}
+		return nil, err
+	}
+	if err := checkThreadVisible(thread); err != nil {
+		return nil, err
 	}
 
-	var posts []*core.Post
-	switch sort {
-	case "flat":
-		posts, err = svc.db.PostsRepository.GetPostsFlat(ctx, id, since, desc, limit)
-	case "tree":
-		posts, err = svc.db.PostsRepository.GetPostsTree(ctx, id, since, desc, limit)
-	case "parent_tree":
-		posts, err = svc.db.PostsRepository.GetPostsParentTree(ctx, id, since, desc, limit)
+	switch request.Sort {
+	case "flat", "tree", "parent_tree":
 	default:
-		posts, err = svc.db.PostsRepository.GetPostsFlat(ctx, id, since, desc, limit)
+		request.Sort = "flat"
+	}
+
+	scope := fmt.Sprintf("posts:%d:%s", id, request.Sort)
+	if err := checkCursor(request.Cursor, scope); err != nil {
+		return nil, err
+	}
+	// tree pages continue after the path of the row, which outlives the row itself.
+	if request.Cursor != nil && request.Sort == "tree" && len(request.Cursor.Path) == 0 {
+		return nil, errInvalidCursor
+	}
+
+	var posts []*core.Post
+	if request.Cursor == nil {
+		switch request.Sort {
+		case "tree":
+			posts, err = svc.db.PostsRepository.GetPostsTree(ctx, id, request.Since, request.Desc, request.Limit)
+		case "parent_tree":
+			posts, err = svc.db.PostsRepository.GetPostsParentTree(ctx, id, request.Since, request.Desc, request.Limit)
+		default:
+			posts, err = svc.db.PostsRepository.GetPostsFlat(ctx, id, request.Since, request.Desc, request.Limit)
+		}
+	} else {
+		request.Desc = request.Cursor.Desc
+		after, desc := keysetOf(request.Cursor)
+		switch request.Sort {
+		case "tree":
+			posts, err = svc.db.PostsRepository.GetPostsTreePage(ctx, int64(id), request.Limit, after, desc)
+		case "parent_tree":
+			posts, err = svc.db.PostsRepository.GetPostsParentTreePage(ctx, int64(id), request.Limit, after, desc)
+		default:
+			posts, err = svc.db.PostsRepository.GetPostsFlatPage(ctx, int64(id), request.Limit, after, desc)
+		}
+		if request.Cursor.Back {
+			if request.Sort == "parent_tree" {
+				reverseSubtrees(posts)
+			} else {
+				reverse(posts)
+			}
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &dto.Response{Data: posts, Code: http.StatusOK}, nil
+	// parent_tree pages are counted in root posts, so are its cursors.
+	keyed := posts
+	if request.Sort == "parent_tree" {
+		keyed = make([]*core.Post, 0, len(posts))
+		for _, post := range posts {
+			if post.Parent == 0 {
+				keyed = append(keyed, post)
+			}
+		}
+	}
+	next, prev := pageCursors(keyed, request.Limit, request.Cursor, scope, request.Desc, func(p *core.Post) dto.Cursor {
+		if request.Sort == "tree" {
+			return dto.Cursor{ID: p.ID, Path: p.Path}
+		}
+		return dto.Cursor{Created: p.Created, ID: p.ID}
+	})
+
+	return &dto.Response{Data: posts, Code: http.StatusOK, Next: next, Prev: prev}, nil
+}
+
+// reverseSubtrees reverses the order of the subtrees of a parent_tree listing, keeping every subtree in path order.
+func reverseSubtrees(posts []*core.Post) {
+	reversed := make([]*core.Post, 0, len(posts))
+	for end := len(posts); end > 0; {
+		start := end - 1
+		for start > 0 && posts[start].Parent != 0 {
+			start--
+		}
+		reversed = append(reversed, posts[start:end]...)
+		end = start
+	}
+	copy(posts, reversed)
 }
 
 func (svc *postsServiceImpl) GetPostDetails(ctx context.Context, request *dto.GetPostDetailsRequest) (*dto.Response, error) {
 	post, err := svc.db.PostsRepository.GetPostByID(ctx, request.ID)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find post by id: %d", request.ID)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find post by id: %d", request.ID), http.StatusNotFound)
 		}
 		return nil, err
 	}
@@ -136,19 +269,28 @@ func (svc *postsServiceImpl) GetPostDetails(ctx context.Context, request *dto.Ge
 }
 
 func (svc *postsServiceImpl) UpdatePost(ctx context.Context, request *dto.UpdatePostRequest) (*dto.Response, error) {
-	post, err := svc.db.PostsRepository.GetPostByID(ctx, request.ID)
+	post, err := svc.getEditablePost(ctx, request.ID)
 	if err != nil {
-		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find post by id: %d", request.ID)}, Code: http.StatusNotFound}, nil
-		}
+		return nil, err
+	}
+
+	if err := svc.authz.checkAuthorOrModerator(ctx, post.Author, post.Forum, "edit posts of others"); err != nil {
 		return nil, err
 	}
 
 	if len(request.Message) == 0 || request.Message == post.Message {
 		return &dto.Response{Data: post, Code: http.StatusOK}, nil
 	}
+	if err := checkForumOpenBySlug(ctx, svc.db, post.Forum); err != nil {
+		return nil, err
+	}
 
-	updatedPost, err := svc.db.PostsRepository.UpdatePost(ctx, request.ID, request.Message)
+	// Moderators edit posts of others too, so the editor is the caller when it is known and the author otherwise.
+	editor := post.Author
+	if identity, ok := auth.FromContext(ctx); ok {
+		editor = identity.Nickname
+	}
+	updatedPost, err := svc.db.PostsRepository.UpdatePost(ctx, request.ID, request.Message, editor, request.Reason)
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +298,181 @@ func (svc *postsServiceImpl) UpdatePost(ctx context.Context, request *dto.Update
 	return &dto.Response{Data: updatedPost, Code: http.StatusOK}, nil
 }
 
-func NewPostsService(log *customtypes.Logger, db *db.Repository) PostsService {
-	return &postsServiceImpl{log: log, db: db}
+func (svc *postsServiceImpl) GetPostRevisions(ctx context.Context, request *dto.GetPostRevisionsRequest) (*dto.Response, error) {
+	if _, err := svc.getEditablePost(ctx, request.ID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := svc.db.PostsRepository.GetPostRevisions(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: revisions, Code: http.StatusOK}, nil
+}
+
+// GetPostRevisionDiff shows the changes made by an edit: from the message kept by the revision
+// to the one kept by the next revision, or to the current message for the latest revision.
+func (svc *postsServiceImpl) GetPostRevisionDiff(ctx context.Context, request *dto.GetPostRevisionDiffRequest) (*dto.Response, error) {
+	post, err := svc.getEditablePost(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := svc.db.PostsRepository.GetPostRevisions(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Number < 1 || request.Number > int64(len(revisions)) {
+		return nil, constants.NewCodedError(fmt.Sprintf("Can't find revision %d of post %d", request.Number, request.ID), http.StatusNotFound)
+	}
+
+	fromName, toName := fmt.Sprintf("post/%d/revisions/%d", post.ID, request.Number), fmt.Sprintf("post/%d", post.ID)
+	to := post.Message
+	if request.Number < int64(len(revisions)) {
+		toName = fmt.Sprintf("post/%d/revisions/%d", post.ID, request.Number+1)
+		to = revisions[request.Number].Message
+	}
+
+	unified, err := diff.Unified(fromName, toName, revisions[request.Number-1].Message, to)
+	if err != nil {
+		return nil, constants.NewCodedError(fmt.Sprintf("Revision %d of post %d has too many lines to compare, the limit is %d", request.Number, request.ID, diff.MaxLines), http.StatusUnprocessableEntity)
+	}
+
+	return &dto.Response{Data: &dto.PostRevisionDiff{
+		Post:     post.ID,
+		Revision: request.Number,
+		Diff:     unified,
+	}, Code: http.StatusOK}, nil
+}
+
+// getEditablePost finds a post that is not deleted: the history of a deleted post is hidden along with its message.
+func (svc *postsServiceImpl) getEditablePost(ctx context.Context, id int64) (*core.Post, error) {
+	post, err := svc.db.PostsRepository.GetPostByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find post by id: %d", id), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if post.DeletedAt != nil {
+		return nil, constants.NewCodedError(fmt.Sprintf("Post %d is deleted", id), http.StatusConflict)
+	}
+	return post, nil
+}
+
+func (svc *postsServiceImpl) DeletePost(ctx context.Context, request *dto.DeletePostRequest) (*dto.Response, error) {
+	post, err := svc.db.PostsRepository.GetPostByID(ctx, request.ID)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find post by id: %d", request.ID), http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	if request.Hard {
+		if err := svc.authz.checkAdmin(ctx, "remove posts permanently"); err != nil {
+			return nil, err
+		}
+		deleted, err := svc.db.PostsRepository.DeletePostTree(ctx, request.ID)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find post by id: %d", request.ID), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		return &dto.Response{Data: &dto.DeletedPosts{Deleted: deleted}, Code: http.StatusOK}, nil
+	}
+
+	if err := svc.authz.checkAuthorOrModerator(ctx, post.Author, post.Forum, "delete posts of others"); err != nil {
+		return nil, err
+	}
+	post, err = svc.db.PostsRepository.DeletePost(ctx, request.ID)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find post by id: %d", request.ID), http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	return &dto.Response{Data: post, Code: http.StatusOK}, nil
+}
+
+// SplitPost breaks a post with its replies out into a new thread of the same forum, started by the author of the post.
+func (svc *postsServiceImpl) SplitPost(ctx context.Context, request *dto.SplitPostRequest) (*dto.Response, error) {
+	if request.Title == "" {
+		return nil, constants.NewCodedError("Thread title is required", http.StatusBadRequest)
+	}
+
+	post, err := svc.getEditablePost(ctx, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkModerator(ctx, "split threads", post.Forum); err != nil {
+		return nil, err
+	}
+
+	if request.Slug != "" {
+		if thread, err := svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, request.Slug); err != nil {
+			if !errors.Is(err, constants.ErrDBNotFound) {
+				return nil, err
+			}
+		} else {
+			return &dto.Response{Data: thread, Code: http.StatusConflict}, nil
+		}
+	}
+	if request.Message == "" {
+		request.Message = post.Message
+	}
+
+	var thread *core.Thread
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		post, err := lockPostThread(ctx, repo, post)
+		if err != nil {
+			return err
+		}
+		source, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, post.Thread)
+		if err != nil {
+			return err
+		}
+		if err := checkThreadVisible(source); err != nil {
+			return err
+		}
+		if err := checkForumOpenBySlug(ctx, repo, post.Forum); err != nil {
+			return err
+		}
+
+		newThread := &core.Thread{Forum: post.Forum, Title: request.Title, Author: post.Author, Message: request.Message, Slug: request.Slug, Created: time.Now()}
+		if thread, err = repo.ForumThreadRepository.CreateForumThread(ctx, newThread); err != nil {
+			return err
+		}
+		_, err = repo.PostsRepository.MovePostTree(ctx, post.ID, thread.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: thread, Code: http.StatusCreated}, nil
+}
+
+// lockPostThread locks the thread of the post and returns the post as read under the lock. The post may have been
+// moved along with its thread or subtree since it was read, then the thread it was moved to is locked in turn.
+func lockPostThread(ctx context.Context, repo *db.Repository, post *core.Post) (*core.Post, error) {
+	for locked := post.Thread; ; locked = post.Thread {
+		if err := repo.ForumThreadRepository.LockForumThreads(ctx, locked); err != nil {
+			return nil, err
+		}
+		current, err := repo.PostsRepository.GetPostByID(ctx, post.ID)
+		if err != nil {
+			return nil, err
+		}
+		if post = current; post.Thread == locked {
+			return post, nil
+		}
+	}
+}
+
+func NewPostsService(log *customtypes.Logger, db *db.Repository, enforceAuth bool) PostsService {
+	return &postsServiceImpl{log: log, db: db, authz: newAuthorizer(db, enforceAuth)}
 }
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+func TestLockPostThreadFollowsMovedPosts(t *testing.T) {
+	ctx := context.Background()
+	repo, err := db.NewMemoryRepository()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UserRepository.CreateUser(ctx, &core.User{Nickname: "alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ForumRepository.CreateForum(ctx, &core.Forum{Title: "Forum", User: "alice", Slug: "frm"}); err != nil {
+		t.Fatal(err)
+	}
+	threads := make([]*core.Thread, 2)
+	for i := range threads {
+		if threads[i], err = repo.ForumThreadRepository.CreateForumThread(ctx, &core.Thread{Title: "Thread", Author: "alice", Forum: "frm", Created: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	posts, err := repo.PostsRepository.CreatePosts(ctx, "frm", threads[0].ID, []*dto.PostData{{Author: "alice", Message: "moved"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := posts[0]
+	if _, err := repo.PostsRepository.MovePostTree(ctx, stale.ID, threads[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.WithTx(ctx, func(repo *db.Repository) error {
+		post, err := lockPostThread(ctx, repo, stale)
+		if err != nil {
+			return err
+		}
+		if post.Thread != threads[1].ID {
+			t.Errorf("post read in thread %d, want the thread it was moved to, %d", post.Thread, threads[1].ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,24 +1,50 @@
 package service
 
 import (
+	"time"
+
+	"github.com/senago/technopark-dbms/internal/auth"
 	"github.com/senago/technopark-dbms/internal/customtypes"
 	"github.com/senago/technopark-dbms/internal/db"
 )
 
+type Config struct {
+	// SearchLanguage is the text search configuration queries are parsed with.
+	SearchLanguage string
+	// TokenSecret signs session tokens, which stay valid for TokenTTL.
+	TokenSecret []byte
+	TokenTTL    time.Duration
+	// EnforceAuth requires requests acting as a user to be authenticated as that user, and edits and
+	// deletions of what others wrote to be made by moderators. Without it anyone may post, vote, edit
+	// and delete under any nickname, while moderation still requires a moderator or an admin.
+	EnforceAuth bool
+	// OpenClear lets anyone clear the service, for benchmarks that clear it before every run.
+	OpenClear bool
+}
+
 type Registry struct {
 	UserService        UserService
 	ForumService       ForumService
 	ForumThreadService ForumThreadService
 	PostsService       PostsService
+	SearchService      SearchService
+	AuthService        AuthService
+	RoleService        RoleService
+	// EventsService has to be Run for thread streams and gateway subscriptions to get any events.
+	EventsService EventsService
 }
 
-func NewRegistry(log *customtypes.Logger, repository *db.Repository) *Registry {
+func NewRegistry(log *customtypes.Logger, repository *db.Repository, config *Config) *Registry {
 	registry := &Registry{}
 
-	registry.UserService = NewUserService(log, repository)
-	registry.ForumService = NewForumService(log, repository)
-	registry.ForumThreadService = NewForumThreadService(log, repository)
-	registry.PostsService = NewPostsService(log, repository)
+	registry.UserService = NewUserService(log, repository, config.EnforceAuth)
+	registry.ForumService = NewForumService(log, repository, config.EnforceAuth)
+	registry.ForumThreadService = NewForumThreadService(log, repository, config.EnforceAuth)
+	registry.PostsService = NewPostsService(log, repository, config.EnforceAuth)
+	registry.SearchService = NewSearchService(log, repository, config.SearchLanguage)
+	registry.AuthService = NewAuthService(log, repository, auth.NewTokens(config.TokenSecret, config.TokenTTL), config.EnforceAuth)
+	registry.RoleService = NewRoleService(log, repository, config.EnforceAuth, config.OpenClear)
+	registry.EventsService = NewEventsService(log, repository)
 
-	return registry
+	return traceRegistry(registry)
 }
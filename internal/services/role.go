@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+type RoleService interface {
+	SetUserRole(ctx context.Context, request *dto.SetUserRoleRequest) (*dto.Response, error)
+	GetForumModerators(ctx context.Context, request *dto.GetForumModeratorsRequest) (*dto.Response, error)
+	UpdateForumModerators(ctx context.Context, request *dto.UpdateForumModeratorsRequest) (*dto.Response, error)
+	// AuthorizeClear lets only admins clear the service, unless it was configured to be cleared by anyone.
+	AuthorizeClear(ctx context.Context) error
+}
+
+type roleServiceImpl struct {
+	log       *customtypes.Logger
+	db        *db.Repository
+	authz     *authorizer
+	openClear bool
+}
+
+func (svc *roleServiceImpl) SetUserRole(ctx context.Context, request *dto.SetUserRoleRequest) (*dto.Response, error) {
+	if err := svc.authz.checkAdmin(ctx, "assign roles"); err != nil {
+		return nil, err
+	}
+
+	switch request.Role {
+	case core.RoleAdmin, core.RoleMember, core.RoleBanned:
+	default:
+		return nil, constants.NewCodedError(fmt.Sprintf("Unknown role: %s", request.Role), http.StatusBadRequest)
+	}
+
+	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.Nickname)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Nickname), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if err := svc.db.RoleRepository.SetUserRole(ctx, user.Nickname, request.Role); err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: &dto.UserRole{Nickname: user.Nickname, Role: request.Role}, Code: http.StatusOK}, nil
+}
+
+func (svc *roleServiceImpl) GetForumModerators(ctx context.Context, request *dto.GetForumModeratorsRequest) (*dto.Response, error) {
+	forum, err := svc.getForum(ctx, request.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	moderators, err := svc.db.RoleRepository.GetForumModerators(ctx, forum.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: moderators, Code: http.StatusOK}, nil
+}
+
+func (svc *roleServiceImpl) UpdateForumModerators(ctx context.Context, request *dto.UpdateForumModeratorsRequest) (*dto.Response, error) {
+	forum, err := svc.getForum(ctx, request.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkOwner(ctx, forum, "manage moderators"); err != nil {
+		return nil, err
+	}
+
+	for i, nickname := range request.Add {
+		user, err := svc.db.UserRepository.GetUserByNickname(ctx, nickname)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", nickname), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		request.Add[i] = user.Nickname
+	}
+
+	var moderators []*core.User
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		for _, nickname := range request.Add {
+			if err := repo.RoleRepository.AddForumModerator(ctx, forum.Slug, nickname); err != nil {
+				return err
+			}
+		}
+		for _, nickname := range request.Remove {
+			if err := repo.RoleRepository.RemoveForumModerator(ctx, forum.Slug, nickname); err != nil {
+				return err
+			}
+		}
+
+		moderators, err = repo.RoleRepository.GetForumModerators(ctx, forum.Slug)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: moderators, Code: http.StatusOK}, nil
+}
+
+func (svc *roleServiceImpl) AuthorizeClear(ctx context.Context) error {
+	if svc.openClear {
+		return nil
+	}
+	return svc.authz.checkAdmin(ctx, "clear the service")
+}
+
+func (svc *roleServiceImpl) getForum(ctx context.Context, slug string) (*core.Forum, error) {
+	forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", slug), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return forum, nil
+}
+
+func NewRoleService(log *customtypes.Logger, db *db.Repository, enforceAuth, openClear bool) RoleService {
+	return &roleServiceImpl{log: log, db: db, authz: newAuthorizer(db, enforceAuth), openClear: openClear}
+}
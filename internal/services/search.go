@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/customtypes"
+	"github.com/senago/technopark-dbms/internal/db"
+	"github.com/senago/technopark-dbms/internal/model/core"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+)
+
+type SearchService interface {
+	Search(ctx context.Context, request *dto.SearchRequest) (*dto.Response, error)
+}
+
+type searchServiceImpl struct {
+	log      *customtypes.Logger
+	db       *db.Repository
+	language string
+}
+
+func (svc *searchServiceImpl) Search(ctx context.Context, request *dto.SearchRequest) (*dto.Response, error) {
+	if strings.TrimSpace(request.Query) == "" {
+		return nil, constants.NewCodedError("Search query is required", http.StatusBadRequest)
+	}
+	switch request.Type {
+	case "", db.SearchTypePost, db.SearchTypeThread:
+	default:
+		return nil, constants.NewCodedError("Search type must be either post or thread", http.StatusBadRequest)
+	}
+
+	filter := &db.SearchFilter{Query: request.Query, Language: svc.language, Type: request.Type, Forum: request.Forum, Author: request.Author}
+
+	// The scope binds a cursor to the exact search it was issued for without spelling the query out in it.
+	digest := sha256.Sum256([]byte(strings.Join([]string{request.Type, strings.ToLower(request.Forum), strings.ToLower(request.Author), request.Query}, "\x00")))
+	scope := "search:" + hex.EncodeToString(digest[:8])
+	if err := checkCursor(request.Cursor, scope); err != nil {
+		return nil, err
+	}
+
+	var results []*core.SearchResult
+	var err error
+	if request.Cursor == nil {
+		results, err = svc.db.SearchRepository.Search(ctx, filter, request.Limit, nil, true)
+	} else {
+		after, desc := keysetOf(request.Cursor)
+		results, err = svc.db.SearchRepository.Search(ctx, filter, request.Limit, after, desc)
+		if request.Cursor.Back {
+			reverse(results)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next, prev := pageCursors(results, request.Limit, request.Cursor, scope, true, func(r *core.SearchResult) dto.Cursor {
+		return dto.Cursor{Rank: r.Rank, Kind: r.Type, ID: r.ID}
+	})
+
+	return &dto.Response{Data: results, Code: http.StatusOK, Next: next, Prev: prev}, nil
+}
+
+func NewSearchService(log *customtypes.Logger, db *db.Repository, language string) SearchService {
+	return &searchServiceImpl{log: log, db: db, language: language}
+}
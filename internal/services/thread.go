@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/senago/technopark-dbms/internal/constants"
 	"github.com/senago/technopark-dbms/internal/customtypes"
@@ -19,26 +20,40 @@ type ForumThreadService interface {
 	UpdateVote(ctx context.Context, slugOrID string, request *dto.UpdateVoteRequest) (*dto.Response, error)
 	GetThreadDetails(ctx context.Context, slugOrID string) (*dto.Response, error)
 	UpdateForumThread(ctx context.Context, slugOrID string, request *dto.UpdateForumThreadRequest) (*dto.Response, error)
+	ModerateThread(ctx context.Context, slugOrID string, request *dto.ModerateThreadRequest) (*dto.Response, error)
+	MoveThread(ctx context.Context, slugOrID string, request *dto.MoveThreadRequest) (*dto.Response, error)
+	MergeThread(ctx context.Context, slugOrID string, request *dto.MergeThreadRequest) (*dto.Response, error)
 }
 
 type forumThreadServiceImpl struct {
-	log *customtypes.Logger
-	db  *db.Repository
+	log   *customtypes.Logger
+	db    *db.Repository
+	authz *authorizer
 }
 
 func (svc *forumThreadServiceImpl) CreateForumThread(ctx context.Context, request *dto.CreateForumThreadRequest) (*dto.Response, error) {
+	if err := svc.authz.checkActor(ctx, request.Author); err != nil {
+		return nil, err
+	}
+
 	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.Author)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", request.Author)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Author), http.StatusNotFound)
 		}
+		return nil, err
 	}
 	request.Author = user.Nickname
 
 	if forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Forum); err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", request.Forum)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", request.Forum), http.StatusNotFound)
 		}
+		return nil, err
+	} else if err := checkForumOpen(forum); err != nil {
+		return nil, err
+	} else if err := svc.authz.checkScope(ctx, core.ScopePost, forum.Slug); err != nil {
+		return nil, err
 	} else {
 		request.Forum = forum.Slug
 	}
@@ -63,6 +78,10 @@ func (svc *forumThreadServiceImpl) CreateForumThread(ctx context.Context, reques
 }
 
 func (svc *forumThreadServiceImpl) UpdateVote(ctx context.Context, slugOrID string, request *dto.UpdateVoteRequest) (*dto.Response, error) {
+	if err := svc.authz.checkActor(ctx, request.Nickname); err != nil {
+		return nil, err
+	}
+
 	var id int
 	var err error
 	id, err = strconv.Atoi(slugOrID)
@@ -71,73 +90,63 @@ func (svc *forumThreadServiceImpl) UpdateVote(ctx context.Context, slugOrID stri
 	if err != nil {
 		if thread, err = svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID), http.StatusNotFound)
 			}
+			return nil, err
 		} else {
 			id = int(thread.ID)
 		}
 	} else {
 		if thread, err = svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id)); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by id: %d", id)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", id), http.StatusNotFound)
 			}
+			return nil, err
 		}
 	}
+	if err := checkThreadOpen(thread); err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkScope(ctx, core.ScopeVote, thread.Forum); err != nil {
+		return nil, err
+	}
+	if err := checkForumOpenBySlug(ctx, svc.db, thread.Forum); err != nil {
+		return nil, err
+	}
 
 	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.Nickname)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", request.Nickname)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Nickname), http.StatusNotFound)
 		}
-	}
-	request.Nickname = user.Nickname
-
-	exists, err := svc.db.VotesRepository.VoteExists(ctx, request.Nickname, thread.ID)
-	if err != nil {
 		return nil, err
 	}
+	request.Nickname = user.Nickname
 
-	if exists {
-		if ok, err := svc.db.VotesRepository.UpdateVote(ctx, thread.ID, request.Nickname, request.Voice); err != nil {
-			return nil, err
-		} else if ok {
-			thread.Votes += request.Voice * 2
-		}
-	} else {
-		newVote := &core.Vote{
-			Nickname: request.Nickname,
-			ThreadID: thread.ID,
-			Voice:    request.Voice,
-		}
-
-		if err := svc.db.VotesRepository.CreateVote(ctx, newVote); err != nil {
-			return nil, err
+	// The vote is cast in one statement, so concurrent votes on the thread only queue up on its row.
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		vote := &core.Vote{Nickname: request.Nickname, ThreadID: thread.ID, Voice: request.Voice}
+		if err := repo.VotesRepository.SetVote(ctx, vote); err != nil {
+			return err
 		}
 
-		thread.Votes += request.Voice
+		thread, err = repo.ForumThreadRepository.GetForumThreadByID(ctx, thread.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &dto.Response{Data: thread, Code: http.StatusOK}, nil
 }
 
 func (svc *forumThreadServiceImpl) GetThreadDetails(ctx context.Context, slugOrID string) (*dto.Response, error) {
-	id, err := strconv.Atoi(slugOrID)
+	thread, err := findThread(ctx, svc.db, slugOrID)
 	if err != nil {
-		if thread, err := svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID); err != nil {
-			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID)}, Code: http.StatusNotFound}, nil
-			}
-			return nil, err
-		} else {
-			return &dto.Response{Data: thread, Code: http.StatusOK}, nil
-		}
+		return nil, err
 	}
-
-	thread, err := svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id))
-	if err != nil {
-		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by id: %d", id)}, Code: http.StatusNotFound}, nil
-		}
+	if err := checkThreadVisible(thread); err != nil {
+		return nil, err
 	}
 
 	return &dto.Response{Data: thread, Code: http.StatusOK}, nil
@@ -151,7 +160,7 @@ func (svc *forumThreadServiceImpl) UpdateForumThread(ctx context.Context, slugOr
 	if err != nil {
 		if thread, err = svc.db.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID); err != nil {
 			if errors.Is(err, constants.ErrDBNotFound) {
-				return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID)}, Code: http.StatusNotFound}, nil
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID), http.StatusNotFound)
 			}
 			return nil, err
 		} else {
@@ -161,8 +170,18 @@ func (svc *forumThreadServiceImpl) UpdateForumThread(ctx context.Context, slugOr
 
 	if thread, err = svc.db.ForumThreadRepository.GetForumThreadByID(ctx, int64(id)); err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find thread forum by id: %d", id)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", id), http.StatusNotFound)
 		}
+		return nil, err
+	}
+	if err := checkThreadVisible(thread); err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkAuthorOrModerator(ctx, thread.Author, thread.Forum, "edit threads of others"); err != nil {
+		return nil, err
+	}
+	if err := checkForumOpenBySlug(ctx, svc.db, thread.Forum); err != nil {
+		return nil, err
 	}
 
 	if len(request.Title) == 0 {
@@ -177,6 +196,167 @@ func (svc *forumThreadServiceImpl) UpdateForumThread(ctx context.Context, slugOr
 	return &dto.Response{Data: thread, Code: http.StatusOK}, err
 }
 
-func NewForumThreadService(log *customtypes.Logger, db *db.Repository) ForumThreadService {
-	return &forumThreadServiceImpl{log: log, db: db}
+func (svc *forumThreadServiceImpl) ModerateThread(ctx context.Context, slugOrID string, request *dto.ModerateThreadRequest) (*dto.Response, error) {
+	thread, err := findThread(ctx, svc.db, slugOrID)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkModerator(ctx, "moderate threads", thread.Forum); err != nil {
+		return nil, err
+	}
+
+	moderation := &db.ThreadModeration{Locked: request.Locked, Pinned: request.Pinned, Deleted: request.Deleted}
+	if thread, err = svc.db.ForumThreadRepository.ModerateForumThread(ctx, thread.ID, moderation); err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: thread, Code: http.StatusOK}, nil
+}
+
+func (svc *forumThreadServiceImpl) MoveThread(ctx context.Context, slugOrID string, request *dto.MoveThreadRequest) (*dto.Response, error) {
+	thread, err := findThread(ctx, svc.db, slugOrID)
+	if err != nil {
+		return nil, err
+	}
+
+	forum, err := svc.db.ForumRepository.GetForumBySlug(ctx, request.Forum)
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find forum with slug: %s", request.Forum), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if err := checkForumOpen(forum); err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkModerator(ctx, "move threads", thread.Forum, forum.Slug); err != nil {
+		return nil, err
+	}
+
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		if err := repo.ForumThreadRepository.LockForumThreads(ctx, thread.ID); err != nil {
+			return err
+		}
+		// The counters are fixed up from the state of the thread, which may have changed before it was locked.
+		current, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, thread.ID)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(current.Forum, forum.Slug) {
+			thread = current
+			return nil
+		}
+
+		thread, err = repo.ForumThreadRepository.MoveForumThread(ctx, current, forum.Slug)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: thread, Code: http.StatusOK}, nil
+}
+
+// MergeThread moves the posts of a thread into another one, moving them to its forum first if needed.
+// The merged thread is deleted along with its title and message, its root posts become root posts of the target.
+func (svc *forumThreadServiceImpl) MergeThread(ctx context.Context, slugOrID string, request *dto.MergeThreadRequest) (*dto.Response, error) {
+	source, err := findThread(ctx, svc.db, slugOrID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := findThread(ctx, svc.db, request.Into)
+	if err != nil {
+		return nil, err
+	}
+	if source.ID == target.ID {
+		return nil, constants.NewCodedError(fmt.Sprintf("Can't merge thread %d into itself", source.ID), http.StatusBadRequest)
+	}
+	if err := svc.authz.checkModerator(ctx, "merge threads", source.Forum, target.Forum); err != nil {
+		return nil, err
+	}
+
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		if err := repo.ForumThreadRepository.LockForumThreads(ctx, source.ID, target.ID); err != nil {
+			return err
+		}
+		if source, err = repo.ForumThreadRepository.GetForumThreadByID(ctx, source.ID); err != nil {
+			return err
+		}
+		if target, err = repo.ForumThreadRepository.GetForumThreadByID(ctx, target.ID); err != nil {
+			return err
+		}
+		if err := checkThreadVisible(source); err != nil {
+			return err
+		}
+		if err := checkThreadVisible(target); err != nil {
+			return err
+		}
+		if err := checkForumOpenBySlug(ctx, repo, target.Forum); err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(source.Forum, target.Forum) {
+			if source, err = repo.ForumThreadRepository.MoveForumThread(ctx, source, target.Forum); err != nil {
+				return err
+			}
+		}
+		if err := repo.ForumThreadRepository.MergeForumThread(ctx, source.ID, target.ID); err != nil {
+			return err
+		}
+
+		target, err = repo.ForumThreadRepository.GetForumThreadByID(ctx, target.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.Response{Data: target, Code: http.StatusOK}, nil
+}
+
+// findThread looks a thread up by its slug or, for a numeric slugOrID, its id. Deleted threads are found as well.
+func findThread(ctx context.Context, repo *db.Repository, slugOrID string) (*core.Thread, error) {
+	id, err := strconv.Atoi(slugOrID)
+	if err != nil {
+		thread, err := repo.ForumThreadRepository.GetForumThreadBySlug(ctx, slugOrID)
+		if err != nil {
+			if errors.Is(err, constants.ErrDBNotFound) {
+				return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by slug: %s", slugOrID), http.StatusNotFound)
+			}
+			return nil, err
+		}
+		return thread, nil
+	}
+
+	thread, err := repo.ForumThreadRepository.GetForumThreadByID(ctx, int64(id))
+	if err != nil {
+		if errors.Is(err, constants.ErrDBNotFound) {
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", id), http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return thread, nil
+}
+
+// checkThreadVisible hides deleted threads from everything but moderation.
+func checkThreadVisible(thread *core.Thread) error {
+	if thread.DeletedAt != nil {
+		return constants.NewCodedError(fmt.Sprintf("Can't find thread forum by id: %d", thread.ID), http.StatusNotFound)
+	}
+	return nil
+}
+
+// checkThreadOpen rejects posts and votes in locked threads.
+func checkThreadOpen(thread *core.Thread) error {
+	if err := checkThreadVisible(thread); err != nil {
+		return err
+	}
+	if thread.Locked {
+		return constants.NewCodedError(fmt.Sprintf("Thread %d is locked", thread.ID), http.StatusForbidden)
+	}
+	return nil
+}
+
+func NewForumThreadService(log *customtypes.Logger, db *db.Repository, enforceAuth bool) ForumThreadService {
+	return &forumThreadServiceImpl{log: log, db: db, authz: newAuthorizer(db, enforceAuth)}
 }
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/senago/technopark-dbms/internal/auth"
+	"github.com/senago/technopark-dbms/internal/constants"
+	"github.com/senago/technopark-dbms/internal/model/dto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/senago/technopark-dbms/internal/services")
+
+// traceRegistry wraps every service of the registry so that each call gets a span of its own.
+func traceRegistry(registry *Registry) *Registry {
+	return &Registry{
+		UserService:        &tracedUserService{next: registry.UserService},
+		ForumService:       &tracedForumService{next: registry.ForumService},
+		ForumThreadService: &tracedForumThreadService{next: registry.ForumThreadService},
+		PostsService:       &tracedPostsService{next: registry.PostsService},
+		SearchService:      &tracedSearchService{next: registry.SearchService},
+		AuthService:        &tracedAuthService{next: registry.AuthService},
+		RoleService:        &tracedRoleService{next: registry.RoleService},
+		EventsService:      &tracedEventsService{next: registry.EventsService},
+	}
+}
+
+// endSpan records err on the span. Errors the client is to blame for do not fail the span.
+func endSpan(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+
+	var codedErr *constants.CodedError
+	if errors.As(err, &codedErr) && codedErr.Code() < 500 {
+		return
+	}
+	span.SetStatus(codes.Error, err.Error())
+}
+
+type tracedUserService struct {
+	next UserService
+}
+
+func (svc *tracedUserService) CreateUser(ctx context.Context, request *dto.CreateUserRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
+	response, err := svc.next.CreateUser(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedUserService) GetUserProfile(ctx context.Context, request *dto.GetUserProfileRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUserProfile")
+	defer span.End()
+
+	response, err := svc.next.GetUserProfile(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedUserService) UpdateUserProfile(ctx context.Context, request *dto.UpdateUserProfileRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "UserService.UpdateUserProfile")
+	defer span.End()
+
+	response, err := svc.next.UpdateUserProfile(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedForumService struct {
+	next ForumService
+}
+
+func (svc *tracedForumService) CreateForum(ctx context.Context, request *dto.CreateForumRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.CreateForum")
+	defer span.End()
+
+	response, err := svc.next.CreateForum(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) GetForumBySlug(ctx context.Context, request *dto.GetForumBySlugRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.GetForumBySlug")
+	defer span.End()
+
+	response, err := svc.next.GetForumBySlug(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) GetForumThreads(ctx context.Context, request *dto.GetForumThreadsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.GetForumThreads")
+	defer span.End()
+
+	response, err := svc.next.GetForumThreads(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) GetForumUsers(ctx context.Context, request *dto.GetForumUsersRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.GetForumUsers")
+	defer span.End()
+
+	response, err := svc.next.GetForumUsers(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) GetForumChildren(ctx context.Context, request *dto.GetForumChildrenRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.GetForumChildren")
+	defer span.End()
+
+	response, err := svc.next.GetForumChildren(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) GetForumTree(ctx context.Context) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.GetForumTree")
+	defer span.End()
+
+	response, err := svc.next.GetForumTree(ctx)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) UpdateForum(ctx context.Context, slug string, request *dto.UpdateForumRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.UpdateForum")
+	defer span.End()
+
+	response, err := svc.next.UpdateForum(ctx, slug, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumService) DeleteForum(ctx context.Context, request *dto.DeleteForumRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumService.DeleteForum")
+	defer span.End()
+
+	response, err := svc.next.DeleteForum(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedForumThreadService struct {
+	next ForumThreadService
+}
+
+func (svc *tracedForumThreadService) CreateForumThread(ctx context.Context, request *dto.CreateForumThreadRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.CreateForumThread")
+	defer span.End()
+
+	response, err := svc.next.CreateForumThread(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) UpdateVote(ctx context.Context, slugOrID string, request *dto.UpdateVoteRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.UpdateVote")
+	defer span.End()
+
+	response, err := svc.next.UpdateVote(ctx, slugOrID, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) GetThreadDetails(ctx context.Context, slugOrID string) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.GetThreadDetails")
+	defer span.End()
+
+	response, err := svc.next.GetThreadDetails(ctx, slugOrID)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) UpdateForumThread(ctx context.Context, slugOrID string, request *dto.UpdateForumThreadRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.UpdateForumThread")
+	defer span.End()
+
+	response, err := svc.next.UpdateForumThread(ctx, slugOrID, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) ModerateThread(ctx context.Context, slugOrID string, request *dto.ModerateThreadRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.ModerateThread")
+	defer span.End()
+
+	response, err := svc.next.ModerateThread(ctx, slugOrID, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) MoveThread(ctx context.Context, slugOrID string, request *dto.MoveThreadRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.MoveThread")
+	defer span.End()
+
+	response, err := svc.next.MoveThread(ctx, slugOrID, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedForumThreadService) MergeThread(ctx context.Context, slugOrID string, request *dto.MergeThreadRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "ForumThreadService.MergeThread")
+	defer span.End()
+
+	response, err := svc.next.MergeThread(ctx, slugOrID, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedPostsService struct {
+	next PostsService
+}
+
+func (svc *tracedPostsService) CreatePosts(ctx context.Context, slugOrID string, posts []*dto.PostData) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.CreatePosts")
+	defer span.End()
+
+	response, err := svc.next.CreatePosts(ctx, slugOrID, posts)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) GetPosts(ctx context.Context, request *dto.GetPostsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.GetPosts")
+	defer span.End()
+
+	response, err := svc.next.GetPosts(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) GetPostDetails(ctx context.Context, request *dto.GetPostDetailsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.GetPostDetails")
+	defer span.End()
+
+	response, err := svc.next.GetPostDetails(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) UpdatePost(ctx context.Context, request *dto.UpdatePostRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.UpdatePost")
+	defer span.End()
+
+	response, err := svc.next.UpdatePost(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) GetPostRevisions(ctx context.Context, request *dto.GetPostRevisionsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.GetPostRevisions")
+	defer span.End()
+
+	response, err := svc.next.GetPostRevisions(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) GetPostRevisionDiff(ctx context.Context, request *dto.GetPostRevisionDiffRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.GetPostRevisionDiff")
+	defer span.End()
+
+	response, err := svc.next.GetPostRevisionDiff(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) DeletePost(ctx context.Context, request *dto.DeletePostRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.DeletePost")
+	defer span.End()
+
+	response, err := svc.next.DeletePost(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedPostsService) SplitPost(ctx context.Context, request *dto.SplitPostRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "PostsService.SplitPost")
+	defer span.End()
+
+	response, err := svc.next.SplitPost(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedSearchService struct {
+	next SearchService
+}
+
+func (svc *tracedSearchService) Search(ctx context.Context, request *dto.SearchRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "SearchService.Search")
+	defer span.End()
+
+	response, err := svc.next.Search(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedAuthService struct {
+	next AuthService
+}
+
+func (svc *tracedAuthService) Login(ctx context.Context, request *dto.LoginRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	response, err := svc.next.Login(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedAuthService) Logout(ctx context.Context) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Logout")
+	defer span.End()
+
+	response, err := svc.next.Logout(ctx)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedAuthService) Authenticate(ctx context.Context, token string) (*auth.Identity, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Authenticate")
+	defer span.End()
+
+	identity, err := svc.next.Authenticate(ctx, token)
+	endSpan(span, err)
+	return identity, err
+}
+
+func (svc *tracedAuthService) CreateAPIKey(ctx context.Context, request *dto.CreateAPIKeyRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.CreateAPIKey")
+	defer span.End()
+
+	response, err := svc.next.CreateAPIKey(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedAuthService) GetAPIKeys(ctx context.Context, request *dto.GetAPIKeysRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetAPIKeys")
+	defer span.End()
+
+	response, err := svc.next.GetAPIKeys(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedAuthService) RevokeAPIKey(ctx context.Context, request *dto.RevokeAPIKeyRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeAPIKey")
+	defer span.End()
+
+	response, err := svc.next.RevokeAPIKey(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+type tracedRoleService struct {
+	next RoleService
+}
+
+func (svc *tracedRoleService) SetUserRole(ctx context.Context, request *dto.SetUserRoleRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.SetUserRole")
+	defer span.End()
+
+	response, err := svc.next.SetUserRole(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedRoleService) GetForumModerators(ctx context.Context, request *dto.GetForumModeratorsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.GetForumModerators")
+	defer span.End()
+
+	response, err := svc.next.GetForumModerators(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedRoleService) UpdateForumModerators(ctx context.Context, request *dto.UpdateForumModeratorsRequest) (*dto.Response, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.UpdateForumModerators")
+	defer span.End()
+
+	response, err := svc.next.UpdateForumModerators(ctx, request)
+	endSpan(span, err)
+	return response, err
+}
+
+func (svc *tracedRoleService) AuthorizeClear(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "RoleService.AuthorizeClear")
+	defer span.End()
+
+	err := svc.next.AuthorizeClear(ctx)
+	endSpan(span, err)
+	return err
+}
+
+type tracedEventsService struct {
+	next EventsService
+}
+
+// Run is not traced, it lasts as long as the server.
+func (svc *tracedEventsService) Run(ctx context.Context) {
+	svc.next.Run(ctx)
+}
+
+func (svc *tracedEventsService) WatchThread(ctx context.Context, request *dto.WatchThreadRequest) (*ThreadStream, error) {
+	ctx, span := tracer.Start(ctx, "EventsService.WatchThread")
+	defer span.End()
+
+	stream, err := svc.next.WatchThread(ctx, request)
+	endSpan(span, err)
+	return stream, err
+}
+
+func (svc *tracedEventsService) Subscribe() *Subscription {
+	return svc.next.Subscribe()
+}
@@ -20,8 +20,9 @@ type UserService interface {
 }
 
 type userServiceImpl struct {
-	log *customtypes.Logger
-	db  *db.Repository
+	log   *customtypes.Logger
+	db    *db.Repository
+	authz *authorizer
 }
 
 func (svc *userServiceImpl) CreateUser(ctx context.Context, request *dto.CreateUserRequest) (*dto.Response, error) {
@@ -32,7 +33,24 @@ func (svc *userServiceImpl) CreateUser(ctx context.Context, request *dto.CreateU
 	}
 
 	user := &core.User{Nickname: request.Nickname, Fullname: request.Fullname, About: request.About, Email: request.Email}
-	if err := svc.db.UserRepository.CreateUser(ctx, user); err != nil {
+	if request.Password == "" {
+		if err := svc.db.UserRepository.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+		return &dto.Response{Data: user, Code: http.StatusCreated}, nil
+	}
+
+	hash, err := hashPassword(request.Password)
+	if err != nil {
+		return nil, err
+	}
+	err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+		if err := repo.UserRepository.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		return repo.UserRepository.SetUserPassword(ctx, user.Nickname, hash)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -43,7 +61,7 @@ func (svc *userServiceImpl) GetUserProfile(ctx context.Context, request *dto.Get
 	user, err := svc.db.UserRepository.GetUserByNickname(ctx, request.Nickname)
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", request.Nickname)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Nickname), http.StatusNotFound)
 		}
 		return nil, err
 	}
@@ -51,27 +69,50 @@ func (svc *userServiceImpl) GetUserProfile(ctx context.Context, request *dto.Get
 }
 
 func (svc *userServiceImpl) UpdateUserProfile(ctx context.Context, request *dto.UpdateUserProfileRequest) (*dto.Response, error) {
+	if err := svc.authz.checkActor(ctx, request.Nickname); err != nil {
+		return nil, err
+	}
+	if err := svc.authz.checkSession(ctx); err != nil {
+		return nil, err
+	}
+
 	if len(request.Email) > 0 {
 		if user, err := svc.db.UserRepository.GetUserByEmail(ctx, request.Email); err != nil {
 			if !errors.Is(err, constants.ErrDBNotFound) {
 				return nil, err
 			}
 		} else if user.Nickname != request.Nickname {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("This email is already registered by user: %s", user.Nickname)}, Code: http.StatusConflict}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("This email is already registered by user: %s", user.Nickname), http.StatusConflict)
 		}
 	}
 
 	user := &core.User{Nickname: request.Nickname, Fullname: request.Fullname, About: request.About, Email: request.Email}
-	updatedUser, err := svc.db.UserRepository.UpdateUser(ctx, user)
+	var updatedUser *core.User
+	var err error
+	if request.Password == "" {
+		updatedUser, err = svc.db.UserRepository.UpdateUser(ctx, user)
+	} else {
+		var hash string
+		if hash, err = hashPassword(request.Password); err != nil {
+			return nil, err
+		}
+		err = svc.db.WithTx(ctx, func(repo *db.Repository) error {
+			var err error
+			if updatedUser, err = repo.UserRepository.UpdateUser(ctx, user); err != nil {
+				return err
+			}
+			return repo.UserRepository.SetUserPassword(ctx, user.Nickname, hash)
+		})
+	}
 	if err != nil {
 		if errors.Is(err, constants.ErrDBNotFound) {
-			return &dto.Response{Data: dto.ErrorResponse{Message: fmt.Sprintf("Can't find user by nickname: %s", request.Nickname)}, Code: http.StatusNotFound}, nil
+			return nil, constants.NewCodedError(fmt.Sprintf("Can't find user by nickname: %s", request.Nickname), http.StatusNotFound)
 		}
 		return nil, err
 	}
 	return &dto.Response{Data: updatedUser, Code: http.StatusOK}, nil
 }
 
-func NewUserService(log *customtypes.Logger, db *db.Repository) UserService {
-	return &userServiceImpl{log: log, db: db}
+func NewUserService(log *customtypes.Logger, db *db.Repository, enforceAuth bool) UserService {
+	return &userServiceImpl{log: log, db: db, authz: newAuthorizer(db, enforceAuth)}
 }
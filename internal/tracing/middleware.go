@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/senago/technopark-dbms/internal/tracing"
+
+// Middleware starts a server span for every request, continuing the trace of an incoming traceparent header,
+// and puts it into the request's user context. Errors are rendered by the app's error handler here,
+// so that the span gets the status code of the response.
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(instrumentationName)
+
+	return func(ctx *fiber.Ctx) error {
+		parent := otel.GetTextMapPropagator().Extract(ctx.UserContext(), headerCarrier{header: &ctx.Request().Header})
+
+		// Attribute values outlive the request, while fiber's strings point into reused buffers.
+		method := utils.CopyString(ctx.Method())
+		spanCtx, span := tracer.Start(parent, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPMethodKey.String(method),
+			// The query is left out, it may carry secrets.
+			semconv.HTTPTargetKey.String(string(ctx.Request().URI().Path())),
+		))
+		defer span.End()
+
+		self := ctx.Route()
+		ctx.SetUserContext(spanCtx)
+		if err := ctx.Next(); err != nil {
+			span.RecordError(err)
+			if err := ctx.App().Config().ErrorHandler(ctx, err); err != nil {
+				_ = ctx.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		if route := ctx.Route(); route != self {
+			span.SetName(method + " " + route.Path)
+			span.SetAttributes(semconv.HTTPRouteKey.String(route.Path))
+		}
+		status := ctx.Response().StatusCode()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, utils.StatusMessage(status))
+		}
+
+		return nil
+	}
+}
+
+// headerCarrier adapts fasthttp request headers to propagation.TextMapCarrier.
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c headerCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c.header.Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := []string{}
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}